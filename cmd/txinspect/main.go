@@ -0,0 +1,112 @@
+// txinspect 查看一笔交易的调用树、代币转账、各地址净变化、交易标签和最大成交额。
+//
+//	txinspect --rpc https://bsc-dataseed.bnbchain.org --tx 0x... [--table | --json | --dot]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+func main() {
+	var (
+		rpcURL   = flag.String("rpc", os.Getenv("RPC_URL"), "节点 RPC 地址，需要支持 debug_traceTransaction，默认读取 RPC_URL")
+		txHash   = flag.String("tx", "", "交易哈希")
+		asJSON   = flag.Bool("json", false, "输出 JSON")
+		asDOT    = flag.Bool("dot", false, "输出转账图的 Graphviz DOT")
+		asTable  = flag.Bool("table", false, "输出表格（默认）")
+		bnbPrice = flag.Float64("bnb-price", 0, "BNB 的 USD 价格，用于计算最大成交额；为 0 时只按稳定币计算")
+		timeout  = flag.Duration("timeout", 30*time.Second, "请求超时")
+	)
+	flag.Parse()
+
+	if *rpcURL == "" || *txHash == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if countTrue(*asJSON, *asDOT, *asTable) > 1 {
+		fmt.Fprintln(os.Stderr, "--json, --dot and --table are mutually exclusive")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	tokens := tokenDetails(*bnbPrice)
+	report, tracker, err := inspect(ctx, *rpcURL, common.HexToHash(*txHash), tokens)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "txinspect:", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case *asJSON:
+		err = writeJSON(os.Stdout, report)
+	case *asDOT:
+		_, err = fmt.Fprint(os.Stdout, tracker.ToDOT(tokens))
+	default:
+		err = writeTable(os.Stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "txinspect:", err)
+		os.Exit(1)
+	}
+}
+
+// inspect 拉取交易、回执和 callTracer 结果并生成报告
+func inspect(ctx context.Context, rpcURL string, hash common.Hash, tokens map[common.Address]*geth.TokenPrice) (*Report, *geth.TransferTracker, error) {
+	client, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+
+	tx, err := geth.GetTransactionByHash(ctx, client, hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get transaction: %w", err)
+	}
+	receipt, err := geth.GetTransactionReceipt(ctx, client, hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get receipt: %w", err)
+	}
+	root, err := geth.TraceTransactionContext(ctx, rpcURL, hash.Hex())
+	if err != nil {
+		return nil, nil, fmt.Errorf("trace transaction: %w", err)
+	}
+	if root == nil {
+		return nil, nil, fmt.Errorf("trace transaction: empty result")
+	}
+
+	tracker := geth.NewTransferTrackerFromLogs(hash.Hex(), receipt.Logs, root)
+	return buildReport(tx, receipt, root, tracker, tokens), tracker, nil
+}
+
+// tokenDetails 已知代币的精度和价格，bnbPrice 同时用于 BNB 和 WBNB
+func tokenDetails(bnbPrice float64) map[common.Address]*geth.TokenPrice {
+	tokens := make(map[common.Address]*geth.TokenPrice)
+	for _, t := range []geth.TokenPrice{geth.BNB, geth.WBNB, geth.USDT, geth.USDC, geth.USD1, geth.WBTC} {
+		tokens[t.Address] = &t
+	}
+	if bnbPrice > 0 {
+		tokens[geth.BNB.Address].SetTokenPrice(bnbPrice)
+		tokens[geth.WBNB.Address].SetTokenPrice(bnbPrice)
+	}
+	return tokens
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
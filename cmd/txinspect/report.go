@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+// Report 一笔交易的检查结果
+type Report struct {
+	TxHash           string          `json:"tx_hash"`
+	BlockNumber      uint64          `json:"block_number"`
+	From             common.Address  `json:"from"`
+	To               *common.Address `json:"to"`
+	Status           uint64          `json:"status"`
+	Flag             string          `json:"flag"`
+	MaxSwapVolumeUSD float64         `json:"max_swap_volume_usd"`
+	Trace            *geth.TraceCall `json:"trace"`
+	Transfers        []*TransferRow  `json:"transfers"`
+	Changes          []*ChangeRow    `json:"changes"`
+}
+
+// TransferRow 解码后的一笔转账
+type TransferRow struct {
+	Seq        int                 `json:"seq"`
+	Source     geth.TransferSource `json:"source"`
+	From       common.Address      `json:"from"`
+	To         common.Address      `json:"to"`
+	Token      common.Address      `json:"token"`
+	Symbol     string              `json:"symbol,omitempty"`
+	Amount     string              `json:"amount"`
+	AmountText string              `json:"amount_text,omitempty"`
+}
+
+// ChangeRow 某个地址某个代币的净变化，按地址、代币排序
+type ChangeRow struct {
+	Address    common.Address `json:"address"`
+	Token      common.Address `json:"token"`
+	Symbol     string         `json:"symbol,omitempty"`
+	Amount     string         `json:"amount"`
+	AmountText string         `json:"amount_text,omitempty"`
+}
+
+func buildReport(tx *types.Transaction, receipt *types.Receipt, root *geth.TraceCall, tracker *geth.TransferTracker, tokens map[common.Address]*geth.TokenPrice) *Report {
+	changes := geth.CalculateTransactionVolume(receipt.Logs, root)
+	report := &Report{
+		TxHash:           tx.Hash().Hex(),
+		BlockNumber:      receipt.BlockNumber.Uint64(),
+		To:               tx.To(),
+		Status:           receipt.Status,
+		Flag:             geth.GetTxFlagForTx(receipt.Logs, tx),
+		MaxSwapVolumeUSD: geth.MaxSwapVolumeUSD(changes, tokens),
+		Trace:            root,
+		Transfers:        make([]*TransferRow, 0),
+		Changes:          make([]*ChangeRow, 0),
+	}
+	if from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+		report.From = from
+	}
+
+	for _, t := range tracker.GetTransfers() {
+		symbol, text := describeAmount(tokens, t.Token, t.Amount)
+		report.Transfers = append(report.Transfers, &TransferRow{
+			Seq:        t.Seq,
+			Source:     t.Source,
+			From:       t.From,
+			To:         t.To,
+			Token:      t.Token,
+			Symbol:     symbol,
+			Amount:     t.Amount.String(),
+			AmountText: text,
+		})
+	}
+
+	for account, change := range changes {
+		for token, amount := range change.Tokens {
+			if amount.Sign() == 0 {
+				continue
+			}
+			symbol, text := describeAmount(tokens, token, amount)
+			report.Changes = append(report.Changes, &ChangeRow{
+				Address:    account,
+				Token:      token,
+				Symbol:     symbol,
+				Amount:     amount.String(),
+				AmountText: text,
+			})
+		}
+	}
+	sort.Slice(report.Changes, func(i, j int) bool {
+		a, b := report.Changes[i], report.Changes[j]
+		if c := bytes.Compare(a.Address.Bytes(), b.Address.Bytes()); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(a.Token.Bytes(), b.Token.Bytes()) < 0
+	})
+	return report
+}
+
+// describeAmount 返回已知代币的符号和按精度格式化的数量，未知代币都为空
+func describeAmount(tokens map[common.Address]*geth.TokenPrice, token common.Address, amount *big.Int) (string, string) {
+	detail, ok := tokens[token]
+	if !ok {
+		return "", ""
+	}
+	v := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetFloat64(math.Pow10(detail.Decimal)))
+	return detail.Symbol, v.Text('f', -1)
+}
+
+func writeJSON(w io.Writer, report *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func writeTable(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	to := "(create)"
+	if report.To != nil {
+		to = report.To.Hex()
+	}
+	fmt.Fprintf(tw, "Tx:\t%s\n", report.TxHash)
+	fmt.Fprintf(tw, "Block:\t%d\n", report.BlockNumber)
+	fmt.Fprintf(tw, "From:\t%s\n", report.From.Hex())
+	fmt.Fprintf(tw, "To:\t%s\n", to)
+	fmt.Fprintf(tw, "Status:\t%d\n", report.Status)
+	fmt.Fprintf(tw, "Flag:\t%s\n", report.Flag)
+	fmt.Fprintf(tw, "Max swap volume:\t$%.2f\n", report.MaxSwapVolumeUSD)
+
+	fmt.Fprintln(tw, "\nCALL TREE")
+	fmt.Fprintln(tw, "TYPE\tFROM\tTO\tMETHOD\tVALUE\tGAS USED\tERROR")
+	writeCalls(tw, report.Trace, 0)
+
+	fmt.Fprintln(tw, "\nTRANSFERS")
+	fmt.Fprintln(tw, "SEQ\tSOURCE\tFROM\tTO\tTOKEN\tAMOUNT")
+	for _, t := range report.Transfers {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", t.Seq, t.Source, t.From.Hex(), t.To.Hex(), tokenName(t.Token, t.Symbol), amountText(t.Amount, t.AmountText))
+	}
+
+	fmt.Fprintln(tw, "\nNET CHANGES")
+	fmt.Fprintln(tw, "ADDRESS\tTOKEN\tAMOUNT")
+	for _, c := range report.Changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Address.Hex(), tokenName(c.Token, c.Symbol), amountText(c.Amount, c.AmountText))
+	}
+	return tw.Flush()
+}
+
+// writeCalls 按深度缩进输出调用树
+func writeCalls(w io.Writer, call *geth.TraceCall, depth int) {
+	if call == nil {
+		return
+	}
+	fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		strings.Repeat("  ", depth), call.Type, call.From, call.To, methodID(call.Input),
+		geth.HexToBigInt(call.Value), geth.HexToBigInt(call.GasUsed), call.Error)
+	for _, sub := range call.Calls {
+		writeCalls(w, sub, depth+1)
+	}
+}
+
+func methodID(input string) string {
+	if len(input) < 10 {
+		return ""
+	}
+	return input[:10]
+}
+
+func tokenName(token common.Address, symbol string) string {
+	if symbol != "" {
+		return symbol
+	}
+	return token.Hex()
+}
+
+func amountText(raw, text string) string {
+	if text != "" {
+		return text
+	}
+	return raw
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+func TestBuildReport(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	user := crypto.PubkeyToAddress(key.PublicKey)
+	router := common.HexToAddress("0x2222")
+	pool := common.HexToAddress("0x3333")
+
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(56)), &types.LegacyTx{
+		To:       &router,
+		Value:    big.NewInt(1e18),
+		Gas:      100000,
+		GasPrice: big.NewInt(1e9),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := &types.Receipt{
+		Status:      types.ReceiptStatusSuccessful,
+		BlockNumber: big.NewInt(100),
+		Logs: []*types.Log{{
+			Address: geth.USDT.Address,
+			Topics: []common.Hash{
+				common.HexToHash(geth.NewERC20Parser().TransferTopic),
+				common.BytesToHash(pool.Bytes()),
+				common.BytesToHash(user.Bytes()),
+			},
+			Data:   common.LeftPadBytes(new(big.Int).Mul(big.NewInt(600), big.NewInt(1e18)).Bytes(), 32),
+			TxHash: tx.Hash(),
+		}},
+	}
+	root := &geth.TraceCall{
+		Type:    "CALL",
+		From:    user.Hex(),
+		To:      router.Hex(),
+		Value:   "0xde0b6b3a7640000",
+		GasUsed: "0x5208",
+		Input:   "0x7ff36ab5",
+		Calls: []*geth.TraceCall{{
+			Type:  "CALL",
+			From:  router.Hex(),
+			To:    pool.Hex(),
+			Value: "0xde0b6b3a7640000",
+		}},
+	}
+
+	tokens := tokenDetails(600)
+	tracker := geth.NewTransferTrackerFromLogs(tx.Hash().Hex(), receipt.Logs, root)
+	report := buildReport(tx, receipt, root, tracker, tokens)
+
+	if report.From != user || report.BlockNumber != 100 || len(report.Transfers) != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.MaxSwapVolumeUSD < 599.99 || report.MaxSwapVolumeUSD > 600.01 {
+		t.Fatalf("unexpected max swap volume %v", report.MaxSwapVolumeUSD)
+	}
+	var userChanges []string
+	for _, c := range report.Changes {
+		if c.Address == user {
+			userChanges = append(userChanges, c.Symbol+" "+c.AmountText)
+		}
+	}
+	if strings.Join(userChanges, ",") != "BNB -1,USDT 600" && strings.Join(userChanges, ",") != "USDT 600,BNB -1" {
+		t.Fatalf("unexpected user changes %v", userChanges)
+	}
+
+	var table bytes.Buffer
+	if err := writeTable(&table, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"CALL TREE", "  CALL", "0x7ff36ab5", "TRANSFERS", "NET CHANGES", "$600.00"} {
+		if !strings.Contains(table.String(), want) {
+			t.Fatalf("table missing %q:\n%s", want, table.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeJSON(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded.Trace.Calls) != 1 || len(decoded.Changes) != len(report.Changes) {
+		t.Fatalf("unexpected json %s %v", out.String(), err)
+	}
+}
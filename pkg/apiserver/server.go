@@ -0,0 +1,403 @@
+package apiserver
+
+/**
+ * @Description: 以 JSON 接口提供 geth / solparser 的交易分析
+ **/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/lonelybeanz/tools/pkg/geth"
+	"github.com/lonelybeanz/tools/pkg/log"
+	"github.com/lonelybeanz/tools/pkg/solparser/parser"
+)
+
+var txHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+type options struct {
+	timeout       time.Duration
+	maxConcurrent int
+	cacheSize     int
+	cacheTTL      time.Duration
+	solanaRPC     string
+}
+
+type Option func(*options) error
+
+// WithTimeout 单个请求的处理超时，默认 30s
+func WithTimeout(timeout time.Duration) Option {
+	return func(opt *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive")
+		}
+		opt.timeout = timeout
+		return nil
+	}
+}
+
+// WithMaxConcurrent 同时处理的分析请求上限，默认 16；超出的请求排队直到超时
+func WithMaxConcurrent(n int) Option {
+	return func(opt *options) error {
+		if n <= 0 {
+			return fmt.Errorf("max concurrent must be positive")
+		}
+		opt.maxConcurrent = n
+		return nil
+	}
+}
+
+// WithCache 成功响应的缓存条数和有效期，默认 1024 条、10 分钟；size 为 0 时不缓存
+func WithCache(size int, ttl time.Duration) Option {
+	return func(opt *options) error {
+		if size < 0 {
+			return fmt.Errorf("cache size must not be negative")
+		}
+		opt.cacheSize = size
+		opt.cacheTTL = ttl
+		return nil
+	}
+}
+
+// WithSolanaRPC 启用 /v1/sol 接口使用的 Solana RPC 地址
+func WithSolanaRPC(rpcURL string) Option {
+	return func(opt *options) error {
+		opt.solanaRPC = rpcURL
+		return nil
+	}
+}
+
+// Server 分析服务，实现 http.Handler：
+//
+//	GET /v1/evm/trace?tx=0x...                    callTracer 调用树
+//	GET /v1/evm/balance-changes?tx=0x...          各地址的代币和原生代币余额变化（含手续费）
+//	GET /v1/evm/swap-volume?tx=0x...&bnb_price=   最大成交额（USD）
+//	GET /v1/evm/flag?tx=0x...                     交易标签
+//	GET /v1/sol/transfers?signature=...           Solana 交易的转账
+type Server struct {
+	rpcURL string
+	eth    *ethclient.Client
+	sol    *rpc.Client
+	opts   options
+	cache  *expirable.LRU[string, []byte]
+	sem    chan struct{}
+	mux    *http.ServeMux
+}
+
+// New 创建分析服务，rpcURL 为需要支持 debug_traceTransaction 的 EVM 节点，为空时不提供 /v1/evm 接口
+func New(rpcURL string, opts ...Option) (*Server, error) {
+	o := options{
+		timeout:       30 * time.Second,
+		maxConcurrent: 16,
+		cacheSize:     1024,
+		cacheTTL:      10 * time.Minute,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if rpcURL == "" && o.solanaRPC == "" {
+		return nil, fmt.Errorf("no EVM or Solana RPC configured")
+	}
+
+	s := &Server{
+		rpcURL: rpcURL,
+		opts:   o,
+		sem:    make(chan struct{}, o.maxConcurrent),
+		mux:    http.NewServeMux(),
+	}
+	if o.cacheSize > 0 {
+		s.cache = expirable.NewLRU[string, []byte](o.cacheSize, nil, o.cacheTTL)
+	}
+	if rpcURL != "" {
+		client, err := ethclient.Dial(rpcURL)
+		if err != nil {
+			return nil, err
+		}
+		s.eth = client
+		s.handle("/v1/evm/trace", s.trace)
+		s.handle("/v1/evm/balance-changes", s.balanceChanges)
+		s.handle("/v1/evm/swap-volume", s.swapVolume)
+		s.handle("/v1/evm/flag", s.txFlag)
+	}
+	if o.solanaRPC != "" {
+		s.sol = rpc.New(o.solanaRPC)
+		s.handle("/v1/sol/transfers", s.solTransfers)
+	}
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close 关闭 EVM 节点连接
+func (s *Server) Close() {
+	if s.eth != nil {
+		s.eth.Close()
+	}
+}
+
+// requestError 参数校验失败，返回 400
+type requestError struct {
+	msg string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &requestError{msg: fmt.Sprintf(format, args...)}
+}
+
+type handlerFunc func(ctx context.Context, query url.Values) (interface{}, error)
+
+type handlerResult struct {
+	body []byte
+	err  error
+}
+
+// handle 注册接口：先查缓存，再在并发上限和超时内执行分析。超时后立即返回 504，
+// 节点请求随 ctx 取消，分析结束后才释放并发名额，避免超时请求堆积压垮节点。
+func (s *Server) handle(path string, fn handlerFunc) {
+	s.mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		key := path + "?" + query.Encode()
+		if s.cache != nil {
+			if body, ok := s.cache.Get(key); ok {
+				w.Header().Set("X-Cache", "HIT")
+				writeBody(w, http.StatusOK, body)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.opts.timeout)
+		defer cancel()
+
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			writeError(w, http.StatusServiceUnavailable, errors.New("server busy"))
+			return
+		}
+
+		done := make(chan handlerResult, 1)
+		go func() {
+			defer func() { <-s.sem }()
+			v, err := fn(ctx, query)
+			if err != nil {
+				done <- handlerResult{err: err}
+				return
+			}
+			body, err := json.Marshal(v)
+			done <- handlerResult{body: body, err: err}
+		}()
+
+		select {
+		case res := <-done:
+			var reqErr *requestError
+			switch {
+			case errors.As(res.err, &reqErr):
+				writeError(w, http.StatusBadRequest, res.err)
+			case errors.Is(res.err, ethereum.NotFound):
+				writeError(w, http.StatusNotFound, res.err)
+			case res.err != nil:
+				log.Errorf("apiserver %s %s: %v", path, query.Encode(), res.err)
+				writeError(w, http.StatusBadGateway, res.err)
+			default:
+				if s.cache != nil {
+					s.cache.Add(key, res.body)
+				}
+				writeBody(w, http.StatusOK, res.body)
+			}
+		case <-ctx.Done():
+			writeError(w, http.StatusGatewayTimeout, ctx.Err())
+		}
+	})
+}
+
+func writeBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	body, _ := json.Marshal(map[string]string{"error": err.Error()})
+	writeBody(w, status, body)
+}
+
+func parseTxHash(query url.Values) (common.Hash, error) {
+	tx := query.Get("tx")
+	if !txHashPattern.MatchString(tx) {
+		return common.Hash{}, badRequest("tx must be a 0x-prefixed 32 byte hash")
+	}
+	return common.HexToHash(tx), nil
+}
+
+func parseSignature(query url.Values) (solana.Signature, error) {
+	sig, err := solana.SignatureFromBase58(query.Get("signature"))
+	if err != nil {
+		return solana.Signature{}, badRequest("invalid signature: %v", err)
+	}
+	return sig, nil
+}
+
+// parsePrice 可选的非负价格参数，缺省为 0
+func parsePrice(query url.Values, name string) (float64, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	price, err := strconv.ParseFloat(raw, 64)
+	if err != nil || price < 0 || math.IsInf(price, 0) || math.IsNaN(price) {
+		return 0, badRequest("%s must be a non-negative number", name)
+	}
+	return price, nil
+}
+
+// encodeChanges 数量以十进制字符串输出，避免非 Go 客户端解析大整数丢失精度
+func encodeChanges(changes map[common.Address]*geth.AssetChange) map[common.Address]map[common.Address]string {
+	out := make(map[common.Address]map[common.Address]string, len(changes))
+	for account, change := range changes {
+		tokens := make(map[common.Address]string, len(change.Tokens))
+		for token, amount := range change.Tokens {
+			if amount == nil || amount.Sign() == 0 {
+				continue
+			}
+			tokens[token] = amount.String()
+		}
+		if len(tokens) > 0 {
+			out[account] = tokens
+		}
+	}
+	return out
+}
+
+func (s *Server) trace(ctx context.Context, query url.Values) (interface{}, error) {
+	hash, err := parseTxHash(query)
+	if err != nil {
+		return nil, err
+	}
+	root, err := geth.TraceTransactionContext(ctx, s.rpcURL, hash.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("empty trace for %s", hash.Hex())
+	}
+	return map[string]interface{}{"tx_hash": hash, "trace": root}, nil
+}
+
+func (s *Server) balanceChanges(ctx context.Context, query url.Values) (interface{}, error) {
+	hash, err := parseTxHash(query)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := geth.GetTransactionReceipt(ctx, s.eth, hash)
+	if err != nil {
+		return nil, err
+	}
+	prestate, err := geth.TraceTransactionForChangeContext(ctx, s.rpcURL, "", hash.Hex())
+	if err != nil {
+		return nil, err
+	}
+	changes, _ := geth.CalculateTransactionTokenBalanceChanges(receipt.Logs, prestate)
+	return map[string]interface{}{"tx_hash": hash, "changes": encodeChanges(changes)}, nil
+}
+
+func (s *Server) swapVolume(ctx context.Context, query url.Values) (interface{}, error) {
+	hash, err := parseTxHash(query)
+	if err != nil {
+		return nil, err
+	}
+	bnbPrice, err := parsePrice(query, "bnb_price")
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := geth.GetTransactionReceipt(ctx, s.eth, hash)
+	if err != nil {
+		return nil, err
+	}
+	root, err := geth.TraceTransactionContext(ctx, s.rpcURL, hash.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("empty trace for %s", hash.Hex())
+	}
+
+	changes := geth.CalculateTransactionVolume(receipt.Logs, root)
+	return map[string]interface{}{
+		"tx_hash":             hash,
+		"changes":             encodeChanges(changes),
+		"max_swap_volume_usd": geth.MaxSwapVolumeUSD(changes, tokenPrices(bnbPrice)),
+	}, nil
+}
+
+func (s *Server) txFlag(ctx context.Context, query url.Values) (interface{}, error) {
+	hash, err := parseTxHash(query)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := geth.GetTransactionByHash(ctx, s.eth, hash)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := geth.GetTransactionReceipt(ctx, s.eth, hash)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"tx_hash": hash, "flag": geth.GetTxFlagForTx(receipt.Logs, tx)}, nil
+}
+
+func (s *Server) solTransfers(ctx context.Context, query url.Values) (interface{}, error) {
+	sig, err := parseSignature(query)
+	if err != nil {
+		return nil, err
+	}
+	version := uint64(0)
+	tx, err := s.sol.GetParsedTransaction(ctx, sig, &rpc.GetParsedTransactionOpts{
+		MaxSupportedTransactionVersion: &version,
+		Commitment:                     rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// SolParser 的账户缓存不是并发安全的，每个请求单独创建
+	transfers, err := parser.NewSolParser(s.sol, nil).ParseTransfer(tx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"signature": sig, "transfers": transfers}, nil
+}
+
+// tokenPrices 计算成交额使用的价格，稳定币按 1 计，BNB / WBNB 使用请求中的价格
+func tokenPrices(bnbPrice float64) map[common.Address]*geth.TokenPrice {
+	prices := make(map[common.Address]*geth.TokenPrice)
+	for _, t := range []geth.TokenPrice{geth.USDT, geth.USDC, geth.USD1} {
+		prices[t.Address] = &t
+	}
+	if bnbPrice > 0 {
+		for _, t := range []geth.TokenPrice{geth.BNB, geth.WBNB} {
+			prices[t.Address] = t.SetTokenPrice(bnbPrice)
+		}
+	}
+	return prices
+}
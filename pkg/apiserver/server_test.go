@@ -0,0 +1,203 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+// fakeNode 模拟 EVM 节点：一笔支付 1 BNB 换到 600 USDT 的交易
+type fakeNode struct {
+	tx       *types.Transaction
+	receipt  *types.Receipt
+	trace    *geth.TraceCall
+	delay    time.Duration // debug_ 方法的响应延迟
+	requests atomic.Int32
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	key, _ := crypto.GenerateKey()
+	user := crypto.PubkeyToAddress(key.PublicKey)
+	router := common.HexToAddress("0x2222")
+	pool := common.HexToAddress("0x3333")
+
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(56)), &types.LegacyTx{
+		To:       &router,
+		Value:    big.NewInt(1e18),
+		Gas:      100000,
+		GasPrice: big.NewInt(1e9),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount := new(big.Int).Mul(big.NewInt(600), big.NewInt(1e18))
+	receipt := &types.Receipt{
+		Type:        types.LegacyTxType,
+		Status:      types.ReceiptStatusSuccessful,
+		TxHash:      tx.Hash(),
+		BlockHash:   common.HexToHash("0x01"),
+		BlockNumber: big.NewInt(100),
+		Logs: []*types.Log{{
+			Address: geth.USDT.Address,
+			Topics: []common.Hash{
+				common.HexToHash(geth.NewERC20Parser().TransferTopic),
+				common.BytesToHash(pool.Bytes()),
+				common.BytesToHash(user.Bytes()),
+			},
+			Data:   common.LeftPadBytes(amount.Bytes(), 32),
+			TxHash: tx.Hash(),
+		}},
+	}
+	trace := &geth.TraceCall{
+		Type:  "CALL",
+		From:  user.Hex(),
+		To:    router.Hex(),
+		Value: "0xde0b6b3a7640000",
+		Calls: []*geth.TraceCall{{Type: "CALL", From: router.Hex(), To: pool.Hex(), Value: "0xde0b6b3a7640000"}},
+	}
+	return &fakeNode{tx: tx, receipt: receipt, trace: trace}
+}
+
+func (f *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests.Add(1)
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if strings.HasPrefix(req.Method, "debug_") {
+		time.Sleep(f.delay)
+	}
+
+	var hash common.Hash
+	json.Unmarshal(req.Params[0], &hash)
+	var result interface{}
+	if hash == f.tx.Hash() {
+		switch req.Method {
+		case "eth_getTransactionByHash":
+			result = f.tx
+		case "eth_getTransactionReceipt":
+			result = f.receipt
+		case "debug_traceTransaction":
+			result = f.trace
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func get(t *testing.T, s *Server, target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", rec.Body.String(), err)
+	}
+	return rec, body
+}
+
+func TestServer(t *testing.T) {
+	node := newFakeNode(t)
+	upstream := httptest.NewServer(node)
+	defer upstream.Close()
+
+	s, err := New(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	hash := node.tx.Hash().Hex()
+
+	rec, body := get(t, s, "/v1/evm/swap-volume?tx="+hash+"&bnb_price=600")
+	if rec.Code != http.StatusOK || body["max_swap_volume_usd"].(float64) < 599.99 || body["max_swap_volume_usd"].(float64) > 600.01 {
+		t.Fatalf("unexpected swap volume %d %v", rec.Code, body)
+	}
+
+	// 相同参数命中缓存，不再请求节点
+	requests := node.requests.Load()
+	rec, _ = get(t, s, "/v1/evm/swap-volume?bnb_price=600&tx="+hash)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "HIT" || node.requests.Load() != requests {
+		t.Fatalf("expected cache hit, code %d requests %d -> %d", rec.Code, requests, node.requests.Load())
+	}
+
+	rec, body = get(t, s, "/v1/evm/flag?tx="+hash)
+	if rec.Code != http.StatusOK || body["flag"] == nil {
+		t.Fatalf("unexpected flag %d %v", rec.Code, body)
+	}
+
+	rec, body = get(t, s, "/v1/evm/trace?tx="+hash)
+	if trace, _ := body["trace"].(map[string]interface{}); rec.Code != http.StatusOK || len(trace["calls"].([]interface{})) != 1 {
+		t.Fatalf("unexpected trace %d %v", rec.Code, body)
+	}
+
+	for _, target := range []string{
+		"/v1/evm/flag?tx=0x1234",
+		"/v1/evm/swap-volume?tx=" + hash + "&bnb_price=-1",
+	} {
+		if rec, body := get(t, s, target); rec.Code != http.StatusBadRequest || body["error"] == "" {
+			t.Fatalf("%s: expected 400, got %d %v", target, rec.Code, body)
+		}
+	}
+
+	rec, _ = get(t, s, "/v1/evm/flag?tx="+common.HexToHash("0xdead").Hex())
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown tx, got %d", rec.Code)
+	}
+
+	// Solana 接口未启用
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/sol/transfers?signature=abc", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without solana rpc, got %d", rec.Code)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	node := newFakeNode(t)
+	node.delay = 200 * time.Millisecond
+	upstream := httptest.NewServer(node)
+	defer upstream.Close()
+
+	s, err := New(upstream.URL, WithTimeout(50*time.Millisecond), WithMaxConcurrent(1), WithCache(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, target := range []string{"/v1/evm/trace", "/v1/evm/balance-changes", "/v1/evm/swap-volume"} {
+		rec, body := get(t, s, target+"?tx="+node.tx.Hash().Hex())
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("%s: expected 504, got %d %v", target, rec.Code, body)
+		}
+		// 超时会取消 trace 请求并释放唯一的并发名额，不用等节点返回
+		rec, body = get(t, s, "/v1/evm/flag?tx="+node.tx.Hash().Hex())
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected slot to be released after timeout, got %d %v", target, rec.Code, body)
+		}
+	}
+}
+
+func TestSolanaValidation(t *testing.T) {
+	s, err := New("", WithSolanaRPC("http://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, body := get(t, s, "/v1/sol/transfers?signature=not-base58")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d %v", rec.Code, body)
+	}
+
+	if _, err := New(""); err == nil {
+		t.Fatal("expected error without any rpc")
+	}
+}
@@ -0,0 +1,303 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+// 归档文件按区块分段，每段一个 gzip 压缩的 JSONL 文件，每行一个区块：
+//
+//	blocks-000040000000-000040000999.jsonl.gz
+//
+// 字段为 null 表示导出时没有包含该项数据，空数组表示区块内没有数据。
+
+var ErrNotArchived = errors.New("block not archived")
+
+// Record 一个区块的归档数据
+type Record struct {
+	Number     uint64                  `json:"number"`
+	Block      string                  `json:"block"` // RLP 编码的区块（hex）
+	Receipts   []*types.Receipt        `json:"receipts"`
+	CallTraces []geth.BlockTraceResult `json:"call_traces"`
+	Prestate   []geth.PrestateTxResult `json:"prestate"`
+}
+
+type ExportOptions struct {
+	BlocksPerFile uint64 // 每个文件的区块数，默认 1000，文件按该大小对齐
+	CallTrace     bool   // 导出 callTracer 结果
+	Prestate      bool   // 导出 prestateTracer（diffMode）结果
+}
+
+// Export 把 begin..end 的区块、回执以及可选的 trace 导出到 dir，返回写入的文件
+func Export(ctx context.Context, backend geth.ChainBackend, dir string, begin, end uint64, opts ExportOptions) ([]string, error) {
+	if begin > end {
+		return nil, fmt.Errorf("invalid block range %d..%d", begin, end)
+	}
+	if opts.BlocksPerFile == 0 {
+		opts.BlocksPerFile = 1000
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for from := begin; from <= end; {
+		to := (from/opts.BlocksPerFile+1)*opts.BlocksPerFile - 1
+		if to > end {
+			to = end
+		}
+		path, err := exportFile(ctx, backend, dir, from, to, opts)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, path)
+		from = to + 1
+	}
+	return files, nil
+}
+
+func exportFile(ctx context.Context, backend geth.ChainBackend, dir string, from, to uint64, opts ExportOptions) (string, error) {
+	path := filepath.Join(dir, fileName(from, to))
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(gz)
+	for n := from; n <= to; n++ {
+		if err := ctx.Err(); err != nil {
+			tmp.Close()
+			return "", err
+		}
+		record, err := fetchRecord(ctx, backend, n, opts)
+		if err != nil {
+			tmp.Close()
+			return "", fmt.Errorf("block %d: %w", n, err)
+		}
+		if err := enc.Encode(record); err != nil {
+			tmp.Close()
+			return "", err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+func fetchRecord(ctx context.Context, backend geth.ChainBackend, n uint64, opts ExportOptions) (*Record, error) {
+	block, err := backend.BlockByNumber(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	blockRLP, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := backend.BlockReceipts(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	record := &Record{
+		Number:   n,
+		Block:    hexutil.Encode(blockRLP),
+		Receipts: make([]*types.Receipt, 0, len(receipts)),
+	}
+	for _, receipt := range receipts {
+		// 回执的 JSON 解码要求 logs 字段存在
+		if receipt.Logs == nil {
+			r := *receipt
+			r.Logs = []*types.Log{}
+			receipt = &r
+		}
+		record.Receipts = append(record.Receipts, receipt)
+	}
+
+	if opts.CallTrace {
+		traces, err := backend.TraceBlock(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		record.CallTraces = append(make([]geth.BlockTraceResult, 0, len(traces)), traces...)
+	}
+	if opts.Prestate {
+		prestate, err := backend.TraceBlockForChange(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		record.Prestate = append(make([]geth.PrestateTxResult, 0, len(prestate)), prestate...)
+	}
+	return record, nil
+}
+
+func fileName(from, to uint64) string {
+	return fmt.Sprintf("blocks-%012d-%012d.jsonl.gz", from, to)
+}
+
+type fileRange struct {
+	from, to uint64
+	path     string
+}
+
+// Backend 从归档文件回放的 geth.ChainBackend，结果只取决于文件内容。
+// 最近读取的一个文件保留在内存中，按顺序处理区块时每个文件只解压一次。
+// 可以传给 geth.GetSearcherPnLFromBackend、geth.ReconcileWithBackend 离线回放分析。
+type Backend struct {
+	files []fileRange
+
+	mu     sync.Mutex
+	loaded *fileRange
+	blocks map[uint64]*Record
+}
+
+// Open 扫描 dir 下的归档文件
+func Open(dir string) (*Backend, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "blocks-*.jsonl.gz"))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]fileRange, 0, len(paths))
+	for _, path := range paths {
+		var from, to uint64
+		if _, err := fmt.Sscanf(filepath.Base(path), "blocks-%d-%d.jsonl.gz", &from, &to); err != nil {
+			continue
+		}
+		files = append(files, fileRange{from: from, to: to, path: path})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].from < files[j].from })
+	return &Backend{files: files}, nil
+}
+
+// Range 归档覆盖的最小和最大区块
+func (b *Backend) Range() (uint64, uint64, bool) {
+	if len(b.files) == 0 {
+		return 0, 0, false
+	}
+	last := b.files[0].to
+	for _, f := range b.files {
+		if f.to > last {
+			last = f.to
+		}
+	}
+	return b.files[0].from, last, true
+}
+
+// Record 返回区块的归档数据
+func (b *Backend) Record(blockNumber uint64) (*Record, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.loaded != nil && blockNumber >= b.loaded.from && blockNumber <= b.loaded.to {
+		if record, ok := b.blocks[blockNumber]; ok {
+			return record, nil
+		}
+	}
+	for i := range b.files {
+		f := &b.files[i]
+		if blockNumber < f.from || blockNumber > f.to {
+			continue
+		}
+		blocks, err := readFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		b.loaded, b.blocks = f, blocks
+		if record, ok := blocks[blockNumber]; ok {
+			return record, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNotArchived, blockNumber)
+}
+
+func readFile(path string) (map[uint64]*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	blocks := make(map[uint64]*Record)
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 256*1024*1024) // 单个区块的 trace 可能很大
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		blocks[record.Number] = &record
+	}
+	return blocks, scanner.Err()
+}
+
+func (b *Backend) BlockByNumber(ctx context.Context, blockNumber uint64) (*types.Block, error) {
+	record, err := b.Record(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hexutil.Decode(record.Block)
+	if err != nil {
+		return nil, err
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(data, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (b *Backend) BlockReceipts(ctx context.Context, blockNumber uint64) ([]*types.Receipt, error) {
+	record, err := b.Record(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if record.Receipts == nil {
+		return nil, fmt.Errorf("%w: receipts of %d", ErrNotArchived, blockNumber)
+	}
+	return record.Receipts, nil
+}
+
+func (b *Backend) TraceBlock(ctx context.Context, blockNumber uint64) ([]geth.BlockTraceResult, error) {
+	record, err := b.Record(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if record.CallTraces == nil {
+		return nil, fmt.Errorf("%w: call traces of %d", ErrNotArchived, blockNumber)
+	}
+	return record.CallTraces, nil
+}
+
+func (b *Backend) TraceBlockForChange(ctx context.Context, blockNumber uint64) ([]geth.PrestateTxResult, error) {
+	record, err := b.Record(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if record.Prestate == nil {
+		return nil, fmt.Errorf("%w: prestate of %d", ErrNotArchived, blockNumber)
+	}
+	return record.Prestate, nil
+}
@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+type memoryBackend struct {
+	blocks map[uint64]*types.Block
+}
+
+func (m *memoryBackend) BlockByNumber(ctx context.Context, n uint64) (*types.Block, error) {
+	return m.blocks[n], nil
+}
+
+func (m *memoryBackend) BlockReceipts(ctx context.Context, n uint64) ([]*types.Receipt, error) {
+	receipts := make([]*types.Receipt, 0)
+	for i, tx := range m.blocks[n].Transactions() {
+		receipts = append(receipts, &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: 21000 * uint64(i+1),
+			GasUsed:           21000,
+			TxHash:            tx.Hash(),
+			BlockNumber:       new(big.Int).SetUint64(n),
+			EffectiveGasPrice: big.NewInt(1e9),
+		})
+	}
+	return receipts, nil
+}
+
+func (m *memoryBackend) TraceBlock(ctx context.Context, n uint64) ([]geth.BlockTraceResult, error) {
+	results := make([]geth.BlockTraceResult, 0)
+	for _, tx := range m.blocks[n].Transactions() {
+		var r geth.BlockTraceResult
+		r.TxHash = tx.Hash().Hex()
+		r.Result.To = tx.To().Hex()
+		r.Result.Value = "0x1"
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func (m *memoryBackend) TraceBlockForChange(ctx context.Context, n uint64) ([]geth.PrestateTxResult, error) {
+	return nil, errors.New("prestate not supported")
+}
+
+func newMemoryBackend(from, to uint64) *memoryBackend {
+	m := &memoryBackend{blocks: make(map[uint64]*types.Block)}
+	recipient := common.HexToAddress("0x01")
+	for n := from; n <= to; n++ {
+		txs := make([]*types.Transaction, 0)
+		for i := uint64(0); i < n%3; i++ {
+			txs = append(txs, types.NewTx(&types.LegacyTx{Nonce: n*10 + i, To: &recipient, Value: big.NewInt(1), Gas: 21000, GasPrice: big.NewInt(1e9)}))
+		}
+		header := &types.Header{Number: new(big.Int).SetUint64(n), Time: n * 3, Difficulty: big.NewInt(2)}
+		m.blocks[n] = types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs})
+	}
+	return m
+}
+
+func TestExportAndReplay(t *testing.T) {
+	ctx := context.Background()
+	source := newMemoryBackend(995, 1012)
+	dir := t.TempDir()
+
+	files, err := Export(ctx, source, dir, 995, 1012, ExportOptions{BlocksPerFile: 10, CallTrace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("want 3 files, got %v", files)
+	}
+
+	// 相同输入导出的文件字节一致
+	again := t.TempDir()
+	if _, err := Export(ctx, source, again, 995, 1012, ExportOptions{BlocksPerFile: 10, CallTrace: true}); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := os.ReadFile(files[1])
+	second, _ := os.ReadFile(again + "/" + fileName(1000, 1009))
+	if !bytes.Equal(first, second) {
+		t.Fatal("export is not deterministic")
+	}
+
+	backend, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ geth.ChainBackend = backend
+	if from, to, ok := backend.Range(); !ok || from != 995 || to != 1012 {
+		t.Fatalf("unexpected range %d..%d", from, to)
+	}
+
+	for n := uint64(995); n <= 1012; n++ {
+		block, err := backend.BlockByNumber(ctx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Hash() != source.blocks[n].Hash() || len(block.Transactions()) != int(n%3) {
+			t.Fatalf("block %d mismatch", n)
+		}
+		receipts, err := backend.BlockReceipts(ctx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		traces, err := backend.TraceBlock(ctx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(receipts) != int(n%3) || len(traces) != int(n%3) {
+			t.Fatalf("block %d: %d receipts %d traces", n, len(receipts), len(traces))
+		}
+		for i, receipt := range receipts {
+			if receipt.TxHash != block.Transactions()[i].Hash() || traces[i].TxHash != receipt.TxHash.Hex() {
+				t.Fatalf("block %d tx %d mismatch", n, i)
+			}
+		}
+	}
+
+	if _, err := backend.TraceBlockForChange(ctx, 1000); !errors.Is(err, ErrNotArchived) {
+		t.Fatalf("expected ErrNotArchived for prestate, got %v", err)
+	}
+	if _, err := backend.BlockByNumber(ctx, 2000); !errors.Is(err, ErrNotArchived) {
+		t.Fatalf("expected ErrNotArchived, got %v", err)
+	}
+}
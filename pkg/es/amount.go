@@ -0,0 +1,177 @@
+package es
+
+import (
+	"math"
+	"math/big"
+)
+
+// 代币数量超出 long 范围，索引中拆成两个 long 存储：
+//
+//	amount = amount_hi * 2^63 + amount_lo，0 <= amount_lo < 2^63
+//
+// amount_hi 向下取整，负数同样适用，因此按 (amount_hi, amount_lo) 排序与按数值排序一致。
+// 可以精确表示 [-2^126, 2^126) 内的整数。超出范围的数值（例如 MaxUint256 授权）会饱和到边界并标记 amount_overflow，
+// 原值仍保存在 amount_raw 中：范围查询把它们当作正负无穷处理，精确查询改用 amount_raw，排序时与边界值并列。
+
+var (
+	amountBase = new(big.Int).Lsh(big.NewInt(1), 63)
+	amountMax  = new(big.Int).Lsh(big.NewInt(1), 126) // 不含
+	amountMin  = new(big.Int).Neg(amountMax)
+)
+
+// AmountOverflow 数量是否超出 hi/lo 可精确表示的范围
+func AmountOverflow(v *big.Int) bool {
+	return v != nil && (v.Cmp(amountMax) >= 0 || v.Cmp(amountMin) < 0)
+}
+
+// EncodeAmount 把数量拆分为 hi/lo，超出范围时饱和到边界
+func EncodeAmount(v *big.Int) (hi, lo int64) {
+	if v == nil {
+		return 0, 0
+	}
+	if v.Cmp(amountMax) >= 0 {
+		return math.MaxInt64, math.MaxInt64
+	}
+	if v.Cmp(amountMin) < 0 {
+		return math.MinInt64, 0
+	}
+	h, l := new(big.Int).DivMod(v, amountBase, new(big.Int)) // 欧几里得除法，l 总是非负
+	return h.Int64(), l.Int64()
+}
+
+// DecodeAmount EncodeAmount 的逆运算
+func DecodeAmount(hi, lo int64) *big.Int {
+	v := new(big.Int).Mul(big.NewInt(hi), amountBase)
+	return v.Add(v, big.NewInt(lo))
+}
+
+// AmountDoc 文档中的数量字段，字段名与 bsc_financial 模板一致
+func AmountDoc(field string, v *big.Int) map[string]interface{} {
+	hi, lo := EncodeAmount(v)
+	doc := map[string]interface{}{
+		field + "_hi":       hi,
+		field + "_lo":       lo,
+		field + "_overflow": AmountOverflow(v),
+	}
+	if v != nil {
+		doc[field+"_raw"] = v.String()
+	}
+	return doc
+}
+
+// AmountRange 数量范围，nil 表示不限制
+type AmountRange struct {
+	Gt  *big.Int
+	Gte *big.Int
+	Lt  *big.Int
+	Lte *big.Int
+}
+
+// AmountRangeQuery 把数量范围转换为 amount_hi/amount_lo 上的 bool 查询，field 为字段前缀，例如 "amount"。
+// 标记了 _overflow 的数量按正负无穷比较：下界超出最大值时只匹配正溢出，任何有限上界都不匹配正溢出，负数同理
+func AmountRangeQuery(field string, r AmountRange) map[string]interface{} {
+	hiField, loField := field+"_hi", field+"_lo"
+	filters := make([]interface{}, 0, 2)
+	mustNot := make([]interface{}, 0, 2)
+	positiveOverflow := boolFilter(termClause(field+"_overflow", true), termClause(hiField, int64(math.MaxInt64)))
+	negativeOverflow := boolFilter(termClause(field+"_overflow", true), termClause(hiField, int64(math.MinInt64)))
+
+	// 整数范围：> v 等价于 >= v+1，< v 等价于 <= v-1
+	lower := r.Gte
+	if r.Gt != nil {
+		lower = new(big.Int).Add(r.Gt, big.NewInt(1))
+	}
+	upper := r.Lte
+	if r.Lt != nil {
+		upper = new(big.Int).Sub(r.Lt, big.NewInt(1))
+	}
+
+	// v >= (h, l)：hi > h，或者 hi == h 且 lo >= l
+	if lower != nil && lower.Cmp(amountMax) >= 0 {
+		// 下界超出可表示的最大值，只有正溢出的数量可能满足
+		filters = append(filters, positiveOverflow)
+	} else if lower != nil {
+		h, l := EncodeAmount(lower)
+		filters = append(filters, boolShould(
+			rangeClause(hiField, "gt", h),
+			boolFilter(termClause(hiField, h), rangeClause(loField, "gte", l)),
+		))
+		// 负溢出饱和到 -2^126，下界不大于该值时需要单独排除
+		if lower.Cmp(amountMin) <= 0 {
+			mustNot = append(mustNot, negativeOverflow)
+		}
+	}
+	// v <= (h, l)：hi < h，或者 hi == h 且 lo <= l
+	if upper != nil && upper.Cmp(amountMin) < 0 {
+		// 上界小于可表示的最小值，只有负溢出的数量可能满足
+		filters = append(filters, negativeOverflow)
+	} else if upper != nil {
+		h, l := EncodeAmount(upper)
+		filters = append(filters, boolShould(
+			rangeClause(hiField, "lt", h),
+			boolFilter(termClause(hiField, h), rangeClause(loField, "lte", l)),
+		))
+		// 正溢出饱和到 2^126-1，上界不小于该值时需要单独排除
+		if upper.Cmp(new(big.Int).Sub(amountMax, big.NewInt(1))) >= 0 {
+			mustNot = append(mustNot, positiveOverflow)
+		}
+	}
+
+	query := map[string]interface{}{"filter": filters}
+	if len(mustNot) > 0 {
+		query["must_not"] = mustNot
+	}
+	return map[string]interface{}{"bool": query}
+}
+
+// AmountTermQuery 精确匹配数量，超出范围的数量按 _raw 匹配
+func AmountTermQuery(field string, v *big.Int) map[string]interface{} {
+	if AmountOverflow(v) {
+		return boolFilter(termClause(field+"_raw", v.String()))
+	}
+	h, l := EncodeAmount(v)
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter":   []interface{}{termClause(field+"_hi", h), termClause(field+"_lo", l)},
+			"must_not": []interface{}{termClause(field+"_overflow", true)},
+		},
+	}
+}
+
+// AmountSort 按数量排序，order 为 "asc" 或 "desc"，可直接放入 StreamRequest.Sort。
+// 超出范围的数量与边界值并列，彼此之间的顺序不确定
+func AmountSort(field, order string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{field + "_hi": map[string]interface{}{"order": order}},
+		{field + "_lo": map[string]interface{}{"order": order}},
+	}
+}
+
+func rangeClause(field, op string, v int64) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			field: map[string]interface{}{op: v},
+		},
+	}
+}
+
+func termClause(field string, v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"term": map[string]interface{}{field: v},
+	}
+}
+
+func boolFilter(clauses ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"filter": clauses},
+	}
+}
+
+func boolShould(clauses ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               clauses,
+			"minimum_should_match": 1,
+		},
+	}
+}
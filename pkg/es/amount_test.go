@@ -0,0 +1,175 @@
+package es
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"testing"
+)
+
+func testAmounts() []*big.Int {
+	base := new(big.Int).Lsh(big.NewInt(1), 63)
+	values := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(-1),
+		big.NewInt(math.MaxInt64),
+		new(big.Int).Set(base),
+		new(big.Int).Add(base, big.NewInt(1)),
+		new(big.Int).Neg(base),
+		new(big.Int).Mul(big.NewInt(1_000_000), new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)),
+		new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 126), big.NewInt(1)),
+		new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 126)),
+	}
+	return values
+}
+
+func TestEncodeAmount(t *testing.T) {
+	values := testAmounts()
+	for _, v := range values {
+		hi, lo := EncodeAmount(v)
+		if lo < 0 {
+			t.Fatalf("%s: negative lo %d", v, lo)
+		}
+		if got := DecodeAmount(hi, lo); got.Cmp(v) != 0 {
+			t.Fatalf("round trip %s: got %s", v, got)
+		}
+	}
+
+	// (hi, lo) 的字典序与数值顺序一致
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	for i := 1; i < len(values); i++ {
+		h1, l1 := EncodeAmount(values[i-1])
+		h2, l2 := EncodeAmount(values[i])
+		if h1 > h2 || (h1 == h2 && l1 >= l2) {
+			t.Fatalf("order broken between %s and %s", values[i-1], values[i])
+		}
+	}
+
+	if hi, lo := EncodeAmount(new(big.Int).Lsh(big.NewInt(1), 200)); hi != math.MaxInt64 || lo != math.MaxInt64 {
+		t.Fatalf("expected saturation, got %d %d", hi, lo)
+	}
+}
+
+// overflowAmounts 超出可精确表示范围的数量
+func overflowAmounts() []*big.Int {
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	return []*big.Int{
+		new(big.Int).Lsh(big.NewInt(1), 126),
+		new(big.Int).Lsh(big.NewInt(1), 127),
+		maxUint256,
+		new(big.Int).Sub(new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 126)), big.NewInt(1)),
+		new(big.Int).Neg(maxUint256),
+	}
+}
+
+// amountDoc AmountDoc 生成的文档字段
+func amountDoc(v *big.Int) map[string]interface{} {
+	return AmountDoc("amount", v)
+}
+
+// matchQuery 在内存中执行 AmountRangeQuery 生成的 bool/range/term 查询
+func matchQuery(query map[string]interface{}, doc map[string]interface{}) bool {
+	for kind, body := range query {
+		switch kind {
+		case "bool":
+			b := body.(map[string]interface{})
+			if filters, ok := b["filter"].([]interface{}); ok {
+				for _, f := range filters {
+					if !matchQuery(f.(map[string]interface{}), doc) {
+						return false
+					}
+				}
+			}
+			if mustNot, ok := b["must_not"].([]interface{}); ok {
+				for _, f := range mustNot {
+					if matchQuery(f.(map[string]interface{}), doc) {
+						return false
+					}
+				}
+			}
+			if should, ok := b["should"].([]interface{}); ok {
+				matched := false
+				for _, s := range should {
+					matched = matched || matchQuery(s.(map[string]interface{}), doc)
+				}
+				if !matched {
+					return false
+				}
+			}
+		case "match_none":
+			return false
+		case "term":
+			for field, v := range body.(map[string]interface{}) {
+				if doc[field] != v {
+					return false
+				}
+			}
+		case "range":
+			for field, ops := range body.(map[string]interface{}) {
+				for op, v := range ops.(map[string]interface{}) {
+					x, y := doc[field].(int64), v.(int64)
+					ok := map[string]bool{"gt": x > y, "gte": x >= y, "lt": x < y, "lte": x <= y}[op]
+					if !ok {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+// compareAmount 超出范围的数量按正负无穷比较
+func compareAmount(v, bound *big.Int) int {
+	if AmountOverflow(v) {
+		return v.Sign()
+	}
+	return v.Cmp(bound)
+}
+
+func TestAmountRangeQuery(t *testing.T) {
+	values := append(testAmounts(), overflowAmounts()...)
+	for _, low := range values {
+		for _, high := range values {
+			ranges := []AmountRange{{Gte: low, Lte: high}, {Gt: low, Lt: high}, {Gte: low}, {Gt: low}, {Lt: high}, {Lte: high}}
+			for _, r := range ranges {
+				query := AmountRangeQuery("amount", r)
+				for _, v := range values {
+					want := (r.Gte == nil || compareAmount(v, r.Gte) >= 0) && (r.Gt == nil || compareAmount(v, r.Gt) > 0) &&
+						(r.Lte == nil || compareAmount(v, r.Lte) <= 0) && (r.Lt == nil || compareAmount(v, r.Lt) < 0)
+					if got := matchQuery(query, amountDoc(v)); got != want {
+						t.Fatalf("range %+v value %s: want %v, got %v", r, v, want, got)
+					}
+				}
+			}
+		}
+		for _, v := range values {
+			if got := matchQuery(AmountTermQuery("amount", low), amountDoc(v)); got != (v.Cmp(low) == 0) {
+				t.Fatalf("term query %s on %s: got %v", low, v, got)
+			}
+		}
+	}
+}
+
+func TestAmountOverflow(t *testing.T) {
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 126), big.NewInt(1))
+	if doc := amountDoc(max); doc["amount_overflow"] != false {
+		t.Fatalf("2^126-1 should be exact: %v", doc)
+	}
+	for _, v := range overflowAmounts() {
+		doc := amountDoc(v)
+		if doc["amount_overflow"] != true || doc["amount_raw"] != v.String() {
+			t.Fatalf("%s should be flagged as overflow: %v", v, doc)
+		}
+	}
+
+	// 上界不小于 2^126-1 时饱和的正溢出不能被当作边界值匹配
+	query := AmountRangeQuery("amount", AmountRange{Lte: new(big.Int).Lsh(big.NewInt(1), 127)})
+	if matchQuery(query, amountDoc(overflowAmounts()[2])) {
+		t.Fatal("MaxUint256 should not match a finite upper bound")
+	}
+	if !matchQuery(query, amountDoc(max)) {
+		t.Fatal("2^126-1 should match upper bound 2^127")
+	}
+}
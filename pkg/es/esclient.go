@@ -14,6 +14,10 @@ import (
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/lonelybeanz/tools/pkg/metrics"
+	"github.com/lonelybeanz/tools/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -83,7 +87,14 @@ func SafeClose(res *esapi.Response) {
 	}
 }
 
-func DoESRequest(ctx context.Context, req func(ctx context.Context, client *elasticsearch.Client) (*esapi.Response, error)) ([]byte, error) {
+func DoESRequest(ctx context.Context, req func(ctx context.Context, client *elasticsearch.Client) (*esapi.Response, error)) (body []byte, err error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "es.request")
+	defer func() {
+		metrics.ObserveES(start, err)
+		tracing.End(span, err)
+	}()
+
 	esMutex.RLock()
 	if EsClient == nil {
 		esMutex.RUnlock()
@@ -107,6 +118,8 @@ func DoESRequest(ctx context.Context, req func(ctx context.Context, client *elas
 			// 检查是否是网络错误（包括超时）
 			if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
 				esLogger.Errorf("⚠️ es request network error, retrying... (%d/3): %v", i+1, err)
+				metrics.IncESRetry("network")
+				span.AddEvent("retry", trace.WithAttributes(attribute.String("reason", "network"), attribute.Int("attempt", i+1)))
 				lastErr = err
 				time.Sleep(time.Duration(i+1) * time.Second) // 增加重试等待时间
 				continue
@@ -114,6 +127,8 @@ func DoESRequest(ctx context.Context, req func(ctx context.Context, client *elas
 			// 检查是否是EOF错误
 			if errors.Is(err, io.EOF) {
 				esLogger.Errorf("⚠️ es request EOF error, retrying... (%d/3): %v", i+1, err)
+				metrics.IncESRetry("eof")
+				span.AddEvent("retry", trace.WithAttributes(attribute.String("reason", "eof"), attribute.Int("attempt", i+1)))
 				lastErr = err
 				time.Sleep(time.Duration(i+1) * time.Second)
 				continue
@@ -129,6 +144,8 @@ func DoESRequest(ctx context.Context, req func(ctx context.Context, client *elas
 		if readErr != nil {
 			// 读取响应体失败，也认为是一种可重试的网络问题
 			esLogger.Errorf("es response read failed, retrying... (%d/3): %v", i+1, readErr)
+			metrics.IncESRetry("read")
+			span.AddEvent("retry", trace.WithAttributes(attribute.String("reason", "read"), attribute.Int("attempt", i+1)))
 			lastErr = readErr
 			time.Sleep(time.Duration(i+1) * time.Second)
 			continue
@@ -138,6 +155,8 @@ func DoESRequest(ctx context.Context, req func(ctx context.Context, client *elas
 			// 对于 5xx 系列的服务器错误，进行重试
 			if res.StatusCode >= 500 && res.StatusCode < 600 {
 				esLogger.Errorf("es response server error with status code %d, retrying... (%d/3). Body: %s", res.StatusCode, i+1, string(bodyBytes))
+				metrics.IncESRetry("5xx")
+				span.AddEvent("retry", trace.WithAttributes(attribute.String("reason", "5xx"), attribute.Int("attempt", i+1)))
 				lastErr = fmt.Errorf("es response error with status code %d: %s", res.StatusCode, string(bodyBytes))
 				time.Sleep(time.Duration(i+1) * time.Second)
 				continue
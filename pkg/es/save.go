@@ -9,6 +9,9 @@ import (
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/lonelybeanz/tools/pkg/metrics"
+	"github.com/lonelybeanz/tools/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ESBulkResponse struct {
@@ -23,13 +26,18 @@ type ESBulkResponse struct {
 }
 
 func SaveAndRetry(indexName string, buffer bytes.Buffer) error {
-	return saveAndRetryWithLimit(indexName, buffer, 5) // 默认最大重试5次
+	return SaveAndRetryContext(context.Background(), indexName, buffer)
+}
+
+// SaveAndRetryContext 与 SaveAndRetry 相同，写入的 span 挂在 ctx 的链路下，例如 pcm 消息处理时传入的 ctx
+func SaveAndRetryContext(ctx context.Context, indexName string, buffer bytes.Buffer) error {
+	return saveAndRetryWithLimit(ctx, indexName, buffer, 5) // 默认最大重试5次
 }
 
 // 带重试次数限制的内部函数
-func saveAndRetryWithLimit(indexName string, buffer bytes.Buffer, retriesLeft int) error {
+func saveAndRetryWithLimit(ctx context.Context, indexName string, buffer bytes.Buffer, retriesLeft int) error {
 	timeOut := time.Duration(60-retriesLeft*10) * time.Second
-	err := SaveToEs(indexName, buffer, timeOut)
+	err := SaveToEsContext(ctx, indexName, buffer, timeOut)
 	if err != nil {
 		if err == ErrVersionConflict {
 			esLogger.Error("版本冲突,请检查数据是否已存在")
@@ -44,18 +52,25 @@ func saveAndRetryWithLimit(indexName string, buffer bytes.Buffer, retriesLeft in
 		}
 
 		// 递归调用，减少重试次数
-		return saveAndRetryWithLimit(indexName, buffer, retriesLeft-1)
+		return saveAndRetryWithLimit(ctx, indexName, buffer, retriesLeft-1)
 	}
 	return nil
 }
 
 func SaveToEs(indexName string, buffer bytes.Buffer, timeOut time.Duration) error {
+	return SaveToEsContext(context.Background(), indexName, buffer, timeOut)
+}
+
+// SaveToEsContext 与 SaveToEs 相同，超时在 ctx 的基础上设置，bulk 写入记录为 ctx 链路下的 span
+func SaveToEsContext(ctx context.Context, indexName string, buffer bytes.Buffer, timeOut time.Duration) (err error) {
+	ctx, span := tracing.Start(ctx, "es.bulk", attribute.String("es.index", indexName), attribute.Int("es.bytes", buffer.Len()))
+	defer func() { tracing.End(span, err) }()
 
 	// 打印完整的POST语句供后续补偿
 	WriteMsgLog(buffer.String())
 
 	// 设置最大超时时间
-	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
 	defer cancel()
 	bodyBytes, err := DoESRequest(ctx, func(ctx context.Context, client *elasticsearch.Client) (*esapi.Response, error) {
 		return client.Bulk(
@@ -75,7 +90,9 @@ func SaveToEs(indexName string, buffer bytes.Buffer, timeOut time.Duration) erro
 		return fmt.Errorf("saveToEs failed: %v", err)
 	}
 
+	span.SetAttributes(attribute.Int("es.items", len(esResp.Items)))
 	if esResp.Errors {
+		recordBulkFailures(indexName, &esResp)
 		for _, item := range esResp.Items {
 			for _, result := range item {
 				if result.Status == 409 && result.Error.Type == "version_conflict_engine_exception" {
@@ -89,3 +106,21 @@ func SaveToEs(indexName string, buffer bytes.Buffer, timeOut time.Duration) erro
 	}
 
 }
+
+// recordBulkFailures 按错误类型统计 bulk 响应中失败的条目
+func recordBulkFailures(indexName string, esResp *ESBulkResponse) {
+	if !metrics.Enabled() {
+		return
+	}
+	failures := make(map[string]int)
+	for _, item := range esResp.Items {
+		for _, result := range item {
+			if result.Status >= 300 {
+				failures[result.Error.Type]++
+			}
+		}
+	}
+	for errType, n := range failures {
+		metrics.AddESBulkFailures(indexName, errType, n)
+	}
+}
@@ -0,0 +1,270 @@
+package geth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// AddressRole 地址角色，对应 ES 财务模板中的 from_role / to_role
+type AddressRole string
+
+const (
+	RoleUnknown  AddressRole = ""
+	RoleEOA      AddressRole = "eoa"
+	RoleContract AddressRole = "contract"
+	RoleDexPool  AddressRole = "dex_pool"
+	RoleRouter   AddressRole = "router"
+	RoleBot      AddressRole = "bot"
+	RoleCEX      AddressRole = "cex"
+	RoleOwn      AddressRole = "own"
+)
+
+var (
+	// knownRouters 常用聚合器/路由合约，优先于 memeBot 列表
+	knownRouters = map[common.Address]string{
+		common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E"): "PancakeSwap V2 Router",
+		common.HexToAddress("0x13f4EA83D0bd40E75C8222255bc855a974568Dd4"): "PancakeSwap Smart Router",
+		common.HexToAddress("0x1b81D678ffb9C0263b24A97847620C99d213eB14"): "PancakeSwap V3 Router",
+		common.HexToAddress("0x1A0A18AC4BECDDbd6389559687d1A73d8927E416"): "PancakeSwap Universal Router",
+		common.HexToAddress("0x111111125421cA6dc452d289314280a0f8842A65"): "1inch Router V6",
+	}
+
+	token0Selector = common.FromHex("0x0dfe1681") // token0()
+	token1Selector = common.FromHex("0xd21220a7") // token1()
+)
+
+const (
+	defaultLabelCacheSize = 100000
+	defaultLabelCacheTTL  = time.Hour
+)
+
+// AddressLabel 地址标签
+type AddressLabel struct {
+	Address common.Address `json:"address"`
+	Role    AddressRole    `json:"role"`
+	Name    string         `json:"name,omitempty"`
+	// Delegate EOA 通过 EIP-7702 委托的代码地址
+	Delegate *common.Address `json:"delegate,omitempty"`
+}
+
+// chainReader 打标签需要的链上查询，*ethclient.Client 满足该接口
+type chainReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+type labelerOptions struct {
+	cacheSize int
+	cacheTTL  time.Duration
+	labels    map[common.Address]*AddressLabel
+}
+
+type LabelerOption func(*labelerOptions) error
+
+// WithOwnAddresses 标记自己的钱包
+func WithOwnAddresses(addresses ...common.Address) LabelerOption {
+	return func(opt *labelerOptions) error {
+		for _, addr := range addresses {
+			opt.labels[addr] = &AddressLabel{Address: addr, Role: RoleOwn}
+		}
+		return nil
+	}
+}
+
+// WithLabels 手动指定标签，优先于链上探测
+func WithLabels(labels ...*AddressLabel) LabelerOption {
+	return func(opt *labelerOptions) error {
+		for _, label := range labels {
+			opt.labels[label.Address] = label
+		}
+		return nil
+	}
+}
+
+// WithLabelsFile 从 JSON 文件加载标签，格式为 [{"address":"0x..","role":"cex","name":"Binance Hot Wallet"}]
+func WithLabelsFile(path string) LabelerOption {
+	return func(opt *labelerOptions) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var labels []*AddressLabel
+		if err := json.Unmarshal(data, &labels); err != nil {
+			return err
+		}
+		for _, label := range labels {
+			label.Role = AddressRole(strings.ToLower(string(label.Role)))
+			opt.labels[label.Address] = label
+		}
+		return nil
+	}
+}
+
+// WithLabelCache 设置缓存大小和过期时间
+func WithLabelCache(size int, ttl time.Duration) LabelerOption {
+	return func(opt *labelerOptions) error {
+		opt.cacheSize = size
+		opt.cacheTTL = ttl
+		return nil
+	}
+}
+
+// AddressLabeler 地址角色分类：
+// 自己的钱包 / 标签文件 > 已知路由 > memeBot 列表 > 链上探测（EOA、DEX 池子、普通合约）。
+// 链上探测的结果会缓存，同一个区块里重复出现的地址只查询一次。
+type AddressLabeler struct {
+	client chainReader
+	labels map[common.Address]*AddressLabel
+	bots   map[common.Address]bool
+	cache  *expirable.LRU[common.Address, *AddressLabel]
+}
+
+func NewAddressLabeler(client *ethclient.Client, opts ...LabelerOption) (*AddressLabeler, error) {
+	options := labelerOptions{
+		cacheSize: defaultLabelCacheSize,
+		cacheTTL:  defaultLabelCacheTTL,
+		labels:    make(map[common.Address]*AddressLabel),
+	}
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, err
+		}
+	}
+
+	bots := make(map[common.Address]bool, len(memeBot))
+	for _, addr := range memeBot {
+		bots[common.HexToAddress(addr)] = true
+	}
+
+	return &AddressLabeler{
+		client: client,
+		labels: options.labels,
+		bots:   bots,
+		cache:  expirable.NewLRU[common.Address, *AddressLabel](options.cacheSize, nil, options.cacheTTL),
+	}, nil
+}
+
+// Label 返回地址标签，查询链上失败时返回错误且不缓存
+func (l *AddressLabeler) Label(ctx context.Context, address common.Address) (*AddressLabel, error) {
+	if label, ok := l.staticLabel(address); ok {
+		return label, nil
+	}
+	if label, ok := l.cache.Get(address); ok {
+		return label, nil
+	}
+
+	label, err := l.probe(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	l.cache.Add(address, label)
+	return label, nil
+}
+
+// Role 返回地址角色，出错时返回 RoleUnknown
+func (l *AddressLabeler) Role(ctx context.Context, address common.Address) AddressRole {
+	label, err := l.Label(ctx, address)
+	if err != nil {
+		return RoleUnknown
+	}
+	return label.Role
+}
+
+// LabelAll 批量打标签，重复地址只查询一次
+func (l *AddressLabeler) LabelAll(ctx context.Context, addresses []common.Address) (map[common.Address]*AddressLabel, error) {
+	labels := make(map[common.Address]*AddressLabel, len(addresses))
+	for _, addr := range addresses {
+		if _, ok := labels[addr]; ok {
+			continue
+		}
+		label, err := l.Label(ctx, addr)
+		if err != nil {
+			return labels, err
+		}
+		labels[addr] = label
+	}
+	return labels, nil
+}
+
+func (l *AddressLabeler) staticLabel(address common.Address) (*AddressLabel, bool) {
+	if label, ok := l.labels[address]; ok {
+		return label, true
+	}
+	if name, ok := knownRouters[address]; ok {
+		return &AddressLabel{Address: address, Role: RoleRouter, Name: name}, true
+	}
+	if l.bots[address] {
+		return &AddressLabel{Address: address, Role: RoleBot}, true
+	}
+	return nil, false
+}
+
+func (l *AddressLabeler) probe(ctx context.Context, address common.Address) (*AddressLabel, error) {
+	code, err := l.client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return &AddressLabel{Address: address, Role: RoleEOA}, nil
+	}
+	if delegate, ok := types.ParseDelegation(code); ok {
+		return &AddressLabel{Address: address, Role: RoleEOA, Delegate: &delegate}, nil
+	}
+	pool, err := l.isPool(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if pool {
+		return &AddressLabel{Address: address, Role: RoleDexPool}, nil
+	}
+	return &AddressLabel{Address: address, Role: RoleContract}, nil
+}
+
+// isPool 同时实现 token0() 和 token1() 的合约视为 V2/V3 池子。调用回滚视为不是池子，
+// 网络等其他错误原样返回，避免把池子误标为普通合约并缓存
+func (l *AddressLabeler) isPool(ctx context.Context, address common.Address) (bool, error) {
+	for _, selector := range [][]byte{token0Selector, token1Selector} {
+		out, err := l.client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: selector}, nil)
+		if err != nil {
+			if isExecutionError(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if len(out) != 32 || common.BytesToAddress(out) == (common.Address{}) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// executionErrors 节点执行调用失败时的错误信息
+var executionErrors = []string{"revert", "invalid opcode", "out of gas", "stack underflow", "invalid jump"}
+
+// isExecutionError 错误是否来自合约执行（回滚、无效指令等），而不是网络或节点故障。
+// geth 对回滚返回错误码 3，其他节点只能按错误信息判断
+func isExecutionError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, e := range executionErrors {
+		if strings.Contains(message, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package geth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type fakeChainReader struct {
+	code  map[common.Address][]byte
+	pools map[common.Address]bool
+	down  bool // CallContract 返回网络错误
+	calls int
+}
+
+func (f *fakeChainReader) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	f.calls++
+	if account == (common.Address{}) {
+		return nil, errors.New("rpc unavailable")
+	}
+	return f.code[account], nil
+}
+
+func (f *fakeChainReader) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if f.down {
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	if !f.pools[*msg.To] {
+		return nil, errors.New("execution reverted")
+	}
+	return common.LeftPadBytes(USDT.Address.Bytes(), 32), nil
+}
+
+func TestAddressLabeler(t *testing.T) {
+	eoa := common.HexToAddress("0x01")
+	pool := common.HexToAddress("0x02")
+	contract := common.HexToAddress("0x03")
+	own := common.HexToAddress("0x04")
+	cex := common.HexToAddress("0x05")
+
+	path := filepath.Join(t.TempDir(), "labels.json")
+	if err := os.WriteFile(path, []byte(`[{"address":"0x0000000000000000000000000000000000000005","role":"CEX","name":"Binance"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	labeler, err := NewAddressLabeler(nil, WithOwnAddresses(own), WithLabelsFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &fakeChainReader{
+		code:  map[common.Address][]byte{pool: {0x60}, contract: {0x60}},
+		pools: map[common.Address]bool{pool: true},
+	}
+	labeler.client = reader
+
+	want := map[common.Address]AddressRole{
+		eoa:      RoleEOA,
+		pool:     RoleDexPool,
+		contract: RoleContract,
+		own:      RoleOwn,
+		cex:      RoleCEX,
+		common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E"): RoleRouter,
+		common.HexToAddress("0xceCCE97529EffC360f68b3F26eEF4ad74eBF5705"): RoleBot,
+	}
+	addresses := make([]common.Address, 0, len(want)*2)
+	for addr := range want {
+		addresses = append(addresses, addr, addr)
+	}
+	labels, err := labeler.LabelAll(context.Background(), addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, role := range want {
+		if labels[addr].Role != role {
+			t.Errorf("%s: want %q, got %q", addr.Hex(), role, labels[addr].Role)
+		}
+	}
+	if reader.calls != 3 {
+		t.Fatalf("want 3 code lookups, got %d", reader.calls)
+	}
+
+	// 命中缓存不再查询
+	labeler.Label(context.Background(), eoa)
+	if reader.calls != 3 {
+		t.Fatalf("cache miss: %d code lookups", reader.calls)
+	}
+
+	if _, err := labeler.Label(context.Background(), common.Address{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if labeler.Role(context.Background(), common.Address{}) != RoleUnknown {
+		t.Fatal("expected unknown role on error")
+	}
+
+	// 网络错误不能把池子标成普通合约并缓存
+	other := common.HexToAddress("0x06")
+	reader.code[other] = []byte{0x60}
+	reader.pools[other] = true
+	reader.down = true
+	if _, err := labeler.Label(context.Background(), other); err == nil {
+		t.Fatal("expected error when pool probe fails")
+	}
+	reader.down = false
+	if role := labeler.Role(context.Background(), other); role != RoleDexPool {
+		t.Fatalf("want %q after recovery, got %q", RoleDexPool, role)
+	}
+}
+
+func TestIsExecutionError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("execution reverted"), want: true},
+		{err: errors.New("invalid opcode: INVALID"), want: true},
+		{err: rpcCodeError{code: 3}, want: true},
+		{err: errors.New("context deadline exceeded"), want: false},
+		{err: rpcCodeError{code: -32005}, want: false},
+	} {
+		if got := isExecutionError(tc.err); got != tc.want {
+			t.Errorf("%v: want %v, got %v", tc.err, tc.want, got)
+		}
+	}
+}
+
+type rpcCodeError struct{ code int }
+
+func (e rpcCodeError) Error() string  { return fmt.Sprintf("rpc error %d", e.code) }
+func (e rpcCodeError) ErrorCode() int { return e.code }
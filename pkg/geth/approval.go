@@ -0,0 +1,353 @@
+package geth
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ApprovalKind 授权来源
+type ApprovalKind string
+
+const (
+	ApprovalERC20   ApprovalKind = "erc20"
+	ApprovalPermit2 ApprovalKind = "permit2"
+)
+
+var (
+	Permit2Address = common.HexToAddress("0x000000000022D473030F116dDEE9F6B43aC78BA3")
+
+	// ERC20 Approval 有 3 个 topic，ERC721 同名事件有 4 个（tokenId 也是 indexed）
+	approvalTopic = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+
+	permit2ApprovalTopic = crypto.Keccak256Hash([]byte("Approval(address,address,address,uint160,uint48)"))
+	permit2PermitTopic   = crypto.Keccak256Hash([]byte("Permit(address,address,address,uint160,uint48,uint48)"))
+	permit2LockdownTopic = crypto.Keccak256Hash([]byte("Lockdown(address,address,address)"))
+
+	allowanceSelector        = common.FromHex("0xdd62ed3e") // allowance(address,address)
+	permit2AllowanceSelector = common.FromHex("0x927da105") // allowance(address,address,address)
+
+	// UnlimitedAllowance 达到该值的授权视为无限授权。部分代币（UNI、COMP 等）把 uint256 最大值截断为 uint96 最大值存储
+	UnlimitedAllowance = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 96), big.NewInt(1))
+)
+
+const defaultApprovalChunkSize = 5000
+
+// ApprovalEvent 一次授权变更
+type ApprovalEvent struct {
+	Kind        ApprovalKind   `json:"kind"`
+	Owner       common.Address `json:"owner"`
+	Token       common.Address `json:"token"`
+	Spender     common.Address `json:"spender"`
+	Amount      *big.Int       `json:"amount"`
+	Expiration  uint64         `json:"expiration,omitempty"` // 仅 Permit2，unix 时间戳
+	BlockNumber uint64         `json:"block_number"`
+	TxHash      common.Hash    `json:"tx_hash"`
+	LogIndex    uint           `json:"log_index"`
+}
+
+// ParseApprovalLog 解析 ERC20 Approval 以及 Permit2 的 Approval / Permit / Lockdown 事件
+func ParseApprovalLog(l *types.Log) (*ApprovalEvent, bool) {
+	if len(l.Topics) == 0 {
+		return nil, false
+	}
+	newEvent := func(kind ApprovalKind, owner, token, spender common.Address, amount *big.Int) *ApprovalEvent {
+		return &ApprovalEvent{
+			Kind:        kind,
+			Owner:       owner,
+			Token:       token,
+			Spender:     spender,
+			Amount:      amount,
+			BlockNumber: l.BlockNumber,
+			TxHash:      l.TxHash,
+			LogIndex:    l.Index,
+		}
+	}
+
+	switch l.Topics[0] {
+	case approvalTopic:
+		if len(l.Topics) != 3 || len(l.Data) < 32 {
+			return nil, false
+		}
+		return newEvent(ApprovalERC20,
+			common.BytesToAddress(l.Topics[1].Bytes()),
+			l.Address,
+			common.BytesToAddress(l.Topics[2].Bytes()),
+			new(big.Int).SetBytes(l.Data[:32]),
+		), true
+
+	case permit2ApprovalTopic, permit2PermitTopic:
+		if l.Address != Permit2Address || len(l.Topics) != 4 || len(l.Data) < 64 {
+			return nil, false
+		}
+		ev := newEvent(ApprovalPermit2,
+			common.BytesToAddress(l.Topics[1].Bytes()),
+			common.BytesToAddress(l.Topics[2].Bytes()),
+			common.BytesToAddress(l.Topics[3].Bytes()),
+			new(big.Int).SetBytes(l.Data[:32]),
+		)
+		ev.Expiration = new(big.Int).SetBytes(l.Data[32:64]).Uint64()
+		// Permit2 把 expiration 0 存为当前区块时间，即只在本区块内有效
+		if ev.Expiration == 0 {
+			ev.Expiration = l.BlockTimestamp
+		}
+		return ev, true
+
+	case permit2LockdownTopic:
+		// Lockdown(address indexed owner, address token, address spender) 把授权额度清零
+		if l.Address != Permit2Address || len(l.Topics) != 2 || len(l.Data) < 64 {
+			return nil, false
+		}
+		return newEvent(ApprovalPermit2,
+			common.BytesToAddress(l.Topics[1].Bytes()),
+			common.BytesToAddress(l.Data[:32]),
+			common.BytesToAddress(l.Data[32:64]),
+			new(big.Int),
+		), true
+	}
+	return nil, false
+}
+
+// AllowanceKey (owner, token, spender) 以及授权来源
+type AllowanceKey struct {
+	Kind    ApprovalKind
+	Owner   common.Address
+	Token   common.Address
+	Spender common.Address
+}
+
+// Allowance 当前授权额度。ERC20 额度来自最近一次 Approval 事件，
+// transferFrom 消耗的额度很多代币不会发事件，需要精确值时用 RefreshAllowances 从链上读取。
+type Allowance struct {
+	Kind        ApprovalKind   `json:"kind"`
+	Owner       common.Address `json:"owner"`
+	Token       common.Address `json:"token"`
+	Spender     common.Address `json:"spender"`
+	Amount      *big.Int       `json:"amount"`
+	Expiration  uint64         `json:"expiration,omitempty"`
+	BlockNumber uint64         `json:"block_number"` // 最后一次变更所在区块
+	TxHash      common.Hash    `json:"tx_hash"`
+	logIndex    uint
+}
+
+// Unlimited 额度达到 UnlimitedAllowance
+func (a *Allowance) Unlimited() bool {
+	return a.Amount != nil && a.Amount.Cmp(UnlimitedAllowance) >= 0
+}
+
+// Active 额度不为 0，Permit2 授权还要求在 now（unix 秒）时未过期
+func (a *Allowance) Active(now uint64) bool {
+	if a.Amount == nil || a.Amount.Sign() == 0 {
+		return false
+	}
+	return a.Kind != ApprovalPermit2 || a.Expiration >= now
+}
+
+// AllowanceState 每个 (owner, token, spender) 的最新授权
+type AllowanceState struct {
+	allowances map[AllowanceKey]*Allowance
+}
+
+func NewAllowanceState() *AllowanceState {
+	return &AllowanceState{allowances: make(map[AllowanceKey]*Allowance)}
+}
+
+// Apply 应用一次授权变更，比当前记录更早的变更会被忽略，事件可以乱序应用
+func (s *AllowanceState) Apply(ev *ApprovalEvent) {
+	key := AllowanceKey{Kind: ev.Kind, Owner: ev.Owner, Token: ev.Token, Spender: ev.Spender}
+	if cur, ok := s.allowances[key]; ok {
+		if cur.BlockNumber > ev.BlockNumber || (cur.BlockNumber == ev.BlockNumber && cur.logIndex > ev.LogIndex) {
+			return
+		}
+	}
+	s.allowances[key] = &Allowance{
+		Kind:        ev.Kind,
+		Owner:       ev.Owner,
+		Token:       ev.Token,
+		Spender:     ev.Spender,
+		Amount:      new(big.Int).Set(ev.Amount),
+		Expiration:  ev.Expiration,
+		BlockNumber: ev.BlockNumber,
+		TxHash:      ev.TxHash,
+		logIndex:    ev.LogIndex,
+	}
+}
+
+// ApplyLogs 解析并应用日志中的授权事件，返回应用的事件数
+func (s *AllowanceState) ApplyLogs(logs []*types.Log) int {
+	n := 0
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		if ev, ok := ParseApprovalLog(l); ok {
+			s.Apply(ev)
+			n++
+		}
+	}
+	return n
+}
+
+// Get 返回授权，没有记录时返回 nil
+func (s *AllowanceState) Get(kind ApprovalKind, owner, token, spender common.Address) *Allowance {
+	return s.allowances[AllowanceKey{Kind: kind, Owner: owner, Token: token, Spender: spender}]
+}
+
+// Allowances 返回所有授权（包括已清零的），按 owner、token、spender 排序
+func (s *AllowanceState) Allowances() []*Allowance {
+	list := make([]*Allowance, 0, len(s.allowances))
+	for _, a := range s.allowances {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Owner != b.Owner {
+			return a.Owner.Cmp(b.Owner) < 0
+		}
+		if a.Token != b.Token {
+			return a.Token.Cmp(b.Token) < 0
+		}
+		if a.Spender != b.Spender {
+			return a.Spender.Cmp(b.Spender) < 0
+		}
+		return a.Kind < b.Kind
+	})
+	return list
+}
+
+// Exposure 在 now（unix 秒）时仍有效的授权
+func (s *AllowanceState) Exposure(now uint64) []*Allowance {
+	list := make([]*Allowance, 0)
+	for _, a := range s.Allowances() {
+		if a.Active(now) {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// UnlimitedApprovals 有效的无限授权中 spender 不在已知路由、Permit2 和 trusted 里的部分
+func (s *AllowanceState) UnlimitedApprovals(now uint64, trusted ...common.Address) []*Allowance {
+	known := make(map[common.Address]bool, len(trusted)+1)
+	known[Permit2Address] = true
+	for _, addr := range trusted {
+		known[addr] = true
+	}
+	list := make([]*Allowance, 0)
+	for _, a := range s.Exposure(now) {
+		if !a.Unlimited() || known[a.Spender] {
+			continue
+		}
+		if _, ok := knownRouters[a.Spender]; ok {
+			continue
+		}
+		list = append(list, a)
+	}
+	return list
+}
+
+// approvalReader 扫描授权需要的链上查询，*ethclient.Client 满足该接口
+type approvalReader interface {
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+type ApprovalScanOptions struct {
+	ChunkSize uint64 // 每次 eth_getLogs 的区块数，默认 5000
+	Refresh   bool   // 扫描结束后按 blockEnd 从链上读取实际额度
+}
+
+// ScanApprovals 扫描 owners 在 blockBegin..blockEnd 内的授权事件，返回区间结束时的授权状态
+func ScanApprovals(ctx context.Context, client *ethclient.Client, owners []common.Address, blockBegin, blockEnd uint64, opts ApprovalScanOptions) (*AllowanceState, error) {
+	return scanApprovals(ctx, client, owners, blockBegin, blockEnd, opts)
+}
+
+func scanApprovals(ctx context.Context, client approvalReader, owners []common.Address, blockBegin, blockEnd uint64, opts ApprovalScanOptions) (*AllowanceState, error) {
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = defaultApprovalChunkSize
+	}
+	ownerTopics := make([]common.Hash, 0, len(owners))
+	for _, owner := range owners {
+		ownerTopics = append(ownerTopics, common.BytesToHash(owner.Bytes()))
+	}
+
+	state := NewAllowanceState()
+	for from := blockBegin; from <= blockEnd; from += opts.ChunkSize {
+		to := from + opts.ChunkSize - 1
+		if to > blockEnd || to < from {
+			to = blockEnd
+		}
+		// owner 在所有事件里都是 topic1，一次查询即可覆盖 ERC20 和 Permit2
+		logs, err := client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Topics: [][]common.Hash{
+				{approvalTopic, permit2ApprovalTopic, permit2PermitTopic, permit2LockdownTopic},
+				ownerTopics,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		ptrs := make([]*types.Log, len(logs))
+		for i := range logs {
+			ptrs[i] = &logs[i]
+		}
+		state.ApplyLogs(ptrs)
+		if to == blockEnd {
+			break
+		}
+	}
+
+	if opts.Refresh {
+		if err := refreshAllowances(ctx, client, state, blockEnd); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// RefreshAllowances 从链上读取 blockNumber 时的实际额度，覆盖事件推算的值
+func RefreshAllowances(ctx context.Context, client *ethclient.Client, state *AllowanceState, blockNumber uint64) error {
+	return refreshAllowances(ctx, client, state, blockNumber)
+}
+
+func refreshAllowances(ctx context.Context, client approvalReader, state *AllowanceState, blockNumber uint64) error {
+	block := new(big.Int).SetUint64(blockNumber)
+	for _, a := range state.allowances {
+		var msg ethereum.CallMsg
+		switch a.Kind {
+		case ApprovalERC20:
+			token := a.Token
+			msg = ethereum.CallMsg{To: &token, Data: append(append(common.CopyBytes(allowanceSelector),
+				common.LeftPadBytes(a.Owner.Bytes(), 32)...), common.LeftPadBytes(a.Spender.Bytes(), 32)...)}
+		case ApprovalPermit2:
+			permit2 := Permit2Address
+			data := common.CopyBytes(permit2AllowanceSelector)
+			for _, addr := range []common.Address{a.Owner, a.Token, a.Spender} {
+				data = append(data, common.LeftPadBytes(addr.Bytes(), 32)...)
+			}
+			msg = ethereum.CallMsg{To: &permit2, Data: data}
+		default:
+			continue
+		}
+		out, err := client.CallContract(ctx, msg, block)
+		if err != nil {
+			return err
+		}
+		if len(out) < 32 {
+			continue
+		}
+		a.Amount = new(big.Int).SetBytes(out[:32])
+		if a.Kind == ApprovalPermit2 && len(out) >= 64 {
+			a.Expiration = new(big.Int).SetBytes(out[32:64]).Uint64()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package geth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func approvalLog(token, owner, spender common.Address, amount *big.Int, block uint64, index uint) types.Log {
+	return types.Log{
+		Address:     token,
+		Topics:      []common.Hash{approvalTopic, common.BytesToHash(owner.Bytes()), common.BytesToHash(spender.Bytes())},
+		Data:        common.LeftPadBytes(amount.Bytes(), 32),
+		BlockNumber: block,
+		Index:       index,
+	}
+}
+
+func permit2Log(topic common.Hash, owner, token, spender common.Address, amount *big.Int, expiration uint64, block uint64) types.Log {
+	data := append(common.LeftPadBytes(amount.Bytes(), 32), common.LeftPadBytes(new(big.Int).SetUint64(expiration).Bytes(), 32)...)
+	return types.Log{
+		Address:     Permit2Address,
+		Topics:      []common.Hash{topic, common.BytesToHash(owner.Bytes()), common.BytesToHash(token.Bytes()), common.BytesToHash(spender.Bytes())},
+		Data:        data,
+		BlockNumber: block,
+	}
+}
+
+type fakeApprovalReader struct {
+	logs    []types.Log
+	queries []ethereum.FilterQuery
+	onchain map[common.Address]*big.Int // token -> allowance
+}
+
+func (f *fakeApprovalReader) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	f.queries = append(f.queries, q)
+	var out []types.Log
+	for _, l := range f.logs {
+		if l.BlockNumber >= q.FromBlock.Uint64() && l.BlockNumber <= q.ToBlock.Uint64() {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeApprovalReader) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return common.LeftPadBytes(f.onchain[*msg.To].Bytes(), 32), nil
+}
+
+func TestAllowanceState(t *testing.T) {
+	owner := common.HexToAddress("0xaaaa")
+	token := common.HexToAddress("0x1111")
+	unknown := common.HexToAddress("0xbad0")
+	router := common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E")
+	maxUint := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	logs := []types.Log{
+		approvalLog(token, owner, unknown, big.NewInt(100), 20, 0),
+		approvalLog(token, owner, unknown, maxUint, 10, 0), // 更早的事件后到，不应覆盖
+		approvalLog(token, owner, router, maxUint, 10, 1),
+		permit2Log(permit2ApprovalTopic, owner, token, unknown, UnlimitedAllowance, 2000, 12),
+	}
+	// ERC721 Approval 有 4 个 topic，不是 ERC20 授权
+	nft := approvalLog(token, owner, unknown, big.NewInt(1), 30, 0)
+	nft.Topics = append(nft.Topics, common.BigToHash(big.NewInt(1)))
+	logs = append(logs, nft)
+
+	state := NewAllowanceState()
+	ptrs := make([]*types.Log, len(logs))
+	for i := range logs {
+		ptrs[i] = &logs[i]
+	}
+	if n := state.ApplyLogs(ptrs); n != 4 {
+		t.Fatalf("expected 4 approval events, got %d", n)
+	}
+
+	if a := state.Get(ApprovalERC20, owner, token, unknown); a.Amount.Int64() != 100 || a.BlockNumber != 20 {
+		t.Fatalf("unexpected allowance %+v", a)
+	}
+	if got := state.UnlimitedApprovals(1000); len(got) != 1 || got[0].Kind != ApprovalPermit2 {
+		t.Fatalf("expected only the permit2 approval, got %+v", got)
+	}
+	// Permit2 授权过期后不再计入
+	if got := state.UnlimitedApprovals(3000); len(got) != 0 {
+		t.Fatalf("expired permit2 approval reported: %+v", got)
+	}
+
+	lockdown := types.Log{
+		Address:     Permit2Address,
+		Topics:      []common.Hash{permit2LockdownTopic, common.BytesToHash(owner.Bytes())},
+		Data:        append(common.LeftPadBytes(token.Bytes(), 32), common.LeftPadBytes(unknown.Bytes(), 32)...),
+		BlockNumber: 13,
+	}
+	state.ApplyLogs([]*types.Log{&lockdown})
+	if a := state.Get(ApprovalPermit2, owner, token, unknown); a.Active(0) {
+		t.Fatalf("lockdown should revoke allowance: %+v", a)
+	}
+	if got := state.Exposure(1000); len(got) != 2 {
+		t.Fatalf("expected 2 active allowances, got %d", len(got))
+	}
+}
+
+func TestScanApprovals(t *testing.T) {
+	owner := common.HexToAddress("0xaaaa")
+	token := common.HexToAddress("0x1111")
+	spender := common.HexToAddress("0xbad0")
+	reader := &fakeApprovalReader{
+		logs: []types.Log{
+			approvalLog(token, owner, spender, UnlimitedAllowance, 5, 0),
+			approvalLog(token, owner, spender, big.NewInt(0), 15, 0),
+			approvalLog(token, owner, spender, UnlimitedAllowance, 25, 0),
+		},
+		onchain: map[common.Address]*big.Int{token: big.NewInt(42)},
+	}
+
+	state, err := scanApprovals(context.Background(), reader, []common.Address{owner}, 0, 29, ApprovalScanOptions{ChunkSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.queries) != 3 {
+		t.Fatalf("expected 3 chunked queries, got %d", len(reader.queries))
+	}
+	if got := state.UnlimitedApprovals(0); len(got) != 1 || got[0].BlockNumber != 25 {
+		t.Fatalf("unexpected unlimited approvals %+v", got)
+	}
+
+	state, err = scanApprovals(context.Background(), reader, []common.Address{owner}, 0, 29, ApprovalScanOptions{Refresh: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := state.Get(ApprovalERC20, owner, token, spender); a.Amount.Int64() != 42 {
+		t.Fatalf("expected refreshed allowance 42, got %s", a.Amount)
+	}
+}
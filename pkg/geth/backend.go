@@ -0,0 +1,42 @@
+package geth
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ChainBackend 按区块读取链上数据。RPCBackend 直接查询节点，archive.Backend 从本地归档文件回放。
+type ChainBackend interface {
+	BlockByNumber(ctx context.Context, blockNumber uint64) (*types.Block, error)
+	BlockReceipts(ctx context.Context, blockNumber uint64) ([]*types.Receipt, error)
+	TraceBlock(ctx context.Context, blockNumber uint64) ([]BlockTraceResult, error)
+	TraceBlockForChange(ctx context.Context, blockNumber uint64) ([]PrestateTxResult, error)
+}
+
+// RPCBackend 基于节点 RPC 的 ChainBackend，trace 需要 RPCURL 支持 debug_ 接口
+type RPCBackend struct {
+	Client *ethclient.Client
+	RPCURL string
+}
+
+func NewRPCBackend(client *ethclient.Client, rpcURL string) *RPCBackend {
+	return &RPCBackend{Client: client, RPCURL: rpcURL}
+}
+
+func (b *RPCBackend) BlockByNumber(ctx context.Context, blockNumber uint64) (*types.Block, error) {
+	return GetBlockByNumber(ctx, b.Client, blockNumber)
+}
+
+func (b *RPCBackend) BlockReceipts(ctx context.Context, blockNumber uint64) ([]*types.Receipt, error) {
+	return GetBlockReceiptsByNumber(ctx, b.Client, blockNumber)
+}
+
+func (b *RPCBackend) TraceBlock(ctx context.Context, blockNumber uint64) ([]BlockTraceResult, error) {
+	return TraceBlockContext(ctx, b.RPCURL, blockNumber)
+}
+
+func (b *RPCBackend) TraceBlockForChange(ctx context.Context, blockNumber uint64) ([]PrestateTxResult, error) {
+	return TraceBlockForChangeContext(ctx, b.RPCURL, blockNumber)
+}
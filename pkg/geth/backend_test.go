@@ -0,0 +1,65 @@
+package geth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// memBackend 内存中的 ChainBackend，用于离线测试分析函数
+type memBackend struct {
+	blocks   map[uint64]*types.Block
+	receipts map[uint64][]*types.Receipt
+	traces   map[uint64][]BlockTraceResult
+	prestate map[uint64][]PrestateTxResult
+}
+
+func (b *memBackend) BlockByNumber(ctx context.Context, blockNumber uint64) (*types.Block, error) {
+	if block, ok := b.blocks[blockNumber]; ok {
+		return block, nil
+	}
+	return nil, fmt.Errorf("block %d not found", blockNumber)
+}
+
+func (b *memBackend) BlockReceipts(ctx context.Context, blockNumber uint64) ([]*types.Receipt, error) {
+	return b.receipts[blockNumber], nil
+}
+
+func (b *memBackend) TraceBlock(ctx context.Context, blockNumber uint64) ([]BlockTraceResult, error) {
+	return b.traces[blockNumber], nil
+}
+
+func (b *memBackend) TraceBlockForChange(ctx context.Context, blockNumber uint64) ([]PrestateTxResult, error) {
+	return b.prestate[blockNumber], nil
+}
+
+func TestRPCBackendTraceHonorsContext(t *testing.T) {
+	var calls int64
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[]}`))
+	}))
+	defer node.Close()
+
+	backend := NewRPCBackend(nil, node.URL)
+	if _, err := backend.TraceBlock(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := backend.TraceBlock(ctx, 1); err == nil {
+		t.Fatal("expected error for cancelled context")
+	}
+	if _, err := backend.TraceBlockForChange(ctx, 1); err == nil {
+		t.Fatal("expected error for cancelled context")
+	}
+	if calls != 1 {
+		t.Fatalf("cancelled traces should not reach the node, got %d calls", calls)
+	}
+}
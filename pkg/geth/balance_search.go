@@ -0,0 +1,212 @@
+package geth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// BalanceChangePoint 余额发生变化的区块，Before 为上一个区块结束时的余额
+type BalanceChangePoint struct {
+	BlockNumber uint64   `json:"block_number"`
+	Before      *big.Int `json:"before"`
+	After       *big.Int `json:"after"`
+}
+
+// BlockRange 闭区间
+type BlockRange struct {
+	Begin uint64 `json:"begin"`
+	End   uint64 `json:"end"`
+}
+
+type BalanceSearchOptions struct {
+	MaxCalls    int // 最多查询多少次余额，0 表示不限制
+	Concurrency int // 同时进行的查询数，默认 4
+	Segments    int // 先把区间等分成多少段再分别二分，段数越多越不容易漏掉段内相互抵消的变化，默认 1
+}
+
+// BalanceSearchResult 变化点按区块号排序。调用次数用完时未能细分的区间放在 Unresolved 中，其中至少有一个变化点。
+type BalanceSearchResult struct {
+	Points     []*BalanceChangePoint `json:"points"`
+	Unresolved []BlockRange          `json:"unresolved"`
+	Calls      int                   `json:"calls"`
+}
+
+// Complete 是否找到了区间内全部可发现的变化点
+func (r *BalanceSearchResult) Complete() bool {
+	return len(r.Unresolved) == 0
+}
+
+// ErrBalanceBudget MaxCalls 不足以查询区间两端及各段边界的余额
+var ErrBalanceBudget = errors.New("balance call budget exhausted")
+
+// FindBalanceChangePoints 二分 blockBegin..blockEnd，找出 address 的 token 余额（token 为空时为原生代币）发生变化的所有区块。
+// 只比较区间两端的余额，区间内先增后减回到原值的变化无法发现，可以用 Segments 降低漏查的概率。已查询过的区块会被缓存。
+// blockBegin 必须大于 0；MaxCalls 不够查询各段边界时返回 ErrBalanceBudget。
+func FindBalanceChangePoints(ctx context.Context, client *ethclient.Client, address, token string, blockBegin, blockEnd uint64, opts BalanceSearchOptions) (*BalanceSearchResult, error) {
+	balanceAt := func(ctx context.Context, blockNumber uint64) (*big.Int, error) {
+		return GetTokenBalanceAt(ctx, client, address, token, blockNumber)
+	}
+	return findBalanceChangePoints(ctx, balanceAt, blockBegin, blockEnd, opts)
+}
+
+type balanceSearcher struct {
+	balanceAt func(ctx context.Context, blockNumber uint64) (*big.Int, error)
+	maxCalls  int
+	sem       chan struct{}
+
+	mu         sync.Mutex
+	memo       map[uint64]*big.Int
+	calls      int
+	points     []*BalanceChangePoint
+	unresolved []BlockRange
+}
+
+func findBalanceChangePoints(ctx context.Context, balanceAt func(ctx context.Context, blockNumber uint64) (*big.Int, error), blockBegin, blockEnd uint64, opts BalanceSearchOptions) (*BalanceSearchResult, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	s := &balanceSearcher{
+		balanceAt:  balanceAt,
+		maxCalls:   opts.MaxCalls,
+		sem:        make(chan struct{}, opts.Concurrency),
+		memo:       make(map[uint64]*big.Int),
+		points:     make([]*BalanceChangePoint, 0),
+		unresolved: make([]BlockRange, 0),
+	}
+
+	if blockBegin == 0 || blockBegin > blockEnd {
+		return nil, fmt.Errorf("invalid block range %d..%d", blockBegin, blockEnd)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := &BalanceSearchResult{}
+
+	// 搜索区间为 (lo, hi]，变化点 b 满足 balance(b) != balance(b-1)
+	lo, hi := blockBegin-1, blockEnd
+	segments := uint64(opts.Segments)
+	if segments == 0 {
+		segments = 1
+	}
+	if segments > hi-lo {
+		segments = hi - lo
+	}
+	bounds := make([]uint64, 0, segments+1)
+	for i := uint64(0); i < segments; i++ {
+		bounds = append(bounds, lo+(hi-lo)*i/segments)
+	}
+	bounds = append(bounds, hi)
+	balances := make([]*big.Int, len(bounds))
+	for i, b := range bounds {
+		balance, err := s.balance(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		balances[i] = balance
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	var search func(lo, hi uint64, loBalance, hiBalance *big.Int)
+	search = func(lo, hi uint64, loBalance, hiBalance *big.Int) {
+		defer wg.Done()
+		if loBalance.Cmp(hiBalance) == 0 {
+			return
+		}
+		if hi == lo+1 {
+			s.addPoint(&BalanceChangePoint{BlockNumber: hi, Before: loBalance, After: hiBalance})
+			return
+		}
+
+		mid := lo + (hi-lo)/2
+		midBalance, err := s.balance(ctx, mid)
+		if errors.Is(err, ErrBalanceBudget) {
+			s.addUnresolved(BlockRange{Begin: lo + 1, End: hi})
+			return
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		wg.Add(2)
+		go search(lo, mid, loBalance, midBalance)
+		go search(mid, hi, midBalance, hiBalance)
+	}
+
+	for i := 1; i < len(bounds); i++ {
+		wg.Add(1)
+		go search(bounds[i-1], bounds[i], balances[i-1], balances[i])
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(s.points, func(i, j int) bool { return s.points[i].BlockNumber < s.points[j].BlockNumber })
+	sort.Slice(s.unresolved, func(i, j int) bool { return s.unresolved[i].Begin < s.unresolved[j].Begin })
+	result.Points = s.points
+	result.Unresolved = s.unresolved
+	result.Calls = s.calls
+	return result, nil
+}
+
+// balance 查询区块结束时的余额，命中缓存时不计入调用次数
+func (s *balanceSearcher) balance(ctx context.Context, blockNumber uint64) (*big.Int, error) {
+	s.mu.Lock()
+	if b, ok := s.memo[blockNumber]; ok {
+		s.mu.Unlock()
+		return b, nil
+	}
+	if s.maxCalls > 0 && s.calls >= s.maxCalls {
+		s.mu.Unlock()
+		return nil, ErrBalanceBudget
+	}
+	s.calls++
+	s.mu.Unlock()
+
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	b, err := s.balanceAt(ctx, blockNumber)
+	<-s.sem
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.memo[blockNumber] = b
+	s.mu.Unlock()
+	return b, nil
+}
+
+func (s *balanceSearcher) addPoint(point *BalanceChangePoint) {
+	s.mu.Lock()
+	s.points = append(s.points, point)
+	s.mu.Unlock()
+}
+
+func (s *balanceSearcher) addUnresolved(r BlockRange) {
+	s.mu.Lock()
+	s.unresolved = append(s.unresolved, r)
+	s.mu.Unlock()
+}
@@ -0,0 +1,76 @@
+package geth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFindBalanceChangePoints(t *testing.T) {
+	changes := map[uint64]int64{105: 3, 106: -1, 190: 40, 512: -42}
+	var calls int64
+	balanceAt := func(ctx context.Context, blockNumber uint64) (*big.Int, error) {
+		atomic.AddInt64(&calls, 1)
+		total := int64(100)
+		for b, v := range changes {
+			if b <= blockNumber {
+				total += v
+			}
+		}
+		return big.NewInt(total), nil
+	}
+
+	// 全区间净变化为 0，只看两端会漏掉所有变化点
+	result, err := findBalanceChangePoints(context.Background(), balanceAt, 100, 1000, BalanceSearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Points) != 0 {
+		t.Fatalf("unexpected points: %+v", result.Points)
+	}
+
+	atomic.StoreInt64(&calls, 0)
+	result, err = findBalanceChangePoints(context.Background(), balanceAt, 100, 1000, BalanceSearchOptions{Concurrency: 3, Segments: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Complete() || len(result.Points) != 4 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	want := []uint64{105, 106, 190, 512}
+	for i, p := range result.Points {
+		if p.BlockNumber != want[i] || new(big.Int).Sub(p.After, p.Before).Int64() != changes[p.BlockNumber] {
+			t.Fatalf("point %d: %+v", i, p)
+		}
+	}
+	if int64(result.Calls) != calls || result.Calls > 60 {
+		t.Fatalf("unexpected call count %d (%d)", result.Calls, calls)
+	}
+
+	limited, err := findBalanceChangePoints(context.Background(), balanceAt, 100, 1000, BalanceSearchOptions{MaxCalls: 6, Concurrency: 1, Segments: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limited.Complete() || limited.Calls != 6 {
+		t.Fatalf("expected unresolved ranges within budget, got %+v", limited)
+	}
+
+	failing := func(ctx context.Context, blockNumber uint64) (*big.Int, error) {
+		if blockNumber == 1000 {
+			return nil, errors.New("rpc error")
+		}
+		return big.NewInt(0), nil
+	}
+	if _, err := findBalanceChangePoints(context.Background(), failing, 100, 1000, BalanceSearchOptions{Segments: 2}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := findBalanceChangePoints(context.Background(), balanceAt, 100, 1000, BalanceSearchOptions{MaxCalls: 3, Segments: 4}); !errors.Is(err, ErrBalanceBudget) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+	if _, err := findBalanceChangePoints(context.Background(), balanceAt, 0, 1000, BalanceSearchOptions{}); err == nil {
+		t.Fatal("expected error for block 0")
+	}
+}
@@ -3,6 +3,7 @@ package geth
 import (
 	"context"
 	"math/big"
+	"net/http"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
@@ -13,6 +14,16 @@ import (
 	"github.com/lonelybeanz/tools/pkg/log"
 )
 
+// DialWithHTTPClient 使用自定义 http.Client 连接节点，例如 rpccache.NewHTTPClient 返回的带缓存的客户端、
+// metrics.NewHTTPClient 返回的记录调用指标的客户端
+func DialWithHTTPClient(ctx context.Context, rpcURL string, httpClient *http.Client) (*ethclient.Client, error) {
+	rpcClient, err := rpc.DialOptions(ctx, rpcURL, rpc.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(rpcClient), nil
+}
+
 func GetBlockNumber(ctx context.Context, client *ethclient.Client) (uint64, error) {
 	latestBlockNumber, err := client.BlockNumber(ctx)
 	if err != nil {
@@ -56,16 +67,23 @@ func GetTransactionByHash(ctx context.Context, client *ethclient.Client, txHash
 	return tx, nil
 }
 
+// IsEoa 查询失败时记录日志并返回 false，需要区分错误时使用 CheckEoa
 func IsEoa(ctx context.Context, client *ethclient.Client, address common.Address) bool {
-	code, err := client.CodeAt(ctx, address, nil)
+	isEoa, err := CheckEoa(ctx, client, address)
 	if err != nil {
 		log.Errorf("CodeAt error: %v", err)
 		return false
 	}
-	if len(code) > 0 {
-		return false
+	return isEoa
+}
+
+// CheckEoa 判断地址是否为外部账户（没有合约代码）。通过 EIP-7702 委托了代码的 EOA 仍然视为外部账户。
+func CheckEoa(ctx context.Context, client *ethclient.Client, address common.Address) (bool, error) {
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, err
 	}
-	return true
+	return isEoaCode(code), nil
 }
 
 func GetTokenInWithLogs(ctx context.Context, client *ethclient.Client, sercherAddresses []string, startBlock, endBlock uint64) ([]types.Log, error) {
@@ -0,0 +1,333 @@
+package geth
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lonelybeanz/tools/pkg/log"
+)
+
+const (
+	FlashLoanAaveV2      = "AaveV2"
+	FlashLoanAaveV3      = "AaveV3"
+	FlashLoanV3Flash     = "V3Flash"     // PancakeV3 / UniswapV3 池的 Flash
+	FlashLoanV2FlashSwap = "V2FlashSwap" // V2 池借出并归还同一种代币
+)
+
+var (
+	// Aave V2 及沿用同一事件签名的分叉
+	aaveV2FlashLoanTopic = crypto.Keccak256Hash([]byte("FlashLoan(address,address,address,uint256,uint256,uint16)"))
+	// Aave V3 及沿用同一事件签名的分叉，interestRateMode 为枚举（uint8）
+	aaveV3FlashLoanTopic = crypto.Keccak256Hash([]byte("FlashLoan(address,address,address,uint256,uint8,uint256,uint16)"))
+	// PancakeV3 / UniswapV3 池的 Flash 事件
+	v3FlashTopic = crypto.Keccak256Hash([]byte("Flash(address,address,uint256,uint256,uint256,uint256)"))
+	v2SwapTopic  = common.HexToHash("0xd78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822")
+)
+
+// FlashLoan 表示交易内的一笔闪电贷
+type FlashLoan struct {
+	Protocol string         // 闪电贷类型，见 FlashLoanXxx 常量
+	Lender   common.Address // 发出事件的借贷池或 DEX 池
+	Borrower common.Address // 收到借款的地址
+	Token    common.Address // 借出的代币
+	Amount   *big.Int       // 借出数量
+	Repaid   *big.Int       // 归还数量（含手续费），Aave V3 以负债方式借出时为 0
+	Fee      *big.Int       // 手续费
+	LogIndex uint           // 闪电贷事件的 log index
+
+	principal *indexedTransfer // 匹配到的本金借出转账，Aave 事件中直接带有代币，为 nil
+}
+
+// indexedTransfer 带 log index 的转账，用于匹配闪电贷本金与归还
+type indexedTransfer struct {
+	*TransferToken
+	index uint
+	used  bool
+	fee   *big.Int // 归还转账中的手续费部分，保留在净变化中
+}
+
+func parseIndexedTransfers(logs []*types.Log) []*indexedTransfer {
+	transfers := make([]*indexedTransfer, 0)
+	for _, l := range logs {
+		transferToken, _ := ParseTokenEventLog(context.Background(), l)
+		if transferToken == nil {
+			continue
+		}
+		transfers = append(transfers, &indexedTransfer{TransferToken: transferToken, index: l.Index})
+	}
+	return transfers
+}
+
+// ParseFlashLoans 从交易日志中识别闪电贷：
+// Aave 风格的 FlashLoan 事件、V3 池的 Flash 事件，以及 V2 池中借出并归还同一种代币的闪电兑换。
+func ParseFlashLoans(logs []*types.Log) []*FlashLoan {
+	loans, _ := parseFlashLoans(logs, parseIndexedTransfers(logs))
+	return loans
+}
+
+// parseFlashLoans 返回闪电贷，以及只包含闪电兑换的 V2 Swap 事件（不应计为交易量）
+func parseFlashLoans(logs []*types.Log, transfers []*indexedTransfer) ([]*FlashLoan, map[uint]bool) {
+	loans := make([]*FlashLoan, 0)
+	pureFlashSwaps := make(map[uint]bool)
+
+	for _, l := range logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		switch l.Topics[0] {
+		case aaveV2FlashLoanTopic:
+			if loan := parseAaveV2FlashLoan(l); loan != nil {
+				loans = append(loans, loan)
+			}
+		case aaveV3FlashLoanTopic:
+			if loan := parseAaveV3FlashLoan(l); loan != nil {
+				loans = append(loans, loan)
+			}
+		case v3FlashTopic:
+			loans = append(loans, parseV3Flash(l, transfers)...)
+		case v2SwapTopic:
+			swapLoans, pure := parseV2FlashSwap(l, transfers)
+			loans = append(loans, swapLoans...)
+			if pure {
+				pureFlashSwaps[l.Index] = true
+			}
+		}
+	}
+	return loans, pureFlashSwaps
+}
+
+// FlashLoan(address indexed target, address indexed initiator, address indexed asset, uint256 amount, uint256 premium, uint16 referralCode)
+func parseAaveV2FlashLoan(l *types.Log) *FlashLoan {
+	if len(l.Topics) < 4 || len(l.Data) < 64 {
+		return nil
+	}
+	amount := new(big.Int).SetBytes(l.Data[0:32])
+	premium := new(big.Int).SetBytes(l.Data[32:64])
+	return &FlashLoan{
+		Protocol: FlashLoanAaveV2,
+		Lender:   l.Address,
+		Borrower: common.HexToAddress(l.Topics[1].Hex()),
+		Token:    common.HexToAddress(l.Topics[3].Hex()),
+		Amount:   amount,
+		Repaid:   new(big.Int).Add(amount, premium),
+		Fee:      premium,
+		LogIndex: l.Index,
+	}
+}
+
+// FlashLoan(address indexed target, address initiator, address indexed asset, uint256 amount, uint8 interestRateMode, uint256 premium, uint16 indexed referralCode)
+func parseAaveV3FlashLoan(l *types.Log) *FlashLoan {
+	if len(l.Topics) < 3 || len(l.Data) < 128 {
+		return nil
+	}
+	amount := new(big.Int).SetBytes(l.Data[32:64])
+	interestRateMode := new(big.Int).SetBytes(l.Data[64:96])
+	premium := new(big.Int).SetBytes(l.Data[96:128])
+
+	loan := &FlashLoan{
+		Protocol: FlashLoanAaveV3,
+		Lender:   l.Address,
+		Borrower: common.HexToAddress(l.Topics[1].Hex()),
+		Token:    common.HexToAddress(l.Topics[2].Hex()),
+		Amount:   amount,
+		Repaid:   new(big.Int).Add(amount, premium),
+		Fee:      premium,
+		LogIndex: l.Index,
+	}
+	// interestRateMode 非 0 表示借款转为负债，交易内不归还
+	if interestRateMode.Sign() != 0 {
+		loan.Repaid = new(big.Int)
+		loan.Fee = new(big.Int)
+	}
+	return loan
+}
+
+// Flash(address indexed sender, address indexed recipient, uint256 amount0, uint256 amount1, uint256 paid0, uint256 paid1)
+// 事件中没有代币地址，通过池子在事件之前转给 recipient 的等额转账确定代币。
+func parseV3Flash(l *types.Log, transfers []*indexedTransfer) []*FlashLoan {
+	if len(l.Topics) < 3 || len(l.Data) < 128 {
+		return nil
+	}
+	recipient := common.HexToAddress(l.Topics[2].Hex())
+
+	loans := make([]*FlashLoan, 0)
+	for i := 0; i < 2; i++ {
+		amount := new(big.Int).SetBytes(l.Data[i*32 : (i+1)*32])
+		paid := new(big.Int).SetBytes(l.Data[(i+2)*32 : (i+3)*32])
+		if amount.Sign() == 0 {
+			continue
+		}
+		token, known := poolToken(transfers, l.Address, l.Index, i)
+		principal := findTransferBefore(transfers, l.Index, func(t *indexedTransfer) bool {
+			return t.From == l.Address && t.To == recipient && (!known || t.Token == token) && t.Amount.Cmp(amount) == 0
+		})
+		if principal == nil {
+			log.Debugf("flash token%d not found, pool:%s tx:%s", i, l.Address.Hex(), l.TxHash.Hex())
+			continue
+		}
+		principal.used = true
+		loans = append(loans, &FlashLoan{
+			Protocol: FlashLoanV3Flash,
+			Lender:   l.Address,
+			Borrower: recipient,
+			Token:    principal.Token,
+			Amount:   amount,
+			Repaid:   new(big.Int).Add(amount, paid),
+			Fee:      paid,
+			LogIndex: l.Index,
+
+			principal: principal,
+		})
+	}
+	return loans
+}
+
+// Swap(address indexed sender, uint256 amount0In, uint256 amount1In, uint256 amount0Out, uint256 amount1Out, address indexed to)
+// 同一代币既有 In 又有 Out 且 In >= Out 时，视为借出 Out 并归还 In 的闪电兑换。
+// 当 Swap 中的所有数量都属于闪电兑换时，pure 为 true。
+func parseV2FlashSwap(l *types.Log, transfers []*indexedTransfer) (loans []*FlashLoan, pure bool) {
+	if len(l.Topics) < 3 || len(l.Data) < 128 {
+		return nil, false
+	}
+	to := common.HexToAddress(l.Topics[2].Hex())
+
+	pure = true
+	for i := 0; i < 2; i++ {
+		amountIn := new(big.Int).SetBytes(l.Data[i*32 : (i+1)*32])
+		amountOut := new(big.Int).SetBytes(l.Data[(i+2)*32 : (i+3)*32])
+		if amountIn.Sign() == 0 && amountOut.Sign() == 0 {
+			continue
+		}
+		if amountIn.Sign() == 0 || amountOut.Sign() == 0 || amountIn.Cmp(amountOut) < 0 {
+			pure = false
+			continue
+		}
+		token, known := poolToken(transfers, l.Address, l.Index, i)
+		principal := findTransferBefore(transfers, l.Index, func(t *indexedTransfer) bool {
+			return t.From == l.Address && (!known || t.Token == token) && t.Amount.Cmp(amountOut) == 0
+		})
+		if principal == nil {
+			pure = false
+			continue
+		}
+		principal.used = true
+		loans = append(loans, &FlashLoan{
+			Protocol: FlashLoanV2FlashSwap,
+			Lender:   l.Address,
+			Borrower: to,
+			Token:    principal.Token,
+			Amount:   amountOut,
+			Repaid:   amountIn,
+			Fee:      new(big.Int).Sub(amountIn, amountOut),
+			LogIndex: l.Index,
+
+			principal: principal,
+		})
+	}
+	return loans, pure && len(loans) > 0
+}
+
+// poolToken 推断池子第 side 个代币（token0/token1）。池子的两个代币按地址升序排列，
+// 事件之前进出池子的转账中出现两种代币时即可确定；只出现一种时无法确定，返回 false。
+func poolToken(transfers []*indexedTransfer, pool common.Address, index uint, side int) (common.Address, bool) {
+	tokens := make([]common.Address, 0, 2)
+	for _, t := range transfers {
+		if t.index >= index || (t.From != pool && t.To != pool) {
+			continue
+		}
+		if !slices.Contains(tokens, t.Token) {
+			tokens = append(tokens, t.Token)
+		}
+	}
+	if len(tokens) != 2 {
+		return common.Address{}, false
+	}
+	if bytes.Compare(tokens[0].Bytes(), tokens[1].Bytes()) > 0 {
+		tokens[0], tokens[1] = tokens[1], tokens[0]
+	}
+	return tokens[side], true
+}
+
+// findTransferBefore 返回 log index 小于 index 的第一笔未被占用且满足条件的转账
+func findTransferBefore(transfers []*indexedTransfer, index uint, match func(t *indexedTransfer) bool) *indexedTransfer {
+	for _, t := range transfers {
+		if !t.used && t.index < index && match(t) {
+			return t
+		}
+	}
+	return nil
+}
+
+// markFlashLoanTransfers 标记闪电贷的本金借出与归还转账，归还转账记下其中的手续费。
+// 闪电贷事件都在归还之后发出，所以只在事件之前查找；归还取离事件最近的一笔。
+// Aave V3 以负债方式借出时借款人保留了资金，本金不标记。
+func markFlashLoanTransfers(loans []*FlashLoan, transfers []*indexedTransfer) {
+	for _, loan := range loans {
+		if loan.Repaid.Sign() == 0 {
+			continue
+		}
+		// V3 Flash 和 V2 闪电兑换的本金在解析时已经匹配并标记
+		for _, t := range transfers {
+			if loan.principal != nil {
+				break
+			}
+			if !t.used && t.index < loan.LogIndex && t.Token == loan.Token && t.To == loan.Borrower && t.Amount.Cmp(loan.Amount) == 0 {
+				t.used = true
+				break
+			}
+		}
+		for i := len(transfers) - 1; i >= 0; i-- {
+			t := transfers[i]
+			if t.used || t.index >= loan.LogIndex || t.Token != loan.Token || t.Amount.Cmp(loan.Repaid) != 0 {
+				continue
+			}
+			if t.To == loan.Lender || t.From == loan.Borrower {
+				t.used = true
+				t.fee = loan.Fee
+				break
+			}
+		}
+	}
+}
+
+// withoutFlashLoans 去掉闪电贷的本金借出转账和只包含闪电兑换的 V2 Swap 事件，归还转账只保留手续费部分，
+// 借出的本金不计入交易量，手续费仍计入借款人和借出方的净变化；借出/归还数量通过 ParseFlashLoans 单独获取。
+func withoutFlashLoans(logs []*types.Log) []*types.Log {
+	transfers := parseIndexedTransfers(logs)
+	loans, pureFlashSwaps := parseFlashLoans(logs, transfers)
+	if len(loans) == 0 {
+		return logs
+	}
+	markFlashLoanTransfers(loans, transfers)
+
+	skip := pureFlashSwaps
+	used := make(map[uint]*indexedTransfer)
+	for _, t := range transfers {
+		if t.used {
+			used[t.index] = t
+		}
+	}
+	filtered := make([]*types.Log, 0, len(logs))
+	for _, l := range logs {
+		if skip[l.Index] {
+			continue
+		}
+		t, ok := used[l.Index]
+		if !ok {
+			filtered = append(filtered, l)
+			continue
+		}
+		// 转账类事件的金额都在 data 的第一个字中，替换为手续费
+		if t.fee != nil && t.fee.Sign() > 0 {
+			feeLog := *l
+			feeLog.Data = common.LeftPadBytes(t.fee.Bytes(), 32)
+			filtered = append(filtered, &feeLog)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,180 @@
+package geth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func wordOf(v int64) []byte {
+	return common.LeftPadBytes(big.NewInt(v).Bytes(), 32)
+}
+
+func transferLog(index uint, token, from, to common.Address, amount int64) *types.Log {
+	return &types.Log{
+		Address: token,
+		Topics: []common.Hash{
+			common.HexToHash(NewERC20Parser().TransferTopic),
+			common.BytesToHash(from.Bytes()),
+			common.BytesToHash(to.Bytes()),
+		},
+		Data:  wordOf(amount),
+		Index: index,
+	}
+}
+
+func TestParseFlashLoansV3Flash(t *testing.T) {
+	pool := common.HexToAddress("0x36696169C63e42cd08ce11f5deeBbCeBae652050")
+	borrower := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	dex := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	logs := []*types.Log{
+		transferLog(0, USDT.Address, pool, borrower, 1000),
+		// 借来的 USDT 去另一个池子做了一次交易
+		transferLog(1, USDT.Address, borrower, dex, 1000),
+		transferLog(2, WBNB.Address, dex, borrower, 3),
+		transferLog(3, WBNB.Address, borrower, dex, 3),
+		transferLog(4, USDT.Address, dex, borrower, 1001),
+		transferLog(5, USDT.Address, borrower, pool, 1001),
+		{
+			Address: pool,
+			Topics:  []common.Hash{v3FlashTopic, common.BytesToHash(borrower.Bytes()), common.BytesToHash(borrower.Bytes())},
+			Data:    append(append(append(wordOf(1000), wordOf(0)...), wordOf(1)...), wordOf(0)...),
+			Index:   6,
+		},
+	}
+
+	loans := ParseFlashLoans(logs)
+	if len(loans) != 1 {
+		t.Fatalf("expected 1 flash loan, got %d", len(loans))
+	}
+	loan := loans[0]
+	if loan.Token != USDT.Address || loan.Amount.Int64() != 1000 || loan.Repaid.Int64() != 1001 || loan.Fee.Int64() != 1 {
+		t.Fatalf("unexpected loan: %+v", loan)
+	}
+
+	changes, _ := CalculateTransactionTokenBalanceChanges(logs, &PrestateTxResult{})
+	// 本金被剔除、归还只保留手续费后，借款人在 dex 上赚的 1 USDT 刚好付了手续费
+	if got := changes[borrower]; got != nil && got.Tokens[USDT.Address] != nil && got.Tokens[USDT.Address].Sign() != 0 {
+		t.Fatalf("unexpected borrower USDT change: %v", got.Tokens[USDT.Address])
+	}
+	if got := changes[pool]; got == nil || got.Tokens[USDT.Address] == nil || got.Tokens[USDT.Address].Int64() != 1 {
+		t.Fatalf("lender should receive the fee: %+v", got)
+	}
+}
+
+func TestParseFlashLoansAaveV3(t *testing.T) {
+	aavePool := common.HexToAddress("0x6807dc923806fE8Fd134338EABCA509979a7e0cB")
+	aToken := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	borrower := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	logs := []*types.Log{
+		transferLog(0, USDT.Address, aToken, borrower, 5000),
+		transferLog(1, USDT.Address, borrower, aToken, 5025),
+		{
+			Address: aavePool,
+			Topics: []common.Hash{
+				aaveV3FlashLoanTopic,
+				common.BytesToHash(borrower.Bytes()),
+				common.BytesToHash(USDT.Address.Bytes()),
+				{},
+			},
+			Data:  append(append(append(common.LeftPadBytes(borrower.Bytes(), 32), wordOf(5000)...), wordOf(0)...), wordOf(25)...),
+			Index: 2,
+		},
+	}
+
+	changes, _ := CalculateTransactionTokenBalanceChanges(logs, &PrestateTxResult{})
+	loans := ParseFlashLoans(logs)
+	if len(loans) != 1 || loans[0].Fee.Int64() != 25 || loans[0].Repaid.Int64() != 5025 {
+		t.Fatalf("unexpected loans: %+v", loans)
+	}
+	// 只剩手续费从借款人转给 aToken
+	if len(changes) != 2 || changes[borrower].Tokens[USDT.Address].Int64() != -25 || changes[aToken].Tokens[USDT.Address].Int64() != 25 {
+		t.Fatalf("unexpected balance changes: %+v", changes)
+	}
+
+	// interestRateMode 非 0 时借款转为负债，借款人保留本金
+	debt := []*types.Log{
+		transferLog(0, USDT.Address, aToken, borrower, 5000),
+		{
+			Address: aavePool,
+			Topics:  logs[2].Topics,
+			Data:    append(append(append(common.LeftPadBytes(borrower.Bytes(), 32), wordOf(5000)...), wordOf(2)...), wordOf(0)...),
+			Index:   1,
+		},
+	}
+	changes, _ = CalculateTransactionTokenBalanceChanges(debt, &PrestateTxResult{})
+	if got := changes[borrower]; got == nil || got.Tokens[USDT.Address].Int64() != 5000 {
+		t.Fatalf("borrower should keep the principal: %+v", got)
+	}
+}
+
+func v2SwapLog(index uint, pair, to common.Address, amount0In, amount1In, amount0Out, amount1Out int64) *types.Log {
+	return &types.Log{
+		Address: pair,
+		Topics:  []common.Hash{v2SwapTopic, common.BytesToHash(to.Bytes()), common.BytesToHash(to.Bytes())},
+		Data:    append(append(append(wordOf(amount0In), wordOf(amount1In)...), wordOf(amount0Out)...), wordOf(amount1Out)...),
+		Index:   index,
+	}
+}
+
+func TestParseV2FlashSwapMatchesTokenSide(t *testing.T) {
+	pair := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	borrower := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	token0 := common.HexToAddress("0x0000000000000000000000000000000000000aaa")
+	token1 := common.HexToAddress("0x0000000000000000000000000000000000000bbb")
+
+	// 两边借出数量相同，代币按地址排序对应 token0/token1，每笔本金只能匹配一次
+	logs := []*types.Log{
+		transferLog(0, token1, pair, borrower, 100),
+		transferLog(1, token0, pair, borrower, 100),
+		transferLog(2, token0, borrower, pair, 101),
+		transferLog(3, token1, borrower, pair, 101),
+		v2SwapLog(4, pair, borrower, 101, 101, 100, 100),
+	}
+	loans := ParseFlashLoans(logs)
+	if len(loans) != 2 || loans[0].Token != token0 || loans[1].Token != token1 {
+		t.Fatalf("unexpected loans: %+v", loans)
+	}
+
+	changes, swapHashs := CalculateTransactionTokenBalanceChanges(logs, &PrestateTxResult{})
+	if len(swapHashs) != 0 {
+		t.Fatal("pure flash swap should not mark the transaction as swap")
+	}
+	// 每边 1 的手续费留在 pair
+	for _, token := range []common.Address{token0, token1} {
+		if changes[borrower].Tokens[token].Int64() != -1 || changes[pair].Tokens[token].Int64() != 1 {
+			t.Fatalf("unexpected fee changes for %s: %+v %+v", token, changes[borrower], changes[pair])
+		}
+	}
+}
+
+func TestMaxSwapVolumeExcludesFlashLoanPrincipal(t *testing.T) {
+	pool := common.HexToAddress("0x36696169C63e42cd08ce11f5deeBbCeBae652050")
+	pair := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	borrower := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	// 借 1,000,000 USDT，只拿其中 10 USDT 做了一笔兑换
+	logs := []*types.Log{
+		transferLog(0, USDT.Address, pool, borrower, 1000000),
+		transferLog(1, USDT.Address, borrower, pair, 10),
+		transferLog(2, WBNB.Address, pair, borrower, 1),
+		v2SwapLog(3, pair, borrower, 10, 0, 0, 1),
+		transferLog(4, USDT.Address, borrower, pool, 1000001),
+		{
+			Address: pool,
+			Topics:  []common.Hash{v3FlashTopic, common.BytesToHash(borrower.Bytes()), common.BytesToHash(borrower.Bytes())},
+			Data:    append(append(append(wordOf(1000000), wordOf(0)...), wordOf(1)...), wordOf(0)...),
+			Index:   5,
+		},
+	}
+	tokenPrice := map[common.Address]*TokenPrice{USDT.Address: {Price: 1, Decimal: 0}}
+	changes := CalculateTransactionVolume(logs, &TraceCall{})
+	// 借款人付出兑换的 10 USDT 和 1 USDT 手续费
+	if got := MaxSwapVolumeUSD(changes, tokenPrice); got != 11 {
+		t.Fatalf("expected volume without principal, got %v", got)
+	}
+}
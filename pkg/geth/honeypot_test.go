@@ -0,0 +1,198 @@
+package geth
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func simTransferLog(token, from, to common.Address, amount *big.Int) map[string]interface{} {
+	return map[string]interface{}{
+		"address": token,
+		"topics": []common.Hash{
+			common.HexToHash(NewERC20Parser().TransferTopic),
+			common.BytesToHash(from.Bytes()),
+			common.BytesToHash(to.Bytes()),
+		},
+		"data":     hexutil.Encode(common.LeftPadBytes(amount.Bytes(), 32)),
+		"logIndex": "0x0",
+	}
+}
+
+func simAmounts(amounts ...*big.Int) string {
+	data := common.LeftPadBytes(big.NewInt(32).Bytes(), 32)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(amounts))).Bytes(), 32)...)
+	for _, a := range amounts {
+		data = append(data, common.LeftPadBytes(a.Bytes(), 32)...)
+	}
+	return hexutil.Encode(data)
+}
+
+// fakeSimulator 按调用的方法选择器返回预设结果，模拟 PancakeV2 上买入税 10%、卖出税 60% 的代币
+type fakeSimulator struct {
+	token       common.Address
+	sellReverts bool
+	unsupported bool // 节点不支持 eth_simulateV1
+	requests    int
+}
+
+func (f *fakeSimulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests++
+	var req struct {
+		Method string `json:"method"`
+		Params []struct {
+			BlockStateCalls []struct {
+				Calls []struct {
+					To    common.Address `json:"to"`
+					Input hexutil.Bytes  `json:"input"`
+				} `json:"calls"`
+			} `json:"blockStateCalls"`
+			TraceTransfers bool `json:"traceTransfers"`
+		} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if f.unsupported {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0", "id": 1,
+			"error": map[string]interface{}{"code": -32601, "message": "the method eth_simulateV1 does not exist/is not available"},
+		})
+		return
+	}
+	if req.Method != "eth_simulateV1" || !req.Params[0].TraceTransfers {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	buyAmount := big.NewInt(1e16)
+	selector := func(sig string) string {
+		s := methodSelector(sig)
+		return hexutil.Encode(s[:])
+	}
+	results := make([]map[string]interface{}, 0)
+	for _, call := range req.Params[0].BlockStateCalls[0].Calls {
+		res := map[string]interface{}{"status": "0x1", "returnData": "0x", "logs": []interface{}{}, "gasUsed": "0x0"}
+		input := call.Input
+		switch hexutil.Encode(input[:4]) {
+		case selector("getAmountsOut(uint256,address[])"):
+			amountIn := new(big.Int).SetBytes(input[4:36])
+			if new(big.Int).SetBytes(input[4+3*32:4+4*32]).Cmp(WBNB.Address.Big()) == 0 {
+				res["returnData"] = simAmounts(amountIn, big.NewInt(1000)) // 买入报价
+			} else {
+				res["returnData"] = simAmounts(amountIn, big.NewInt(1e16)) // 卖出报价
+			}
+		case selector("swapExactETHForTokensSupportingFeeOnTransferTokens(uint256,address[],address,uint256)"),
+			selector("buyTokenAMAP(address,uint256,uint256)"):
+			res["logs"] = []interface{}{
+				simTransferLog(BNB.Address, honeypotTrader, PancakeV2Router, buyAmount),
+				simTransferLog(f.token, common.HexToAddress("0x8888"), honeypotTrader, big.NewInt(900)),
+			}
+		case selector("transfer(address,uint256)"):
+			res["logs"] = []interface{}{simTransferLog(f.token, honeypotTrader, honeypotSink, big.NewInt(90))}
+		case selector("swapExactTokensForETHSupportingFeeOnTransferTokens(uint256,uint256,address[],address,uint256)"):
+			if f.sellReverts {
+				res["status"] = "0x0"
+				res["error"] = map[string]interface{}{"code": 3, "message": "execution reverted: TRANSFER_FAILED"}
+			} else {
+				res["logs"] = []interface{}{simTransferLog(BNB.Address, PancakeV2Router, honeypotTrader, big.NewInt(4e15))}
+			}
+		case selector("sellToken(address,uint256)"):
+			res["logs"] = []interface{}{simTransferLog(BNB.Address, FourmemeTokenManager, honeypotTrader, big.NewInt(1))}
+		case selector("_maxTxAmount()"):
+			res["returnData"] = hexutil.Encode(common.LeftPadBytes(big.NewInt(5000).Bytes(), 32))
+		case selector("approve(address,uint256)"):
+		default:
+			res["status"] = "0x0"
+		}
+		results = append(results, res)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1,
+		"result": []interface{}{map[string]interface{}{"calls": results}},
+	})
+}
+
+func TestHoneypotAnalyzer(t *testing.T) {
+	token := common.HexToAddress("0x7777")
+	sim := &fakeSimulator{token: token}
+	server := httptest.NewServer(sim)
+	defer server.Close()
+
+	analyzer, err := NewHoneypotAnalyzer(server.URL, WithHoneypotWindow(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verdict, err := analyzer.Check(token, VenuePancakeV2, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict.Received.Int64() != 900 || verdict.BuyTax == nil || *verdict.BuyTax < 0.099 || *verdict.BuyTax > 0.101 {
+		t.Fatalf("unexpected buy result %+v", verdict)
+	}
+	if verdict.TransferTax == nil || *verdict.TransferTax != 0 || verdict.SellAmount.Int64() != 810 {
+		t.Fatalf("unexpected transfer result %+v", verdict)
+	}
+	if verdict.SellOut.Int64() != 4e15 || verdict.SellTax == nil || *verdict.SellTax < 0.599 || *verdict.SellTax > 0.601 {
+		t.Fatalf("unexpected sell result %+v", verdict)
+	}
+	if !verdict.Honeypot || verdict.Limits["_maxTxAmount()"].Int64() != 5000 || len(verdict.Limits) != 1 {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+
+	// 同一窗口内命中缓存
+	requests := sim.requests
+	if _, err := analyzer.Check(token, VenuePancakeV2, 1009); err != nil || sim.requests != requests {
+		t.Fatalf("expected cached verdict, requests %d -> %d", requests, sim.requests)
+	}
+
+	sim.sellReverts = true
+	verdict, err = analyzer.Check(token, VenuePancakeV2, 1010)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verdict.SellReverted || !verdict.Honeypot || verdict.Reason != "sell reverted" || verdict.SellError == "" {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+}
+
+func TestPackSelector(t *testing.T) {
+	data := packSelector("getAmountsOut(uint256,address[])", big.NewInt(5), []common.Address{WBNB.Address, USDT.Address})
+	args := abiArgs(data[4:])
+	if v, _ := args.uint(0); v.Int64() != 5 {
+		t.Fatalf("unexpected amount %v", v)
+	}
+	path, err := args.addresses(1)
+	if err != nil || len(path) != 2 || path[1] != USDT.Address {
+		t.Fatalf("unexpected path %v %v", path, err)
+	}
+}
+
+func TestHoneypotAnalyzerEdgeCases(t *testing.T) {
+	token := common.HexToAddress("0x7777")
+	sim := &fakeSimulator{token: token}
+	server := httptest.NewServer(sim)
+	defer server.Close()
+
+	// 买入数量很小时按比例折算的成本为 0，无法计算往返损失
+	analyzer, err := NewHoneypotAnalyzer(server.URL, WithHoneypotBuyAmount(big.NewInt(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verdict, err := analyzer.Check(token, VenueFourmeme, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict.SellTax != nil || verdict.RoundTripLoss != nil || verdict.Honeypot {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+
+	sim.unsupported = true
+	if _, err := analyzer.Check(token, VenuePancakeV2, 1000); !errors.Is(err, ErrSimulateV1Unavailable) {
+		t.Fatalf("expected ErrSimulateV1Unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package geth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ReconcileTx 一笔交易解释的余额变化。Actual 只有原生代币能按交易取得（prestate diff），ERC20 为 nil。
+type ReconcileTx struct {
+	TxHash    common.Hash `json:"tx_hash"`
+	Explained *big.Int    `json:"explained"`
+	Actual    *big.Int    `json:"actual,omitempty"`
+}
+
+// ReconcileBlock 余额变化与流水不一致的区块
+type ReconcileBlock struct {
+	BlockNumber uint64         `json:"block_number"`
+	Actual      *big.Int       `json:"actual"`
+	Explained   *big.Int       `json:"explained"`
+	Unexplained *big.Int       `json:"unexplained"` // Actual - Explained
+	Txs         []*ReconcileTx `json:"txs"`
+}
+
+// ReconcileReport 区间对账结果
+type ReconcileReport struct {
+	Address     common.Address    `json:"address"`
+	Token       common.Address    `json:"token"`
+	BlockBegin  uint64            `json:"block_begin"`
+	BlockEnd    uint64            `json:"block_end"`
+	Actual      *big.Int          `json:"actual"`    // 余额实际变化
+	Explained   *big.Int          `json:"explained"` // 事件/trace 流水解释的变化
+	Unexplained *big.Int          `json:"unexplained"`
+	Blocks      []*ReconcileBlock `json:"blocks"` // 按区块号排序
+	BalanceRPC  int               `json:"balance_rpc"`
+}
+
+// Balanced 流水能完整解释余额变化
+func (r *ReconcileReport) Balanced() bool {
+	return r.Unexplained.Sign() == 0
+}
+
+// txFlows block -> tx -> 该交易对余额的影响
+type txFlows map[uint64]map[common.Hash]*big.Int
+
+type reconciler struct {
+	// balanceAt 区块结束时的余额
+	balanceAt func(ctx context.Context, blockNumber uint64) (*big.Int, error)
+	// flows 区间内每个区块每笔交易的流水
+	flows func(ctx context.Context, blockBegin, blockEnd uint64) (txFlows, error)
+	// txActual 区块内每笔交易的实际余额变化，不支持时为 nil
+	txActual func(ctx context.Context, blockNumber uint64) (map[common.Hash]*big.Int, error)
+
+	balances map[uint64]*big.Int
+	calls    int
+}
+
+// Reconcile 对比 address 在 blockBegin..blockEnd（含两端，与 GetBalanceChange 一致）内的余额实际变化
+// 和由事件/trace 得到的流水，不一致时二分区间定位到具体区块和交易。
+// token 为空或零地址时对账原生代币：流水来自 callTracer（跳过失败的调用帧）和手续费，需要 rpcURL 支持 debug_ 接口，
+// 每个区块都要 trace 一次，适合较小的区间。ERC20 流水来自 Transfer/Deposit/Withdrawal 事件。
+func Reconcile(ctx context.Context, client *ethclient.Client, rpcURL, address, token string, blockBegin, blockEnd uint64) (*ReconcileReport, error) {
+	return ReconcileWithBackend(ctx, client, NewRPCBackend(client, rpcURL), address, token, blockBegin, blockEnd)
+}
+
+// ReconcileWithBackend 与 Reconcile 相同，原生代币的 trace、回执和 prestate diff 从 backend 读取（例如 archive.Backend），
+// 余额和 ERC20 事件仍然通过 client 查询。
+func ReconcileWithBackend(ctx context.Context, client *ethclient.Client, backend ChainBackend, address, token string, blockBegin, blockEnd uint64) (*ReconcileReport, error) {
+	if blockBegin == 0 || blockBegin > blockEnd {
+		return nil, fmt.Errorf("invalid block range %d..%d", blockBegin, blockEnd)
+	}
+	account := common.HexToAddress(address)
+	native := token == "" || token == "0x0000000000000000000000000000000000000000"
+
+	r := &reconciler{
+		balanceAt: func(ctx context.Context, blockNumber uint64) (*big.Int, error) {
+			return GetTokenBalanceAt(ctx, client, address, token, blockNumber)
+		},
+	}
+	tokenAddress := common.HexToAddress(token)
+	if native {
+		tokenAddress = BNB.Address
+		r.flows = func(ctx context.Context, blockBegin, blockEnd uint64) (txFlows, error) {
+			return nativeFlows(ctx, backend, account, blockBegin, blockEnd)
+		}
+		r.txActual = func(ctx context.Context, blockNumber uint64) (map[common.Hash]*big.Int, error) {
+			return nativeTxChanges(ctx, backend, account, blockNumber)
+		}
+	} else {
+		r.flows = func(ctx context.Context, blockBegin, blockEnd uint64) (txFlows, error) {
+			return erc20Flows(ctx, client, account, tokenAddress, blockBegin, blockEnd)
+		}
+	}
+
+	report, err := r.reconcile(ctx, blockBegin, blockEnd)
+	if err != nil {
+		return nil, err
+	}
+	report.Address = account
+	report.Token = tokenAddress
+	return report, nil
+}
+
+func (r *reconciler) balance(ctx context.Context, blockNumber uint64) (*big.Int, error) {
+	if r.balances == nil {
+		r.balances = make(map[uint64]*big.Int)
+	}
+	if b, ok := r.balances[blockNumber]; ok {
+		return b, nil
+	}
+	b, err := r.balanceAt(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	r.calls++
+	r.balances[blockNumber] = b
+	return b, nil
+}
+
+func (r *reconciler) actual(ctx context.Context, blockBegin, blockEnd uint64) (*big.Int, error) {
+	before, err := r.balance(ctx, blockBegin-1)
+	if err != nil {
+		return nil, err
+	}
+	after, err := r.balance(ctx, blockEnd)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Sub(after, before), nil
+}
+
+func (r *reconciler) reconcile(ctx context.Context, blockBegin, blockEnd uint64) (*ReconcileReport, error) {
+	flows, err := r.flows(ctx, blockBegin, blockEnd)
+	if err != nil {
+		return nil, err
+	}
+	explained := func(blockBegin, blockEnd uint64) *big.Int {
+		total := new(big.Int)
+		for blockNumber, txs := range flows {
+			if blockNumber < blockBegin || blockNumber > blockEnd {
+				continue
+			}
+			for _, v := range txs {
+				total.Add(total, v)
+			}
+		}
+		return total
+	}
+
+	actual, err := r.actual(ctx, blockBegin, blockEnd)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconcileReport{
+		BlockBegin: blockBegin,
+		BlockEnd:   blockEnd,
+		Actual:     actual,
+		Explained:  explained(blockBegin, blockEnd),
+		Blocks:     make([]*ReconcileBlock, 0),
+	}
+	report.Unexplained = new(big.Int).Sub(report.Actual, report.Explained)
+
+	// 差额为零的子区间不再细分；两个方向相反的差额恰好抵消时无法发现，这是二分的代价
+	var bisect func(lo, hi uint64, actual *big.Int) error
+	bisect = func(lo, hi uint64, actual *big.Int) error {
+		diff := new(big.Int).Sub(actual, explained(lo, hi))
+		if diff.Sign() == 0 {
+			return nil
+		}
+		if lo == hi {
+			block, err := r.block(ctx, lo, actual, flows[lo])
+			if err != nil {
+				return err
+			}
+			report.Blocks = append(report.Blocks, block)
+			return nil
+		}
+		mid := lo + (hi-lo)/2
+		left, err := r.actual(ctx, lo, mid)
+		if err != nil {
+			return err
+		}
+		if err := bisect(lo, mid, left); err != nil {
+			return err
+		}
+		return bisect(mid+1, hi, new(big.Int).Sub(actual, left))
+	}
+	if err := bisect(blockBegin, blockEnd, actual); err != nil {
+		return nil, err
+	}
+
+	report.BalanceRPC = r.calls
+	return report, nil
+}
+
+func (r *reconciler) block(ctx context.Context, blockNumber uint64, actual *big.Int, flows map[common.Hash]*big.Int) (*ReconcileBlock, error) {
+	block := &ReconcileBlock{
+		BlockNumber: blockNumber,
+		Actual:      actual,
+		Explained:   new(big.Int),
+		Txs:         make([]*ReconcileTx, 0),
+	}
+	txs := make(map[common.Hash]*ReconcileTx)
+	for txHash, v := range flows {
+		block.Explained.Add(block.Explained, v)
+		txs[txHash] = &ReconcileTx{TxHash: txHash, Explained: v}
+	}
+	block.Unexplained = new(big.Int).Sub(actual, block.Explained)
+
+	if r.txActual != nil {
+		changes, err := r.txActual(ctx, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		for txHash, v := range changes {
+			tx, ok := txs[txHash]
+			if !ok {
+				tx = &ReconcileTx{TxHash: txHash, Explained: new(big.Int)}
+				txs[txHash] = tx
+			}
+			tx.Actual = v
+		}
+	}
+
+	for _, tx := range txs {
+		// 有逐笔实际变化时只报告对不上的交易
+		if tx.Actual != nil && tx.Actual.Cmp(tx.Explained) == 0 {
+			continue
+		}
+		block.Txs = append(block.Txs, tx)
+	}
+	sort.Slice(block.Txs, func(i, j int) bool {
+		return block.Txs[i].TxHash.Hex() < block.Txs[j].TxHash.Hex()
+	})
+	return block, nil
+}
+
+// erc20Flows 查询与 account 相关的 Transfer/Deposit/Withdrawal 事件并按交易汇总净额
+func erc20Flows(ctx context.Context, client *ethclient.Client, account, token common.Address, blockBegin, blockEnd uint64) (txFlows, error) {
+	if tokenParser == nil {
+		tokenParser = NewERC20Parser()
+	}
+	transferTopic := common.HexToHash(tokenParser.TransferTopic)
+	accountTopic := common.BytesToHash(account.Bytes())
+
+	queries := []ethereum.FilterQuery{
+		{
+			Addresses: []common.Address{token},
+			Topics: [][]common.Hash{
+				{transferTopic, common.HexToHash(tokenParser.DepositTopic), common.HexToHash(tokenParser.WithdrawalTopic)},
+				{accountTopic},
+			},
+		},
+		{
+			Addresses: []common.Address{token},
+			Topics:    [][]common.Hash{{transferTopic}, nil, {accountTopic}},
+		},
+	}
+
+	type logKey struct {
+		txHash common.Hash
+		index  uint
+	}
+	seen := make(map[logKey]bool)
+	byTx := make(map[common.Hash][]*types.Log)
+	blockOf := make(map[common.Hash]uint64)
+	for _, query := range queries {
+		query.FromBlock = new(big.Int).SetUint64(blockBegin)
+		query.ToBlock = new(big.Int).SetUint64(blockEnd)
+		logs, err := client.FilterLogs(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for i := range logs {
+			l := &logs[i]
+			key := logKey{txHash: l.TxHash, index: l.Index}
+			if seen[key] || l.Removed {
+				continue
+			}
+			seen[key] = true
+			byTx[l.TxHash] = append(byTx[l.TxHash], l)
+			blockOf[l.TxHash] = l.BlockNumber
+		}
+	}
+
+	flows := make(txFlows)
+	for txHash, logs := range byTx {
+		tt := NewTransferTracker(txHash.Hex())
+		addLogTransfers(tt, logs)
+		flows.add(blockOf[txHash], txHash, tt.GetNetBalance(account, token))
+	}
+	return flows, nil
+}
+
+// nativeFlows trace 区间内每个区块，汇总 account 在成功调用帧中的原生代币收支以及作为发起方支付的手续费
+func nativeFlows(ctx context.Context, backend ChainBackend, account common.Address, blockBegin, blockEnd uint64) (txFlows, error) {
+	flows := make(txFlows)
+	for blockNumber := blockBegin; blockNumber <= blockEnd; blockNumber++ {
+		traces, err := backend.TraceBlock(ctx, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		receipts, err := backend.BlockReceipts(ctx, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		fees := make(map[common.Hash]*big.Int, len(receipts))
+		for _, receipt := range receipts {
+			fees[receipt.TxHash] = receiptGasFee(receipt)
+		}
+
+		for i := range traces {
+			trace := &traces[i]
+			txHash := common.HexToHash(trace.TxHash)
+			net := NewTransferTrackerFromTrace(trace.TxHash, trace.Root()).GetNetBalance(account, BNB.Address)
+			if common.HexToAddress(trace.Result.From) == account && fees[txHash] != nil {
+				net.Sub(net, fees[txHash])
+			}
+			flows.add(blockNumber, txHash, net)
+		}
+	}
+	return flows, nil
+}
+
+// nativeTxChanges 用 prestate diff 取得区块内每笔交易对 account 余额的实际影响
+func nativeTxChanges(ctx context.Context, backend ChainBackend, account common.Address, blockNumber uint64) (map[common.Hash]*big.Int, error) {
+	results, err := backend.TraceBlockForChange(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[common.Hash]*big.Int)
+	for i := range results {
+		change, ok := ParseNativeChange(&results[i])[account]
+		if !ok {
+			continue
+		}
+		changes[common.HexToHash(results[i].TxHash)] = change.Tokens[BNB.Address]
+	}
+	return changes, nil
+}
+
+func (f txFlows) add(blockNumber uint64, txHash common.Hash, v *big.Int) {
+	if v == nil || v.Sign() == 0 {
+		return
+	}
+	if _, ok := f[blockNumber]; !ok {
+		f[blockNumber] = make(map[common.Hash]*big.Int)
+	}
+	if existing, ok := f[blockNumber][txHash]; ok {
+		existing.Add(existing, v)
+		return
+	}
+	f[blockNumber][txHash] = new(big.Int).Set(v)
+}
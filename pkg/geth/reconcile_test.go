@@ -0,0 +1,78 @@
+package geth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestReconcilerBisect(t *testing.T) {
+	// 区块 1..16，每个区块余额 +10；区块 6 和 13 各有一笔没有对应流水的变化
+	deltas := make(map[uint64]int64)
+	flows := make(txFlows)
+	for b := uint64(1); b <= 16; b++ {
+		deltas[b] = 10
+		flows.add(b, common.BigToHash(new(big.Int).SetUint64(b)), big.NewInt(10))
+	}
+	deltas[6] += 3
+	deltas[13] -= 7
+
+	r := &reconciler{
+		balanceAt: func(ctx context.Context, blockNumber uint64) (*big.Int, error) {
+			total := int64(1000)
+			for b := uint64(1); b <= blockNumber; b++ {
+				total += deltas[b]
+			}
+			return big.NewInt(total), nil
+		},
+		flows: func(ctx context.Context, blockBegin, blockEnd uint64) (txFlows, error) {
+			return flows, nil
+		},
+	}
+
+	report, err := r.reconcile(context.Background(), 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Actual.Int64() != 156 || report.Explained.Int64() != 160 || report.Unexplained.Int64() != -4 {
+		t.Fatalf("unexpected totals: %s %s %s", report.Actual, report.Explained, report.Unexplained)
+	}
+	if len(report.Blocks) != 2 || report.Blocks[0].BlockNumber != 6 || report.Blocks[1].BlockNumber != 13 {
+		t.Fatalf("unexpected blocks: %+v", report.Blocks)
+	}
+	if report.Blocks[0].Unexplained.Int64() != 3 || report.Blocks[1].Unexplained.Int64() != -7 {
+		t.Fatalf("unexpected block deltas: %s %s", report.Blocks[0].Unexplained, report.Blocks[1].Unexplained)
+	}
+	if report.BalanceRPC >= 16 {
+		t.Fatalf("bisect should need fewer balance calls than blocks, got %d", report.BalanceRPC)
+	}
+}
+
+func TestNativeFlowsFromBackend(t *testing.T) {
+	account := common.HexToAddress("0x01")
+	pool := common.HexToAddress("0x02")
+	txHash := common.HexToHash("0xaa")
+
+	var trace BlockTraceResult
+	if err := json.Unmarshal([]byte(`{"txHash":"`+txHash.Hex()+`","result":{"from":"`+account.Hex()+`","to":"`+pool.Hex()+`","value":"0x64",`+
+		`"calls":[{"type":"CALL","from":"`+pool.Hex()+`","to":"`+account.Hex()+`","value":"0xa"}]}}`), &trace); err != nil {
+		t.Fatal(err)
+	}
+	backend := &memBackend{
+		receipts: map[uint64][]*types.Receipt{7: {{TxHash: txHash, GasUsed: 3, EffectiveGasPrice: big.NewInt(1)}}},
+		traces:   map[uint64][]BlockTraceResult{7: {trace}},
+	}
+
+	flows, err := nativeFlows(context.Background(), backend, account, 7, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 转出 100，收回 10，手续费 3
+	if got := flows[7][txHash]; got == nil || got.Int64() != -93 {
+		t.Fatalf("unexpected flow %v", got)
+	}
+}
@@ -0,0 +1,841 @@
+package geth
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SwapProtocol 路由类型
+type SwapProtocol string
+
+const (
+	ProtocolV2        SwapProtocol = "v2"
+	ProtocolV3        SwapProtocol = "v3"
+	ProtocolUniversal SwapProtocol = "universal"
+	ProtocolOneInch   SwapProtocol = "1inch"
+)
+
+var ErrUnknownSwapMethod = errors.New("unknown swap method")
+
+var (
+	// Universal Router 的特殊接收地址
+	universalMsgSender   = common.BigToAddress(big.NewInt(1))
+	universalAddressThis = common.BigToAddress(big.NewInt(2))
+	// universalContractBalance 作为 amountIn 时表示使用路由合约当前的余额
+	universalContractBalance = new(big.Int).Lsh(big.NewInt(1), 255)
+)
+
+// SwapIntent 从 calldata 解出的交易意图。ExactOut 为 false 时 AmountIn/AmountOutMin 有效，
+// 为 true 时 AmountOut/AmountInMax 有效。原生代币用 BNB.Address 表示。
+type SwapIntent struct {
+	Router       common.Address   `json:"router"`
+	Protocol     SwapProtocol     `json:"protocol"`
+	Method       string           `json:"method"`
+	Path         []common.Address `json:"path"`
+	Fees         []uint32         `json:"fees,omitempty"`  // V3 每一跳的费率（百万分之一）
+	Pools        []common.Address `json:"pools,omitempty"` // 1inch unoswap 经过的池子
+	TokenIn      common.Address   `json:"token_in"`
+	TokenOut     common.Address   `json:"token_out"` // 1inch unoswap 无法从 calldata 得知，为零地址
+	ExactOut     bool             `json:"exact_out"`
+	AmountIn     *big.Int         `json:"amount_in,omitempty"` // 使用合约余额时为 nil
+	AmountOutMin *big.Int         `json:"amount_out_min,omitempty"`
+	AmountOut    *big.Int         `json:"amount_out,omitempty"`
+	AmountInMax  *big.Int         `json:"amount_in_max,omitempty"`
+	Recipient    common.Address   `json:"recipient"` // 零地址表示 msg.sender
+	Deadline     uint64           `json:"deadline,omitempty"`
+}
+
+func (s *SwapIntent) setPath(path []common.Address, nativeIn, nativeOut bool) {
+	s.Path = path
+	if len(path) == 0 {
+		return
+	}
+	s.TokenIn, s.TokenOut = path[0], path[len(path)-1]
+	if nativeIn {
+		s.TokenIn = BNB.Address
+	}
+	if nativeOut {
+		s.TokenOut = BNB.Address
+	}
+}
+
+// DecodeSwapIntents 解析交易 calldata 中的兑换意图，multicall / Universal Router 可能包含多笔
+func DecodeSwapIntents(tx *types.Transaction) ([]*SwapIntent, error) {
+	if tx.To() == nil {
+		return nil, ErrUnknownSwapMethod
+	}
+	return DecodeSwapCalldata(*tx.To(), tx.Data(), tx.Value())
+}
+
+// DecodeSwapCalldata 按方法选择器解析路由 calldata，value 为交易附带的原生代币数量
+func DecodeSwapCalldata(router common.Address, data []byte, value *big.Int) ([]*SwapIntent, error) {
+	if len(data) < 4 {
+		return nil, ErrUnknownSwapMethod
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	var selector [4]byte
+	copy(selector[:], data[:4])
+	args := abiArgs(data[4:])
+
+	if decode, ok := batchMethods[selector]; ok {
+		return decode(router, args, value)
+	}
+	method, ok := routerMethods[selector]
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownSwapMethod, selector)
+	}
+	intent := &SwapIntent{Router: router, Protocol: method.protocol, Method: method.name}
+	if err := method.decode(args, value, intent); err != nil {
+		return nil, fmt.Errorf("%s: %w", method.name, err)
+	}
+	return []*SwapIntent{intent}, nil
+}
+
+type routerMethod struct {
+	name     string
+	protocol SwapProtocol
+	decode   func(args abiArgs, value *big.Int, intent *SwapIntent) error
+}
+
+type batchDecoder func(router common.Address, args abiArgs, value *big.Int) ([]*SwapIntent, error)
+
+var (
+	routerMethods = make(map[[4]byte]*routerMethod)
+	batchMethods  = make(map[[4]byte]batchDecoder)
+)
+
+func methodSelector(signature string) [4]byte {
+	var selector [4]byte
+	copy(selector[:], crypto.Keccak256([]byte(signature)))
+	return selector
+}
+
+func registerRouterMethod(signature string, protocol SwapProtocol, decode func(args abiArgs, value *big.Int, intent *SwapIntent) error) {
+	name := signature
+	for i, c := range signature {
+		if c == '(' {
+			name = signature[:i]
+			break
+		}
+	}
+	routerMethods[methodSelector(signature)] = &routerMethod{name: name, protocol: protocol, decode: decode}
+}
+
+func init() {
+	// V2 Router（PancakeSwap / Uniswap）
+	for _, m := range []struct {
+		name                string
+		exactOut, nativeOut bool
+	}{
+		{name: "swapExactTokensForTokens"},
+		{name: "swapExactTokensForTokensSupportingFeeOnTransferTokens"},
+		{name: "swapExactTokensForETH", nativeOut: true},
+		{name: "swapExactTokensForETHSupportingFeeOnTransferTokens", nativeOut: true},
+		{name: "swapTokensForExactTokens", exactOut: true},
+		{name: "swapTokensForExactETH", exactOut: true, nativeOut: true},
+	} {
+		registerRouterMethod(m.name+"(uint256,uint256,address[],address,uint256)", ProtocolV2, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+			return decodeV2(args, intent, m.exactOut, false, m.nativeOut, true)
+		})
+	}
+	// Smart Router 中没有 deadline 的 V2 兑换
+	registerRouterMethod("swapExactTokensForTokens(uint256,uint256,address[],address)", ProtocolV2, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV2(args, intent, false, false, false, false)
+	})
+	registerRouterMethod("swapTokensForExactTokens(uint256,uint256,address[],address)", ProtocolV2, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV2(args, intent, true, false, false, false)
+	})
+	for _, name := range []string{"swapExactETHForTokens", "swapExactETHForTokensSupportingFeeOnTransferTokens", "swapETHForExactTokens"} {
+		exactOut := name == "swapETHForExactTokens"
+		registerRouterMethod(name+"(uint256,address[],address,uint256)", ProtocolV2, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+			return decodeV2ETHIn(args, value, intent, exactOut)
+		})
+	}
+
+	// V3 SwapRouter（参数带 deadline）和 SwapRouter02 / Pancake Smart Router（deadline 在 multicall 上）
+	registerRouterMethod("exactInputSingle((address,address,uint24,address,uint256,uint256,uint256,uint160))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Single(args, intent, false, true)
+	})
+	registerRouterMethod("exactInputSingle((address,address,uint24,address,uint256,uint256,uint160))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Single(args, intent, false, false)
+	})
+	registerRouterMethod("exactOutputSingle((address,address,uint24,address,uint256,uint256,uint256,uint160))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Single(args, intent, true, true)
+	})
+	registerRouterMethod("exactOutputSingle((address,address,uint24,address,uint256,uint256,uint160))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Single(args, intent, true, false)
+	})
+	registerRouterMethod("exactInput((bytes,address,uint256,uint256,uint256))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Path(args, intent, false, true)
+	})
+	registerRouterMethod("exactInput((bytes,address,uint256,uint256))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Path(args, intent, false, false)
+	})
+	registerRouterMethod("exactOutput((bytes,address,uint256,uint256,uint256))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Path(args, intent, true, true)
+	})
+	registerRouterMethod("exactOutput((bytes,address,uint256,uint256))", ProtocolV3, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+		return decodeV3Path(args, intent, true, false)
+	})
+
+	// 1inch：V6 swap / V5 swap（带 permit）以及 V6 unoswap 系列（Address 类型在 ABI 中是 uint256）
+	registerRouterMethod("swap(address,(address,address,address,address,uint256,uint256,uint256),bytes)", ProtocolOneInch, decodeOneInchSwap)
+	registerRouterMethod("swap(address,(address,address,address,address,uint256,uint256,uint256),bytes,bytes)", ProtocolOneInch, decodeOneInchSwap)
+	for i, sig := range []string{
+		"unoswap(uint256,uint256,uint256,uint256)",
+		"unoswap2(uint256,uint256,uint256,uint256,uint256)",
+		"unoswap3(uint256,uint256,uint256,uint256,uint256,uint256)",
+	} {
+		pools := i + 1
+		registerRouterMethod(sig, ProtocolOneInch, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+			return decodeUnoswap(args, value, intent, pools, false)
+		})
+	}
+	for i, sig := range []string{
+		"ethUnoswap(uint256,uint256)",
+		"ethUnoswap2(uint256,uint256,uint256)",
+		"ethUnoswap3(uint256,uint256,uint256,uint256)",
+	} {
+		pools := i + 1
+		registerRouterMethod(sig, ProtocolOneInch, func(args abiArgs, value *big.Int, intent *SwapIntent) error {
+			return decodeUnoswap(args, value, intent, pools, true)
+		})
+	}
+
+	batchMethods[methodSelector("multicall(bytes[])")] = func(router common.Address, args abiArgs, value *big.Int) ([]*SwapIntent, error) {
+		return decodeMulticall(router, args, 0, value, 0)
+	}
+	batchMethods[methodSelector("multicall(uint256,bytes[])")] = func(router common.Address, args abiArgs, value *big.Int) ([]*SwapIntent, error) {
+		deadline, err := args.uint64(0)
+		if err != nil {
+			return nil, err
+		}
+		return decodeMulticall(router, args, 1, value, deadline)
+	}
+	// Pancake Smart Router：multicall(bytes32 previousBlockhash, bytes[] data)
+	batchMethods[methodSelector("multicall(bytes32,bytes[])")] = func(router common.Address, args abiArgs, value *big.Int) ([]*SwapIntent, error) {
+		return decodeMulticall(router, args, 1, value, 0)
+	}
+	batchMethods[methodSelector("execute(bytes,bytes[],uint256)")] = func(router common.Address, args abiArgs, value *big.Int) ([]*SwapIntent, error) {
+		deadline, err := args.uint64(2)
+		if err != nil {
+			return nil, err
+		}
+		return decodeUniversal(router, args, value, deadline)
+	}
+	batchMethods[methodSelector("execute(bytes,bytes[])")] = func(router common.Address, args abiArgs, value *big.Int) ([]*SwapIntent, error) {
+		return decodeUniversal(router, args, value, 0)
+	}
+}
+
+// decodeV2 (amountIn|amountOut, amountOutMin|amountInMax, path, to[, deadline])
+func decodeV2(args abiArgs, intent *SwapIntent, exactOut, nativeIn, nativeOut, hasDeadline bool) error {
+	a0, err := args.uint(0)
+	if err != nil {
+		return err
+	}
+	a1, err := args.uint(1)
+	if err != nil {
+		return err
+	}
+	path, err := args.addresses(2)
+	if err != nil {
+		return err
+	}
+	if intent.Recipient, err = args.address(3); err != nil {
+		return err
+	}
+	if hasDeadline {
+		if intent.Deadline, err = args.uint64(4); err != nil {
+			return err
+		}
+	}
+	intent.ExactOut = exactOut
+	if exactOut {
+		intent.AmountOut, intent.AmountInMax = a0, a1
+	} else {
+		intent.AmountIn, intent.AmountOutMin = a0, a1
+	}
+	intent.setPath(path, nativeIn, nativeOut)
+	return nil
+}
+
+// decodeV2ETHIn (amountOutMin|amountOut, path, to, deadline)，输入数量为交易的 value
+func decodeV2ETHIn(args abiArgs, value *big.Int, intent *SwapIntent, exactOut bool) error {
+	amount, err := args.uint(0)
+	if err != nil {
+		return err
+	}
+	path, err := args.addresses(1)
+	if err != nil {
+		return err
+	}
+	if intent.Recipient, err = args.address(2); err != nil {
+		return err
+	}
+	if intent.Deadline, err = args.uint64(3); err != nil {
+		return err
+	}
+	intent.ExactOut = exactOut
+	if exactOut {
+		intent.AmountOut, intent.AmountInMax = amount, new(big.Int).Set(value)
+	} else {
+		intent.AmountIn, intent.AmountOutMin = new(big.Int).Set(value), amount
+	}
+	intent.setPath(path, true, false)
+	return nil
+}
+
+// decodeV3Single 静态 tuple：(tokenIn, tokenOut, fee, recipient[, deadline], amount, limit, sqrtPriceLimitX96)
+func decodeV3Single(args abiArgs, intent *SwapIntent, exactOut, hasDeadline bool) error {
+	tokenIn, err := args.address(0)
+	if err != nil {
+		return err
+	}
+	tokenOut, err := args.address(1)
+	if err != nil {
+		return err
+	}
+	fee, err := args.uint64(2)
+	if err != nil {
+		return err
+	}
+	if intent.Recipient, err = args.address(3); err != nil {
+		return err
+	}
+	next := 4
+	if hasDeadline {
+		if intent.Deadline, err = args.uint64(4); err != nil {
+			return err
+		}
+		next = 5
+	}
+	a0, err := args.uint(next)
+	if err != nil {
+		return err
+	}
+	a1, err := args.uint(next + 1)
+	if err != nil {
+		return err
+	}
+	intent.ExactOut = exactOut
+	if exactOut {
+		intent.AmountOut, intent.AmountInMax = a0, a1
+	} else {
+		intent.AmountIn, intent.AmountOutMin = a0, a1
+	}
+	intent.Fees = []uint32{uint32(fee)}
+	intent.setPath([]common.Address{tokenIn, tokenOut}, false, false)
+	return nil
+}
+
+// decodeV3Path 动态 tuple：(path, recipient[, deadline], amount, limit)
+func decodeV3Path(args abiArgs, intent *SwapIntent, exactOut, hasDeadline bool) error {
+	params, err := args.tuple(0)
+	if err != nil {
+		return err
+	}
+	encoded, err := params.bytes(0)
+	if err != nil {
+		return err
+	}
+	if intent.Recipient, err = params.address(1); err != nil {
+		return err
+	}
+	next := 2
+	if hasDeadline {
+		if intent.Deadline, err = params.uint64(2); err != nil {
+			return err
+		}
+		next = 3
+	}
+	a0, err := params.uint(next)
+	if err != nil {
+		return err
+	}
+	a1, err := params.uint(next + 1)
+	if err != nil {
+		return err
+	}
+	path, fees, err := DecodeV3Path(encoded)
+	if err != nil {
+		return err
+	}
+	intent.ExactOut = exactOut
+	if exactOut {
+		// exactOutput 的路径从输出代币开始
+		reverseAddresses(path)
+		reverseFees(fees)
+		intent.AmountOut, intent.AmountInMax = a0, a1
+	} else {
+		intent.AmountIn, intent.AmountOutMin = a0, a1
+	}
+	intent.Fees = fees
+	intent.setPath(path, false, false)
+	return nil
+}
+
+// DecodeV3Path 解析 V3 编码路径：token(20) + [fee(3) + token(20)]...
+func DecodeV3Path(encoded []byte) ([]common.Address, []uint32, error) {
+	if len(encoded) < 20+3+20 || (len(encoded)-20)%23 != 0 {
+		return nil, nil, fmt.Errorf("invalid v3 path length %d", len(encoded))
+	}
+	hops := (len(encoded) - 20) / 23
+	path := make([]common.Address, 0, hops+1)
+	fees := make([]uint32, 0, hops)
+	path = append(path, common.BytesToAddress(encoded[:20]))
+	for i := 0; i < hops; i++ {
+		off := 20 + i*23
+		fees = append(fees, uint32(encoded[off])<<16|uint32(encoded[off+1])<<8|uint32(encoded[off+2]))
+		path = append(path, common.BytesToAddress(encoded[off+3:off+23]))
+	}
+	return path, fees, nil
+}
+
+// decodeOneInchSwap (executor, (srcToken, dstToken, srcReceiver, dstReceiver, amount, minReturnAmount, flags), ...)
+func decodeOneInchSwap(args abiArgs, value *big.Int, intent *SwapIntent) error {
+	src, err := args.address(1)
+	if err != nil {
+		return err
+	}
+	dst, err := args.address(2)
+	if err != nil {
+		return err
+	}
+	if intent.Recipient, err = args.address(4); err != nil {
+		return err
+	}
+	if intent.AmountIn, err = args.uint(5); err != nil {
+		return err
+	}
+	if intent.AmountOutMin, err = args.uint(6); err != nil {
+		return err
+	}
+	intent.setPath([]common.Address{src, dst}, false, false)
+	return nil
+}
+
+// decodeUnoswap unoswap(token, amount, minReturn, dex...) / ethUnoswap(minReturn, dex...)，
+// Address 的低 160 位是地址，高位是标志位
+func decodeUnoswap(args abiArgs, value *big.Int, intent *SwapIntent, pools int, nativeIn bool) error {
+	next := 0
+	if nativeIn {
+		intent.TokenIn = BNB.Address
+		intent.AmountIn = new(big.Int).Set(value)
+	} else {
+		token, err := args.address(0)
+		if err != nil {
+			return err
+		}
+		intent.TokenIn = token
+		if intent.AmountIn, err = args.uint(1); err != nil {
+			return err
+		}
+		next = 2
+	}
+	minReturn, err := args.uint(next)
+	if err != nil {
+		return err
+	}
+	intent.AmountOutMin = minReturn
+	for i := 0; i < pools; i++ {
+		pool, err := args.address(next + 1 + i)
+		if err != nil {
+			return err
+		}
+		intent.Pools = append(intent.Pools, pool)
+	}
+	intent.Path = []common.Address{intent.TokenIn}
+	return nil
+}
+
+// decodeMulticall 解析 multicall 中的每个调用，multicall 的 deadline 作用于没有自带 deadline 的兑换
+func decodeMulticall(router common.Address, args abiArgs, dataIndex int, value *big.Int, deadline uint64) ([]*SwapIntent, error) {
+	calls, err := args.bytesArray(dataIndex)
+	if err != nil {
+		return nil, err
+	}
+	intents := make([]*SwapIntent, 0, len(calls))
+	for _, call := range calls {
+		decoded, err := DecodeSwapCalldata(router, call, value)
+		if errors.Is(err, ErrUnknownSwapMethod) {
+			continue // refundETH / unwrapWETH9 / sweepToken 等
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, intent := range decoded {
+			if intent.Deadline == 0 {
+				intent.Deadline = deadline
+			}
+		}
+		intents = append(intents, decoded...)
+	}
+	return intents, nil
+}
+
+// Universal Router 命令，高位是 allow revert 标志
+const (
+	universalCommandMask    = 0x3f
+	universalV3SwapExactIn  = 0x00
+	universalV3SwapExactOut = 0x01
+	universalV2SwapExactIn  = 0x08
+	universalV2SwapExactOut = 0x09
+	universalWrapETH        = 0x0b
+	universalUnwrapWETH     = 0x0c
+)
+
+// decodeUniversal execute(commands, inputs[, deadline])，只解析 V2/V3 兑换命令。
+// 有 WRAP_ETH 时以 WBNB 开头的兑换视为原生代币输入，有 UNWRAP_WETH 时以 WBNB 结尾的兑换视为原生代币输出。
+func decodeUniversal(router common.Address, args abiArgs, value *big.Int, deadline uint64) ([]*SwapIntent, error) {
+	commands, err := args.bytes(0)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := args.bytesArray(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) != len(commands) {
+		return nil, fmt.Errorf("execute: %d commands but %d inputs", len(commands), len(inputs))
+	}
+
+	var wrap, unwrap bool
+	intents := make([]*SwapIntent, 0)
+	for i, c := range commands {
+		command := c & universalCommandMask
+		input := abiArgs(inputs[i])
+		var intent *SwapIntent
+		switch command {
+		case universalWrapETH:
+			wrap = true
+		case universalUnwrapWETH:
+			unwrap = true
+		case universalV3SwapExactIn, universalV3SwapExactOut:
+			intent, err = decodeUniversalV3(input, command == universalV3SwapExactOut)
+		case universalV2SwapExactIn, universalV2SwapExactOut:
+			intent, err = decodeUniversalV2(input, command == universalV2SwapExactOut)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("execute command %d (0x%02x): %w", i, command, err)
+		}
+		if intent == nil {
+			continue
+		}
+		intent.Router = router
+		intent.Protocol = ProtocolUniversal
+		intent.Deadline = deadline
+		if intent.AmountIn != nil && intent.AmountIn.Cmp(universalContractBalance) == 0 {
+			intent.AmountIn = nil
+		}
+		if intent.Recipient == universalAddressThis {
+			intent.Recipient = router
+		} else if intent.Recipient == universalMsgSender {
+			intent.Recipient = common.Address{}
+		}
+		intents = append(intents, intent)
+	}
+	for _, intent := range intents {
+		if wrap && intent.Path[0] == WBNB.Address {
+			intent.TokenIn = BNB.Address
+		}
+		if unwrap && intent.Path[len(intent.Path)-1] == WBNB.Address {
+			intent.TokenOut = BNB.Address
+		}
+	}
+	return intents, nil
+}
+
+// decodeUniversalV3 (recipient, amount, limit, path, payerIsUser)
+func decodeUniversalV3(input abiArgs, exactOut bool) (*SwapIntent, error) {
+	intent := &SwapIntent{Method: "V3_SWAP_EXACT_IN"}
+	if exactOut {
+		intent.Method = "V3_SWAP_EXACT_OUT"
+	}
+	var err error
+	if intent.Recipient, err = input.address(0); err != nil {
+		return nil, err
+	}
+	a0, err := input.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	a1, err := input.uint(2)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := input.bytes(3)
+	if err != nil {
+		return nil, err
+	}
+	path, fees, err := DecodeV3Path(encoded)
+	if err != nil {
+		return nil, err
+	}
+	intent.ExactOut = exactOut
+	if exactOut {
+		reverseAddresses(path)
+		reverseFees(fees)
+		intent.AmountOut, intent.AmountInMax = a0, a1
+	} else {
+		intent.AmountIn, intent.AmountOutMin = a0, a1
+	}
+	intent.Fees = fees
+	intent.setPath(path, false, false)
+	return intent, nil
+}
+
+// decodeUniversalV2 (recipient, amount, limit, path, payerIsUser)
+func decodeUniversalV2(input abiArgs, exactOut bool) (*SwapIntent, error) {
+	intent := &SwapIntent{Method: "V2_SWAP_EXACT_IN"}
+	if exactOut {
+		intent.Method = "V2_SWAP_EXACT_OUT"
+	}
+	var err error
+	if intent.Recipient, err = input.address(0); err != nil {
+		return nil, err
+	}
+	a0, err := input.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	a1, err := input.uint(2)
+	if err != nil {
+		return nil, err
+	}
+	path, err := input.addresses(3)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) < 2 {
+		return nil, fmt.Errorf("invalid v2 path length %d", len(path))
+	}
+	intent.ExactOut = exactOut
+	if exactOut {
+		intent.AmountOut, intent.AmountInMax = a0, a1
+	} else {
+		intent.AmountIn, intent.AmountOutMin = a0, a1
+	}
+	intent.setPath(path, false, false)
+	return intent, nil
+}
+
+func reverseAddresses(s []common.Address) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+func reverseFees(s []uint32) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// SwapExecution 兑换意图与实际结果的对比
+type SwapExecution struct {
+	Intent    *SwapIntent `json:"intent"`
+	AmountIn  *big.Int    `json:"amount_in"`  // 实际支付
+	AmountOut *big.Int    `json:"amount_out"` // 实际收到
+	// Headroom 离滑点限制还剩多少：ExactIn 为 AmountOut - AmountOutMin，ExactOut 为 AmountInMax - AmountIn
+	Headroom *big.Int `json:"headroom"`
+	// Slippage 实际成交相对限制的余量比例：ExactIn 为 Headroom / AmountOut，ExactOut 为 Headroom / AmountInMax。
+	// 接近 0 说明成交价贴着滑点上限，为负说明限制没有生效（例如收款地址不是 recipient）
+	Slippage float64 `json:"slippage"`
+}
+
+// MeasureSwap 用交易的转账记录计算兑换的实际输入输出，sender 为交易发起方。
+// 原生代币的收付只出现在调用帧中，涉及原生代币时 tracker 需要用 NewTransferTrackerFromTrace 构建。
+// multicall 中有多笔兑换时，同一代币的收支会合并计算。
+func MeasureSwap(intent *SwapIntent, tracker *TransferTracker, sender common.Address) *SwapExecution {
+	recipient := intent.Recipient
+	if recipient == (common.Address{}) || recipient == intent.Router {
+		recipient = sender
+	}
+
+	tokenOut := intent.TokenOut
+	if tokenOut == (common.Address{}) {
+		tokenOut = largestIncoming(tracker, recipient, intent.TokenIn)
+	}
+
+	exec := &SwapExecution{
+		Intent:    intent,
+		AmountIn:  new(big.Int).Neg(tracker.GetNetBalance(sender, intent.TokenIn)),
+		AmountOut: tracker.GetNetBalance(recipient, tokenOut),
+	}
+	if exec.AmountIn.Sign() < 0 {
+		exec.AmountIn.SetInt64(0)
+	}
+
+	var limit, base *big.Int
+	if intent.ExactOut {
+		if intent.AmountInMax != nil {
+			exec.Headroom = new(big.Int).Sub(intent.AmountInMax, exec.AmountIn)
+			limit, base = exec.Headroom, intent.AmountInMax
+		}
+	} else if intent.AmountOutMin != nil {
+		exec.Headroom = new(big.Int).Sub(exec.AmountOut, intent.AmountOutMin)
+		limit, base = exec.Headroom, exec.AmountOut
+	}
+	if limit != nil && base != nil && base.Sign() > 0 {
+		exec.Slippage, _ = new(big.Float).Quo(new(big.Float).SetInt(limit), new(big.Float).SetInt(base)).Float64()
+	}
+	return exec
+}
+
+// largestIncoming 账户净收入最多的代币（不同代币精度不同，只在无法从 calldata 得知输出代币时使用）
+func largestIncoming(tracker *TransferTracker, account, exclude common.Address) common.Address {
+	var best common.Address
+	var bestAmount *big.Int
+	for token, net := range tracker.NetBalances()[account] {
+		if token == exclude || net.Sign() <= 0 {
+			continue
+		}
+		if bestAmount == nil || net.Cmp(bestAmount) > 0 {
+			best, bestAmount = token, net
+		}
+	}
+	return best
+}
+
+// abiArgs 去掉方法选择器后的 ABI 编码参数，按 32 字节的字读取
+type abiArgs []byte
+
+func (a abiArgs) word(i int) ([]byte, error) {
+	if i < 0 || len(a) < (i+1)*32 {
+		return nil, fmt.Errorf("calldata too short for word %d", i)
+	}
+	return a[i*32 : (i+1)*32], nil
+}
+
+func (a abiArgs) uint(i int) (*big.Int, error) {
+	w, err := a.word(i)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(w), nil
+}
+
+func (a abiArgs) uint64(i int) (uint64, error) {
+	v, err := a.uint(i)
+	if err != nil {
+		return 0, err
+	}
+	if !v.IsUint64() {
+		return 0, fmt.Errorf("word %d overflows uint64", i)
+	}
+	return v.Uint64(), nil
+}
+
+func (a abiArgs) address(i int) (common.Address, error) {
+	w, err := a.word(i)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(w[12:]), nil
+}
+
+// offset 第 i 个字是动态参数相对参数起点的偏移
+func (a abiArgs) offset(i int) (int, error) {
+	v, err := a.uint64(i)
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(len(a)) {
+		return 0, fmt.Errorf("offset %d out of range", v)
+	}
+	return int(v), nil
+}
+
+// tuple 动态 tuple，内部偏移相对 tuple 起点
+func (a abiArgs) tuple(i int) (abiArgs, error) {
+	off, err := a.offset(i)
+	if err != nil {
+		return nil, err
+	}
+	return a[off:], nil
+}
+
+// length 动态参数的长度字及其后的数据
+func (a abiArgs) length(i int) (int, abiArgs, error) {
+	off, err := a.offset(i)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := a[off:]
+	n, err := body.uint64(0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n > uint64(len(body)) {
+		return 0, nil, fmt.Errorf("length %d out of range", n)
+	}
+	return int(n), body[32:], nil
+}
+
+func (a abiArgs) bytes(i int) ([]byte, error) {
+	n, data, err := a.length(i)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < n {
+		return nil, fmt.Errorf("bytes length %d out of range", n)
+	}
+	return data[:n], nil
+}
+
+func (a abiArgs) addresses(i int) ([]common.Address, error) {
+	n, data, err := a.length(i)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]common.Address, 0, n)
+	for j := 0; j < n; j++ {
+		addr, err := data.address(j)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, addr)
+	}
+	return list, nil
+}
+
+func (a abiArgs) uints(i int) ([]*big.Int, error) {
+	n, data, err := a.length(i)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*big.Int, 0, n)
+	for j := 0; j < n; j++ {
+		v, err := data.uint(j)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// bytesArray bytes[]：长度之后是每个元素相对元素区起点的偏移
+func (a abiArgs) bytesArray(i int) ([][]byte, error) {
+	n, data, err := a.length(i)
+	if err != nil {
+		return nil, err
+	}
+	list := make([][]byte, 0, n)
+	for j := 0; j < n; j++ {
+		b, err := data.bytes(j)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, b)
+	}
+	return list, nil
+}
@@ -0,0 +1,253 @@
+package geth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func mustType(t *testing.T, typ string, components ...abi.ArgumentMarshaling) abi.Type {
+	t.Helper()
+	ty, err := abi.NewType(typ, "", components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ty
+}
+
+// packCall 用 go-ethereum 的 abi 编码 calldata，与手写的解码器交叉验证
+func packCall(t *testing.T, signature string, types []abi.Type, values ...interface{}) []byte {
+	t.Helper()
+	args := make(abi.Arguments, len(types))
+	for i, ty := range types {
+		args[i] = abi.Argument{Type: ty}
+	}
+	packed, err := args.Pack(values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector := methodSelector(signature)
+	return append(selector[:], packed...)
+}
+
+func encodeV3Path(tokens []common.Address, fees []uint32) []byte {
+	out := append([]byte{}, tokens[0].Bytes()...)
+	for i, fee := range fees {
+		out = append(out, byte(fee>>16), byte(fee>>8), byte(fee))
+		out = append(out, tokens[i+1].Bytes()...)
+	}
+	return out
+}
+
+var (
+	testTokenA = common.HexToAddress("0xaaaa000000000000000000000000000000000001")
+	testTokenB = common.HexToAddress("0xbbbb000000000000000000000000000000000002")
+	testUser   = common.HexToAddress("0xcccc000000000000000000000000000000000003")
+	testRouter = common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E")
+)
+
+func TestDecodeV2Swap(t *testing.T) {
+	uint256 := mustType(t, "uint256")
+	data := packCall(t, "swapExactTokensForETH(uint256,uint256,address[],address,uint256)",
+		[]abi.Type{uint256, uint256, mustType(t, "address[]"), mustType(t, "address"), uint256},
+		big.NewInt(1000), big.NewInt(990), []common.Address{testTokenA, WBNB.Address}, testUser, big.NewInt(1700000000))
+
+	intents, err := DecodeSwapCalldata(testRouter, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intent := intents[0]
+	if intent.Protocol != ProtocolV2 || intent.Method != "swapExactTokensForETH" {
+		t.Fatalf("unexpected method %+v", intent)
+	}
+	if intent.TokenIn != testTokenA || intent.TokenOut != BNB.Address || len(intent.Path) != 2 {
+		t.Fatalf("unexpected route %+v", intent)
+	}
+	if intent.AmountIn.Int64() != 1000 || intent.AmountOutMin.Int64() != 990 || intent.Recipient != testUser || intent.Deadline != 1700000000 {
+		t.Fatalf("unexpected amounts %+v", intent)
+	}
+
+	data = packCall(t, "swapExactETHForTokens(uint256,address[],address,uint256)",
+		[]abi.Type{uint256, mustType(t, "address[]"), mustType(t, "address"), uint256},
+		big.NewInt(5), []common.Address{WBNB.Address, testTokenB}, testUser, big.NewInt(1))
+	intents, err = DecodeSwapCalldata(testRouter, data, big.NewInt(77))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intents[0].TokenIn != BNB.Address || intents[0].AmountIn.Int64() != 77 || intents[0].AmountOutMin.Int64() != 5 {
+		t.Fatalf("unexpected eth-in intent %+v", intents[0])
+	}
+}
+
+func TestDecodeV3Multicall(t *testing.T) {
+	uint256 := mustType(t, "uint256")
+	single := packCall(t, "exactInputSingle((address,address,uint24,address,uint256,uint256,uint160))",
+		[]abi.Type{mustType(t, "tuple",
+			abi.ArgumentMarshaling{Name: "tokenIn", Type: "address"},
+			abi.ArgumentMarshaling{Name: "tokenOut", Type: "address"},
+			abi.ArgumentMarshaling{Name: "fee", Type: "uint24"},
+			abi.ArgumentMarshaling{Name: "recipient", Type: "address"},
+			abi.ArgumentMarshaling{Name: "amountIn", Type: "uint256"},
+			abi.ArgumentMarshaling{Name: "amountOutMinimum", Type: "uint256"},
+			abi.ArgumentMarshaling{Name: "sqrtPriceLimitX96", Type: "uint160"},
+		)},
+		struct {
+			TokenIn           common.Address
+			TokenOut          common.Address
+			Fee               *big.Int
+			Recipient         common.Address
+			AmountIn          *big.Int
+			AmountOutMinimum  *big.Int
+			SqrtPriceLimitX96 *big.Int
+		}{testTokenA, testTokenB, big.NewInt(500), testUser, big.NewInt(100), big.NewInt(95), big.NewInt(0)})
+
+	path := encodeV3Path([]common.Address{testTokenB, WBNB.Address, testTokenA}, []uint32{100, 2500})
+	exactOut := packCall(t, "exactOutput((bytes,address,uint256,uint256))",
+		[]abi.Type{mustType(t, "tuple",
+			abi.ArgumentMarshaling{Name: "path", Type: "bytes"},
+			abi.ArgumentMarshaling{Name: "recipient", Type: "address"},
+			abi.ArgumentMarshaling{Name: "amountOut", Type: "uint256"},
+			abi.ArgumentMarshaling{Name: "amountInMaximum", Type: "uint256"},
+		)},
+		struct {
+			Path            []byte
+			Recipient       common.Address
+			AmountOut       *big.Int
+			AmountInMaximum *big.Int
+		}{path, testUser, big.NewInt(10), big.NewInt(12)})
+
+	refund := methodSelector("refundETH()")
+	data := packCall(t, "multicall(uint256,bytes[])",
+		[]abi.Type{uint256, mustType(t, "bytes[]")},
+		big.NewInt(1800000000), [][]byte{single, exactOut, refund[:]})
+
+	intents, err := DecodeSwapCalldata(testRouter, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intents) != 2 {
+		t.Fatalf("expected 2 intents, got %d", len(intents))
+	}
+	in := intents[0]
+	if in.TokenIn != testTokenA || in.TokenOut != testTokenB || in.Fees[0] != 500 || in.AmountIn.Int64() != 100 || in.Deadline != 1800000000 {
+		t.Fatalf("unexpected exactInputSingle %+v", in)
+	}
+	out := intents[1]
+	// exactOutput 的编码路径从输出代币开始，解码后按兑换方向排列
+	if !out.ExactOut || out.TokenIn != testTokenA || out.TokenOut != testTokenB || out.Path[1] != WBNB.Address {
+		t.Fatalf("unexpected exactOutput route %+v", out)
+	}
+	if out.Fees[0] != 2500 || out.Fees[1] != 100 || out.AmountOut.Int64() != 10 || out.AmountInMax.Int64() != 12 {
+		t.Fatalf("unexpected exactOutput amounts %+v", out)
+	}
+}
+
+func TestDecodeUniversalRouter(t *testing.T) {
+	uint256 := mustType(t, "uint256")
+	address := mustType(t, "address")
+	boolean := mustType(t, "bool")
+
+	wrap, _ := abi.Arguments{{Type: address}, {Type: uint256}}.Pack(universalAddressThis, big.NewInt(1e18))
+	v3, _ := abi.Arguments{{Type: address}, {Type: uint256}, {Type: uint256}, {Type: mustType(t, "bytes")}, {Type: boolean}}.Pack(
+		universalMsgSender, universalContractBalance, big.NewInt(300), encodeV3Path([]common.Address{WBNB.Address, testTokenA}, []uint32{2500}), false)
+	v2, _ := abi.Arguments{{Type: address}, {Type: uint256}, {Type: uint256}, {Type: mustType(t, "address[]")}, {Type: boolean}}.Pack(
+		testUser, big.NewInt(50), big.NewInt(40), []common.Address{testTokenA, testTokenB}, true)
+
+	// 0x0b WRAP_ETH, 0x80|0x00 V3_SWAP_EXACT_IN（allow revert）, 0x08 V2_SWAP_EXACT_IN
+	data := packCall(t, "execute(bytes,bytes[],uint256)",
+		[]abi.Type{mustType(t, "bytes"), mustType(t, "bytes[]"), uint256},
+		[]byte{0x0b, 0x80, 0x08}, [][]byte{wrap, v3, v2}, big.NewInt(1900000000))
+
+	intents, err := DecodeSwapCalldata(testRouter, data, big.NewInt(1e18))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intents) != 2 {
+		t.Fatalf("expected 2 intents, got %d", len(intents))
+	}
+	v3Intent := intents[0]
+	if v3Intent.Method != "V3_SWAP_EXACT_IN" || v3Intent.TokenIn != BNB.Address || v3Intent.AmountIn != nil ||
+		v3Intent.Recipient != (common.Address{}) || v3Intent.Deadline != 1900000000 {
+		t.Fatalf("unexpected v3 command %+v", v3Intent)
+	}
+	v2Intent := intents[1]
+	if v2Intent.Method != "V2_SWAP_EXACT_IN" || v2Intent.TokenIn != testTokenA || v2Intent.TokenOut != testTokenB || v2Intent.Recipient != testUser {
+		t.Fatalf("unexpected v2 command %+v", v2Intent)
+	}
+
+	bad := packCall(t, "execute(bytes,bytes[])", []abi.Type{mustType(t, "bytes"), mustType(t, "bytes[]")}, []byte{0x00, 0x08}, [][]byte{v3})
+	if _, err := DecodeSwapCalldata(testRouter, bad, nil); err == nil {
+		t.Fatal("expected error for mismatched commands and inputs")
+	}
+}
+
+func TestDecodeOneInch(t *testing.T) {
+	uint256 := mustType(t, "uint256")
+	desc := mustType(t, "tuple",
+		abi.ArgumentMarshaling{Name: "srcToken", Type: "address"},
+		abi.ArgumentMarshaling{Name: "dstToken", Type: "address"},
+		abi.ArgumentMarshaling{Name: "srcReceiver", Type: "address"},
+		abi.ArgumentMarshaling{Name: "dstReceiver", Type: "address"},
+		abi.ArgumentMarshaling{Name: "amount", Type: "uint256"},
+		abi.ArgumentMarshaling{Name: "minReturnAmount", Type: "uint256"},
+		abi.ArgumentMarshaling{Name: "flags", Type: "uint256"},
+	)
+	data := packCall(t, "swap(address,(address,address,address,address,uint256,uint256,uint256),bytes)",
+		[]abi.Type{mustType(t, "address"), desc, mustType(t, "bytes")},
+		common.HexToAddress("0xe0"),
+		struct {
+			SrcToken        common.Address
+			DstToken        common.Address
+			SrcReceiver     common.Address
+			DstReceiver     common.Address
+			Amount          *big.Int
+			MinReturnAmount *big.Int
+			Flags           *big.Int
+		}{testTokenA, testTokenB, common.HexToAddress("0xe0"), testUser, big.NewInt(7), big.NewInt(6), big.NewInt(0)},
+		[]byte{1, 2, 3})
+
+	intents, err := DecodeSwapCalldata(common.HexToAddress("0x111111125421cA6dc452d289314280a0f8842A65"), data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := intents[0]; i.Protocol != ProtocolOneInch || i.TokenIn != testTokenA || i.TokenOut != testTokenB || i.Recipient != testUser || i.AmountOutMin.Int64() != 6 {
+		t.Fatalf("unexpected 1inch swap %+v", i)
+	}
+
+	// dex 高位是标志位
+	dex := new(big.Int).Or(new(big.Int).Lsh(big.NewInt(1), 253), new(big.Int).SetBytes(testRouter.Bytes()))
+	data = packCall(t, "unoswap(uint256,uint256,uint256,uint256)", []abi.Type{uint256, uint256, uint256, uint256},
+		new(big.Int).SetBytes(testTokenA.Bytes()), big.NewInt(9), big.NewInt(8), dex)
+	intents, err = DecodeSwapCalldata(common.Address{}, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := intents[0]; i.TokenIn != testTokenA || i.AmountIn.Int64() != 9 || len(i.Pools) != 1 || i.Pools[0] != testRouter {
+		t.Fatalf("unexpected unoswap %+v", i)
+	}
+}
+
+func TestMeasureSwap(t *testing.T) {
+	pool := common.HexToAddress("0xdddd")
+	tt := NewTransferTracker("0x1")
+	tt.AddTransfer(testUser, pool, testTokenA, big.NewInt(1000))
+	tt.AddTransfer(pool, testUser, testTokenB, big.NewInt(1000))
+
+	intent := &SwapIntent{Router: testRouter, TokenIn: testTokenA, TokenOut: testTokenB, AmountIn: big.NewInt(1000), AmountOutMin: big.NewInt(980)}
+	exec := MeasureSwap(intent, tt, testUser)
+	if exec.AmountIn.Int64() != 1000 || exec.AmountOut.Int64() != 1000 || exec.Headroom.Int64() != 20 || exec.Slippage != 0.02 {
+		t.Fatalf("unexpected execution %+v", exec)
+	}
+
+	// 输出代币未知时取收到最多的代币
+	intent = &SwapIntent{TokenIn: testTokenA, AmountOutMin: big.NewInt(1000)}
+	if exec := MeasureSwap(intent, tt, testUser); exec.AmountOut.Int64() != 1000 || exec.Headroom.Sign() != 0 {
+		t.Fatalf("unexpected execution %+v", exec)
+	}
+
+	if _, _, err := DecodeV3Path(make([]byte, 42)); err == nil {
+		t.Fatal("expected invalid path error")
+	}
+}
@@ -0,0 +1,456 @@
+package geth
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/lonelybeanz/tools/pkg/log"
+)
+
+// SearcherPnLOptions 控制 searcher 收益报表的生成
+type SearcherPnLOptions struct {
+	// RPCURL 非空时 GetSearcherPnL 通过 callTracer 解析原生代币（BNB）转账，需要节点支持 debug_traceBlockByNumber
+	RPCURL string
+	// NativeTransfers 为 true 时 GetSearcherPnLFromBackend 通过 ChainBackend.TraceBlock 解析原生代币转账
+	NativeTransfers bool
+	// TokenPrice tokenAddress -> USD 价格，没有价格的代币只统计数量，不计入 USD 收益
+	TokenPrice map[common.Address]*TokenPrice
+	// TopN 返回的对手方数量，默认 10
+	TopN int
+}
+
+// TokenFlow 一种代币的流入流出汇总
+type TokenFlow struct {
+	Token   common.Address `json:"token"`
+	Symbol  string         `json:"symbol,omitempty"`
+	Inflow  *big.Int       `json:"inflow"`
+	Outflow *big.Int       `json:"outflow"`
+	Net     *big.Int       `json:"net"`
+	NetUSD  float64        `json:"net_usd"`
+}
+
+// PnLBucket 按区块或按天汇总的收益
+type PnLBucket struct {
+	Key      string   `json:"key"` // 区块号或日期（UTC，2006-01-02）
+	TxCount  int      `json:"tx_count"`
+	GasSpent *big.Int `json:"gas_spent"`
+	GasUSD   float64  `json:"gas_usd"`
+	PnLUSD   float64  `json:"pnl_usd"` // 代币净流入价值 - gas
+}
+
+// Counterparty 与 searcher 发生转账的对手方
+type Counterparty struct {
+	Address       common.Address `json:"address"`
+	TxCount       int            `json:"tx_count"`
+	TransferCount int            `json:"transfer_count"`
+	VolumeUSD     float64        `json:"volume_usd"`
+}
+
+// SearcherPnLReport searcher 地址集合在区块区间内的收益报表
+type SearcherPnLReport struct {
+	Searchers         []common.Address `json:"searchers"`
+	StartBlock        uint64           `json:"start_block"`
+	EndBlock          uint64           `json:"end_block"`
+	TxCount           int              `json:"tx_count"`
+	GasSpent          *big.Int         `json:"gas_spent"`
+	GasUSD            float64          `json:"gas_usd"`
+	PnLUSD            float64          `json:"pnl_usd"`
+	Tokens            []*TokenFlow     `json:"tokens"`
+	Blocks            []*PnLBucket     `json:"blocks"`
+	Days              []*PnLBucket     `json:"days"`
+	TopCounterparties []*Counterparty  `json:"top_counterparties"`
+}
+
+// searcherTx 一笔与 searcher 相关的交易
+type searcherTx struct {
+	BlockNumber uint64
+	BlockTime   uint64
+	TxHash      common.Hash
+	GasFee      *big.Int // 只有 searcher 发出的交易才有 gas 支出
+	Transfers   []*TransferRecord
+}
+
+// GetSearcherPnL 通过节点 RPC 生成 searcher 收益报表，见 GetSearcherPnLFromBackend
+func GetSearcherPnL(ctx context.Context, client *ethclient.Client, sercherAddresses []string, startBlock, endBlock uint64, opts SearcherPnLOptions) (*SearcherPnLReport, error) {
+	opts.NativeTransfers = opts.NativeTransfers || opts.RPCURL != ""
+	return GetSearcherPnLFromBackend(ctx, NewRPCBackend(client, opts.RPCURL), sercherAddresses, startBlock, endBlock, opts)
+}
+
+// GetSearcherPnLFromBackend 汇总 searcher 地址在 [startBlock, endBlock] 内参与的所有交易：
+// 各代币流入流出、gas 支出、按区块和按天的 USD 收益，以及主要对手方。
+// 逐块读取区块和回执，from/to 为 searcher 的交易（包括失败交易和只转原生币的交易）以及有代币或原生币转入转出 searcher 的交易都会统计。
+// 失败交易只计 gas 支出，不计转账。backend 可以是 archive.Backend，离线回放归档数据。
+func GetSearcherPnLFromBackend(ctx context.Context, backend ChainBackend, sercherAddresses []string, startBlock, endBlock uint64, opts SearcherPnLOptions) (*SearcherPnLReport, error) {
+	agg := newPnLAggregator(sercherAddresses, opts)
+	for number := startBlock; number <= endBlock; number++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		txs, err := searcherBlockTxs(ctx, backend, number, agg.searchers, opts.NativeTransfers)
+		if err != nil {
+			return nil, err
+		}
+		for _, stx := range txs {
+			agg.add(stx)
+		}
+	}
+	return agg.report(startBlock, endBlock), nil
+}
+
+// searcherBlockTxs 区块中与 searcher 相关的交易，按交易顺序排列
+func searcherBlockTxs(ctx context.Context, backend ChainBackend, number uint64, searchers map[common.Address]bool, native bool) ([]*searcherTx, error) {
+	block, err := backend.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := backend.BlockReceipts(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	receiptOf := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		receiptOf[receipt.TxHash] = receipt
+	}
+	traceOf := make(map[common.Hash]*BlockTraceResult)
+	if native {
+		traces, err := backend.TraceBlock(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		for i := range traces {
+			traceOf[common.HexToHash(traces[i].TxHash)] = &traces[i]
+		}
+	}
+
+	txs := make([]*searcherTx, 0)
+	for _, tx := range block.Transactions() {
+		receipt, ok := receiptOf[tx.Hash()]
+		if !ok {
+			return nil, fmt.Errorf("missing receipt of %s in block %d", tx.Hash().Hex(), number)
+		}
+		stx := &searcherTx{
+			BlockNumber: number,
+			BlockTime:   block.Time(),
+			TxHash:      tx.Hash(),
+			Transfers:   make([]*TransferRecord, 0),
+		}
+		signer := types.LatestSignerForChainID(tx.ChainId())
+		if sender, err := types.Sender(signer, tx); err == nil && searchers[sender] {
+			stx.GasFee = receiptGasFee(receipt)
+		}
+
+		// 失败交易回滚了所有转账，trace 中的调用也都已回滚
+		if receipt.Status == types.ReceiptStatusSuccessful {
+			transfer, _ := parseTxLogs(ctx, receipt.Logs)
+			for _, v := range transfer[tx.Hash()] {
+				stx.Transfers = append(stx.Transfers, &TransferRecord{From: v.From, To: v.To, Token: v.Token, Amount: v.Amount})
+			}
+			if trace, ok := traceOf[tx.Hash()]; ok {
+				for _, v := range ParseNativeFromTrace(trace.Root()) {
+					stx.Transfers = append(stx.Transfers, &TransferRecord{From: v.From, To: v.To, Token: BNB.Address, Amount: v.Amount})
+				}
+			}
+		}
+
+		if isSearcherTx(tx, signer, searchers) || touchesSearcher(stx.Transfers, searchers) {
+			txs = append(txs, stx)
+		}
+	}
+	return txs, nil
+}
+
+func touchesSearcher(transfers []*TransferRecord, searchers map[common.Address]bool) bool {
+	for _, t := range transfers {
+		if searchers[t.From] || searchers[t.To] {
+			return true
+		}
+	}
+	return false
+}
+
+// isSearcherTx 交易是否由 searcher 发出或发给 searcher
+func isSearcherTx(tx *types.Transaction, signer types.Signer, searchers map[common.Address]bool) bool {
+	if tx.To() != nil && searchers[*tx.To()] {
+		return true
+	}
+	sender, err := types.Sender(signer, tx)
+	return err == nil && searchers[sender]
+}
+
+// receiptGasFee 计算交易的 gas 支出（包含 blob gas）
+func receiptGasFee(receipt *types.Receipt) *big.Int {
+	fee := new(big.Int)
+	if receipt.EffectiveGasPrice != nil {
+		fee.Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice)
+	}
+	if receipt.BlobGasPrice != nil {
+		fee.Add(fee, new(big.Int).Mul(new(big.Int).SetUint64(receipt.BlobGasUsed), receipt.BlobGasPrice))
+	}
+	return fee
+}
+
+type pnlAggregator struct {
+	searchers     map[common.Address]bool
+	searcherList  []common.Address
+	tokenPrice    map[common.Address]*TokenPrice
+	topN          int
+	txCount       int
+	gasSpent      *big.Int
+	tokens        map[common.Address]*TokenFlow
+	blocks        map[uint64]*PnLBucket
+	days          map[string]*PnLBucket
+	counterparty  map[common.Address]*Counterparty
+	counterpartTx map[common.Address]map[common.Hash]bool
+}
+
+func newPnLAggregator(sercherAddresses []string, opts SearcherPnLOptions) *pnlAggregator {
+	agg := &pnlAggregator{
+		searchers:     make(map[common.Address]bool),
+		searcherList:  make([]common.Address, 0),
+		tokenPrice:    opts.TokenPrice,
+		topN:          opts.TopN,
+		gasSpent:      new(big.Int),
+		tokens:        make(map[common.Address]*TokenFlow),
+		blocks:        make(map[uint64]*PnLBucket),
+		days:          make(map[string]*PnLBucket),
+		counterparty:  make(map[common.Address]*Counterparty),
+		counterpartTx: make(map[common.Address]map[common.Hash]bool),
+	}
+	if agg.topN <= 0 {
+		agg.topN = 10
+	}
+	for _, addr := range sercherAddresses {
+		a := common.HexToAddress(addr)
+		if !agg.searchers[a] {
+			agg.searchers[a] = true
+			agg.searcherList = append(agg.searcherList, a)
+		}
+	}
+	return agg
+}
+
+// valueUSD 按价格换算 USD，没有价格时返回 0
+func (agg *pnlAggregator) valueUSD(token common.Address, amount *big.Int) float64 {
+	price, ok := agg.tokenPrice[token]
+	if !ok {
+		return 0
+	}
+	v := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetFloat64(math.Pow10(price.Decimal)))
+	v.Mul(v, new(big.Float).SetFloat64(price.Price))
+	value, _ := v.Float64()
+	return value
+}
+
+func (agg *pnlAggregator) add(tx *searcherTx) {
+	agg.txCount++
+
+	pnl := 0.0
+	for _, t := range tx.Transfers {
+		fromOurs, toOurs := agg.searchers[t.From], agg.searchers[t.To]
+		if fromOurs == toOurs {
+			// searcher 之间的内部划转，或与 searcher 无关的转账
+			continue
+		}
+
+		flow, ok := agg.tokens[t.Token]
+		if !ok {
+			flow = &TokenFlow{Token: t.Token, Inflow: new(big.Int), Outflow: new(big.Int), Net: new(big.Int)}
+			if price, ok := agg.tokenPrice[t.Token]; ok {
+				flow.Symbol = price.Symbol
+			}
+			agg.tokens[t.Token] = flow
+		}
+
+		value := agg.valueUSD(t.Token, t.Amount)
+		var other common.Address
+		if toOurs {
+			flow.Inflow.Add(flow.Inflow, t.Amount)
+			flow.Net.Add(flow.Net, t.Amount)
+			pnl += value
+			other = t.From
+		} else {
+			flow.Outflow.Add(flow.Outflow, t.Amount)
+			flow.Net.Sub(flow.Net, t.Amount)
+			pnl -= value
+			other = t.To
+		}
+
+		cp, ok := agg.counterparty[other]
+		if !ok {
+			cp = &Counterparty{Address: other}
+			agg.counterparty[other] = cp
+			agg.counterpartTx[other] = make(map[common.Hash]bool)
+		}
+		cp.TransferCount++
+		cp.VolumeUSD += value
+		if !agg.counterpartTx[other][tx.TxHash] {
+			agg.counterpartTx[other][tx.TxHash] = true
+			cp.TxCount++
+		}
+	}
+
+	gasFee := new(big.Int)
+	if tx.GasFee != nil {
+		gasFee.Set(tx.GasFee)
+	}
+	gasUSD := agg.valueUSD(BNB.Address, gasFee)
+	agg.gasSpent.Add(agg.gasSpent, gasFee)
+	pnl -= gasUSD
+
+	log.Debugf("searcher tx:%s block:%d pnl:%.6f gas:%s", tx.TxHash.Hex(), tx.BlockNumber, pnl, gasFee.String())
+
+	blockBucket, ok := agg.blocks[tx.BlockNumber]
+	if !ok {
+		blockBucket = &PnLBucket{Key: strconv.FormatUint(tx.BlockNumber, 10), GasSpent: new(big.Int)}
+		agg.blocks[tx.BlockNumber] = blockBucket
+	}
+	day := time.Unix(int64(tx.BlockTime), 0).UTC().Format("2006-01-02")
+	dayBucket, ok := agg.days[day]
+	if !ok {
+		dayBucket = &PnLBucket{Key: day, GasSpent: new(big.Int)}
+		agg.days[day] = dayBucket
+	}
+	for _, b := range []*PnLBucket{blockBucket, dayBucket} {
+		b.TxCount++
+		b.GasSpent.Add(b.GasSpent, gasFee)
+		b.GasUSD += gasUSD
+		b.PnLUSD += pnl
+	}
+}
+
+func (agg *pnlAggregator) report(startBlock, endBlock uint64) *SearcherPnLReport {
+	report := &SearcherPnLReport{
+		Searchers:         agg.searcherList,
+		StartBlock:        startBlock,
+		EndBlock:          endBlock,
+		TxCount:           agg.txCount,
+		GasSpent:          new(big.Int).Set(agg.gasSpent),
+		GasUSD:            agg.valueUSD(BNB.Address, agg.gasSpent),
+		Tokens:            make([]*TokenFlow, 0, len(agg.tokens)),
+		Blocks:            make([]*PnLBucket, 0, len(agg.blocks)),
+		Days:              make([]*PnLBucket, 0, len(agg.days)),
+		TopCounterparties: make([]*Counterparty, 0, len(agg.counterparty)),
+	}
+
+	for _, flow := range agg.tokens {
+		flow.NetUSD = agg.valueUSD(flow.Token, flow.Net)
+		report.Tokens = append(report.Tokens, flow)
+	}
+	sort.Slice(report.Tokens, func(i, j int) bool {
+		return report.Tokens[i].Token.Cmp(report.Tokens[j].Token) < 0
+	})
+
+	blockNumbers := make([]uint64, 0, len(agg.blocks))
+	for n := range agg.blocks {
+		blockNumbers = append(blockNumbers, n)
+	}
+	sort.Slice(blockNumbers, func(i, j int) bool { return blockNumbers[i] < blockNumbers[j] })
+	for _, n := range blockNumbers {
+		report.Blocks = append(report.Blocks, agg.blocks[n])
+		report.PnLUSD += agg.blocks[n].PnLUSD
+	}
+
+	for _, b := range agg.days {
+		report.Days = append(report.Days, b)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Key < report.Days[j].Key })
+
+	for _, cp := range agg.counterparty {
+		report.TopCounterparties = append(report.TopCounterparties, cp)
+	}
+	sort.Slice(report.TopCounterparties, func(i, j int) bool {
+		a, b := report.TopCounterparties[i], report.TopCounterparties[j]
+		if a.VolumeUSD != b.VolumeUSD {
+			return a.VolumeUSD > b.VolumeUSD
+		}
+		if a.TransferCount != b.TransferCount {
+			return a.TransferCount > b.TransferCount
+		}
+		return a.Address.Cmp(b.Address) < 0
+	})
+	if len(report.TopCounterparties) > agg.topN {
+		report.TopCounterparties = report.TopCounterparties[:agg.topN]
+	}
+
+	return report
+}
+
+// ToJSON 以 JSON 格式输出报表
+func (r *SearcherPnLReport) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// WriteTokensCSV 输出各代币流入流出
+func (r *SearcherPnLReport) WriteTokensCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"token", "symbol", "inflow", "outflow", "net", "net_usd"}); err != nil {
+		return err
+	}
+	for _, t := range r.Tokens {
+		if err := cw.Write([]string{
+			t.Token.Hex(), t.Symbol, t.Inflow.String(), t.Outflow.String(), t.Net.String(), formatUSD(t.NetUSD),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteBlocksCSV 输出按区块汇总的收益
+func (r *SearcherPnLReport) WriteBlocksCSV(w io.Writer) error {
+	return writeBucketsCSV(w, "block", r.Blocks)
+}
+
+// WriteDaysCSV 输出按天汇总的收益
+func (r *SearcherPnLReport) WriteDaysCSV(w io.Writer) error {
+	return writeBucketsCSV(w, "day", r.Days)
+}
+
+// WriteCounterpartiesCSV 输出主要对手方
+func (r *SearcherPnLReport) WriteCounterpartiesCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"address", "tx_count", "transfer_count", "volume_usd"}); err != nil {
+		return err
+	}
+	for _, cp := range r.TopCounterparties {
+		if err := cw.Write([]string{
+			cp.Address.Hex(), strconv.Itoa(cp.TxCount), strconv.Itoa(cp.TransferCount), formatUSD(cp.VolumeUSD),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeBucketsCSV(w io.Writer, keyName string, buckets []*PnLBucket) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{keyName, "tx_count", "gas_spent", "gas_usd", "pnl_usd"}); err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		if err := cw.Write([]string{
+			b.Key, strconv.Itoa(b.TxCount), b.GasSpent.String(), formatUSD(b.GasUSD), formatUSD(b.PnLUSD),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatUSD(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
@@ -0,0 +1,158 @@
+package geth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSearcherPnLAggregate(t *testing.T) {
+	searcher := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	searcher2 := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	pool := common.HexToAddress("0x3333333333333333333333333333333333333333")
+
+	bnb := BNB
+	agg := newPnLAggregator([]string{searcher.Hex(), searcher2.Hex()}, SearcherPnLOptions{
+		TokenPrice: map[common.Address]*TokenPrice{
+			BNB.Address:  bnb.SetTokenPrice(500),
+			USDT.Address: &USDT,
+		},
+	})
+
+	oneEther := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	agg.add(&searcherTx{
+		BlockNumber: 100,
+		BlockTime:   1700000000,
+		TxHash:      common.HexToHash("0x01"),
+		GasFee:      new(big.Int).Div(oneEther, big.NewInt(1000)), // 0.001 BNB = $0.5
+		Transfers: []*TransferRecord{
+			{From: searcher, To: pool, Token: USDT.Address, Amount: new(big.Int).Mul(big.NewInt(100), oneEther)},
+			{From: pool, To: searcher, Token: USDT.Address, Amount: new(big.Int).Mul(big.NewInt(102), oneEther)},
+			// searcher 之间的划转不计入
+			{From: searcher, To: searcher2, Token: USDT.Address, Amount: oneEther},
+		},
+	})
+	agg.add(&searcherTx{
+		BlockNumber: 101,
+		BlockTime:   1700086400,
+		TxHash:      common.HexToHash("0x02"),
+		Transfers: []*TransferRecord{
+			{From: pool, To: searcher2, Token: USDT.Address, Amount: oneEther},
+		},
+	})
+
+	report := agg.report(100, 101)
+	if report.TxCount != 2 || len(report.Blocks) != 2 || len(report.Days) != 2 {
+		t.Fatalf("unexpected report shape: %+v", report)
+	}
+	if got := report.Blocks[0].PnLUSD; got < 1.499 || got > 1.501 {
+		t.Fatalf("unexpected block pnl: %f", got)
+	}
+	if got := report.PnLUSD; got < 2.499 || got > 2.501 {
+		t.Fatalf("unexpected total pnl: %f", got)
+	}
+	if len(report.TopCounterparties) != 1 || report.TopCounterparties[0].TxCount != 2 || report.TopCounterparties[0].TransferCount != 3 {
+		t.Fatalf("unexpected counterparties: %+v", report.TopCounterparties)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteBlocksCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 {
+		t.Fatalf("unexpected csv: %s", buf.String())
+	}
+	if _, err := report.ToJSON(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearcherPnLFromBackend(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	searcher := crypto.PubkeyToAddress(key.PublicKey)
+	pool := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	other := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	signer := types.LatestSignerForChainID(big.NewInt(56))
+
+	// 1. searcher 发出的失败交易：没有 Transfer 日志，只计 gas
+	failed, err := types.SignTx(types.NewTransaction(0, pool, nil, 21000, big.NewInt(2), nil), signer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2. 他人发起、向 searcher 转入 USDT 的交易
+	incoming := types.NewTx(&types.LegacyTx{Nonce: 1, To: &pool, Gas: 50000, GasPrice: big.NewInt(1)})
+	// 3. 他人发起、内部调用给 searcher 转 BNB 的交易
+	native := types.NewTx(&types.LegacyTx{Nonce: 2, To: &pool, Gas: 50000, GasPrice: big.NewInt(1)})
+	// 4. 无关交易
+	unrelated := types.NewTx(&types.LegacyTx{Nonce: 3, To: &other, Gas: 21000, GasPrice: big.NewInt(1)})
+
+	header := &types.Header{Number: big.NewInt(100), Time: 1700000000}
+	block := types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: types.Transactions{failed, incoming, native, unrelated}})
+	transferLog := &types.Log{
+		Address: USDT.Address,
+		Topics:  []common.Hash{common.HexToHash(NewERC20Parser().TransferTopic), common.BytesToHash(pool.Bytes()), common.BytesToHash(searcher.Bytes())},
+		Data:    common.LeftPadBytes(big.NewInt(7).Bytes(), 32),
+		TxHash:  incoming.Hash(),
+	}
+	var nativeTrace BlockTraceResult
+	if err := json.Unmarshal([]byte(`{"txHash":"`+native.Hash().Hex()+`","result":{"from":"`+other.Hex()+`","to":"`+pool.Hex()+`",`+
+		`"calls":[{"type":"CALL","from":"`+pool.Hex()+`","to":"`+searcher.Hex()+`","value":"0x5"}]}}`), &nativeTrace); err != nil {
+		t.Fatal(err)
+	}
+	backend := &memBackend{
+		blocks: map[uint64]*types.Block{100: block},
+		receipts: map[uint64][]*types.Receipt{100: {
+			{TxHash: failed.Hash(), Status: types.ReceiptStatusFailed, GasUsed: 21000, EffectiveGasPrice: big.NewInt(2)},
+			{TxHash: incoming.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 40000, EffectiveGasPrice: big.NewInt(1), Logs: []*types.Log{transferLog}},
+			{TxHash: native.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 40000, EffectiveGasPrice: big.NewInt(1)},
+			{TxHash: unrelated.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 21000, EffectiveGasPrice: big.NewInt(1)},
+		}},
+		traces: map[uint64][]BlockTraceResult{100: {nativeTrace}},
+	}
+
+	report, err := GetSearcherPnLFromBackend(context.Background(), backend, []string{searcher.Hex()}, 100, 100, SearcherPnLOptions{NativeTransfers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TxCount != 3 || report.GasSpent.Int64() != 42000 {
+		t.Fatalf("unexpected tx count %d or gas %s", report.TxCount, report.GasSpent)
+	}
+	inflow := make(map[common.Address]int64)
+	for _, flow := range report.Tokens {
+		inflow[flow.Token] = flow.Inflow.Int64()
+	}
+	if inflow[USDT.Address] != 7 || inflow[BNB.Address] != 5 {
+		t.Fatalf("unexpected token flows: %+v", inflow)
+	}
+}
+
+func TestIsSearcherTx(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	searcher := crypto.PubkeyToAddress(key.PublicKey)
+	other := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	searchers := map[common.Address]bool{searcher: true}
+	signer := types.LatestSignerForChainID(big.NewInt(56))
+
+	// 失败交易和只转原生币的交易没有 Transfer 日志，需要按 from/to 识别
+	sent, err := types.SignTx(types.NewTransaction(0, other, big.NewInt(1), 21000, big.NewInt(1), nil), signer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSearcherTx(sent, signer, searchers) {
+		t.Fatal("expected tx sent by searcher")
+	}
+	received := types.NewTransaction(0, searcher, big.NewInt(1), 21000, big.NewInt(1), nil)
+	if !isSearcherTx(received, signer, searchers) {
+		t.Fatal("expected tx sent to searcher")
+	}
+	if isSearcherTx(types.NewTransaction(0, other, big.NewInt(1), 21000, big.NewInt(1), nil), signer, searchers) {
+		t.Fatal("unexpected searcher tx")
+	}
+}
@@ -0,0 +1,191 @@
+package geth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CallRequest 未签名的调用
+type CallRequest struct {
+	From     common.Address
+	To       *common.Address // 为 nil 时模拟创建合约
+	Value    *big.Int
+	Data     []byte
+	Gas      uint64   // 为 0 时由节点决定
+	GasPrice *big.Int // 为 nil 时 gas 价格为 0，余额变化中不包含手续费
+}
+
+func (c *CallRequest) toArg() map[string]interface{} {
+	arg := map[string]interface{}{
+		"from": c.From,
+	}
+	if c.To != nil {
+		arg["to"] = *c.To
+	}
+	if c.Value != nil {
+		arg["value"] = (*hexutil.Big)(c.Value)
+	}
+	if len(c.Data) > 0 {
+		arg["data"] = hexutil.Bytes(c.Data)
+	}
+	if c.Gas > 0 {
+		arg["gas"] = hexutil.Uint64(c.Gas)
+	}
+	if c.GasPrice != nil {
+		arg["gasPrice"] = (*hexutil.Big)(c.GasPrice)
+	}
+	return arg
+}
+
+// StateOverride 模拟前覆盖账户状态，对应 debug_traceCall 的 stateOverrides。
+// State 替换整个存储，StateDiff 只修改指定的槽位，两者不能同时设置。
+type StateOverride struct {
+	Balance   *big.Int
+	Nonce     *uint64
+	Code      []byte
+	State     map[common.Hash]common.Hash
+	StateDiff map[common.Hash]common.Hash
+}
+
+func (o *StateOverride) MarshalJSON() ([]byte, error) {
+	type override struct {
+		Balance   *hexutil.Big                `json:"balance,omitempty"`
+		Nonce     *hexutil.Uint64             `json:"nonce,omitempty"`
+		Code      hexutil.Bytes               `json:"code,omitempty"`
+		State     map[common.Hash]common.Hash `json:"state,omitempty"`
+		StateDiff map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+	}
+	return json.Marshal(&override{
+		Balance:   (*hexutil.Big)(o.Balance),
+		Nonce:     (*hexutil.Uint64)(o.Nonce),
+		Code:      o.Code,
+		State:     o.State,
+		StateDiff: o.StateDiff,
+	})
+}
+
+type SimulateOptions struct {
+	Block          string // 区块号（hex）或 latest / pending，默认 latest。latest / pending 会先解析为当前最新区块号
+	StateOverrides map[common.Address]*StateOverride
+	Timeout        string // 节点端 tracer 超时，默认 5s
+}
+
+// SimulationResult 模拟结果。Changes / Tracker 由 NewTransferTrackerFromTrace 按执行顺序得到，与 CalculateTransactionVolume
+// 对已上链交易的结果有两点不同：失败调用帧中的原生代币转账不计入；闪电贷的本金借出与归还不剔除，需要时用 ParseFlashLoans 单独识别。
+type SimulationResult struct {
+	Trace         *TraceCall                      `json:"trace"`
+	Prestate      *AccountStateChange             `json:"prestate"`
+	Changes       map[common.Address]*AssetChange `json:"changes"`
+	NativeChanges map[common.Address]*AssetChange `json:"native_changes"` // prestate diff 得到的原生代币变化，包含 GasPrice 产生的手续费
+	Tracker       *TransferTracker                `json:"-"`
+	Reverted      bool                            `json:"reverted"`
+	Error         string                          `json:"error,omitempty"`
+	RevertReason  string                          `json:"revert_reason,omitempty"`
+	GasUsed       uint64                          `json:"gas_used"`
+	Block         string                          `json:"block"` // 两次 trace 使用的区块
+}
+
+// SimulateCall 用 debug_traceCall 分别以 callTracer（withLog）和 prestateTracer（diffMode）执行调用，
+// 返回发送交易之前预估的资产变化。调用回滚时不报错，Reverted 为 true 且 Changes 为空。
+// 两次 trace 固定在同一个区块上执行，避免中间出新块导致 Trace 和 Prestate 基于不同的状态。
+func SimulateCall(rpcURL string, call CallRequest, opts SimulateOptions) (*SimulationResult, error) {
+	return SimulateCallContext(context.Background(), rpcURL, call, opts)
+}
+
+// SimulateCallContext 与 SimulateCall 相同，ctx 取消或超时时中断 RPC 请求
+func SimulateCallContext(ctx context.Context, rpcURL string, call CallRequest, opts SimulateOptions) (*SimulationResult, error) {
+	if opts.Block == "" || opts.Block == "latest" || opts.Block == "pending" {
+		block, err := latestBlockNumber(ctx, rpcURL)
+		if err != nil {
+			return nil, err
+		}
+		opts.Block = block
+	}
+	if opts.Timeout == "" {
+		opts.Timeout = "5s"
+	}
+
+	root := new(TraceCall)
+	if err := traceCall(ctx, rpcURL, call, opts, map[string]interface{}{
+		"tracer":       "callTracer",
+		"timeout":      opts.Timeout,
+		"tracerConfig": map[string]interface{}{"withLog": true},
+	}, root); err != nil {
+		return nil, err
+	}
+	prestate := new(AccountStateChange)
+	if err := traceCall(ctx, rpcURL, call, opts, map[string]interface{}{
+		"tracer":       "prestateTracer",
+		"timeout":      opts.Timeout,
+		"tracerConfig": tracerConfigObject{DiffMode: true},
+	}, prestate); err != nil {
+		return nil, err
+	}
+
+	tracker := NewTransferTrackerFromTrace("", root)
+	result := &SimulationResult{
+		Trace:         root,
+		Prestate:      prestate,
+		Changes:       make(map[common.Address]*AssetChange),
+		NativeChanges: ParseNativeChange(&PrestateTxResult{Result: prestate}),
+		Tracker:       tracker,
+		Reverted:      root.Error != "",
+		Error:         root.Error,
+		RevertReason:  root.RevertReason,
+		GasUsed:       hexToUint64(root.GasUsed),
+		Block:         opts.Block,
+	}
+	for account, tokens := range tracker.NetBalances() {
+		result.Changes[account] = &AssetChange{Tokens: tokens}
+	}
+	return result, nil
+}
+
+// latestBlockNumber 当前最新区块号（hex）
+func latestBlockNumber(ctx context.Context, rpcURL string) (string, error) {
+	resp, err := callRPCContext(ctx, rpcURL, "eth_blockNumber", []interface{}{})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Result hexutil.Uint64  `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return "", err
+	}
+	if len(result.Error) > 0 && string(result.Error) != "null" {
+		return "", fmt.Errorf("API error: %s", result.Error)
+	}
+	return hexutil.EncodeUint64(uint64(result.Result)), nil
+}
+
+func traceCall(ctx context.Context, rpcURL string, call CallRequest, opts SimulateOptions, tracer map[string]interface{}, out interface{}) error {
+	if len(opts.StateOverrides) > 0 {
+		tracer["stateOverrides"] = opts.StateOverrides
+	}
+	resp, err := callRPCContext(ctx, rpcURL, "debug_traceCall", []interface{}{call.toArg(), opts.Block, tracer})
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return err
+	}
+	if len(result.Error) > 0 && string(result.Error) != "null" {
+		return fmt.Errorf("API error: %s", result.Error)
+	}
+	if len(result.Result) == 0 || string(result.Result) == "null" {
+		return fmt.Errorf("debug_traceCall returned empty result")
+	}
+	return json.Unmarshal(result.Result, out)
+}
@@ -0,0 +1,130 @@
+package geth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestSimulateCall(t *testing.T) {
+	user := common.HexToAddress("0x1111")
+	router := common.HexToAddress("0x2222")
+	token := common.HexToAddress("0x3333")
+
+	callResult := map[string]interface{}{
+		"type":    "CALL",
+		"from":    user.Hex(),
+		"to":      router.Hex(),
+		"value":   "0x64",
+		"gasUsed": "0x5208",
+		"logs": []map[string]interface{}{{
+			"address": token.Hex(),
+			"topics": []string{
+				NewERC20Parser().TransferTopic,
+				common.BytesToHash(router.Bytes()).Hex(),
+				common.BytesToHash(user.Bytes()).Hex(),
+			},
+			"data":     hexutil.Encode(common.LeftPadBytes(big.NewInt(500).Bytes(), 32)),
+			"index":    "0x0",
+			"position": "0x0",
+		}},
+	}
+	prestate := map[string]interface{}{
+		"pre":  map[string]interface{}{user.Hex(): map[string]string{"balance": "0x3e8"}},
+		"post": map[string]interface{}{user.Hex(): map[string]string{"balance": "0x384"}},
+	}
+
+	var overrides []json.RawMessage
+	var blocks []string
+	head := uint64(0x10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected request %v", err)
+			return
+		}
+		if req.Method == "eth_blockNumber" {
+			// 每次查询都出一个新块
+			head++
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": hexutil.Uint64(head)})
+			return
+		}
+		if req.Method != "debug_traceCall" || len(req.Params) != 3 {
+			t.Errorf("unexpected request %s", req.Method)
+			return
+		}
+		var block string
+		json.Unmarshal(req.Params[1], &block)
+		blocks = append(blocks, block)
+		var tracer struct {
+			Tracer         string          `json:"tracer"`
+			StateOverrides json.RawMessage `json:"stateOverrides"`
+		}
+		json.Unmarshal(req.Params[2], &tracer)
+		overrides = append(overrides, tracer.StateOverrides)
+
+		result := interface{}(callResult)
+		if tracer.Tracer == "prestateTracer" {
+			result = prestate
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+	defer server.Close()
+
+	balance := big.NewInt(1e18)
+	res, err := SimulateCall(server.URL, CallRequest{From: user, To: &router, Value: big.NewInt(100)}, SimulateOptions{
+		StateOverrides: map[common.Address]*StateOverride{user: {Balance: balance}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Reverted || res.GasUsed != 21000 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if got := res.Changes[user].Tokens[token]; got.Int64() != 500 {
+		t.Fatalf("expected user to receive 500 tokens, got %v", got)
+	}
+	if got := res.Changes[user].Tokens[BNB.Address]; got.Int64() != -100 {
+		t.Fatalf("expected user to pay 100 native, got %v", got)
+	}
+	if got := res.NativeChanges[user].Tokens[BNB.Address]; got.Int64() != -100 {
+		t.Fatalf("unexpected prestate change %v", got)
+	}
+	if len(blocks) != 2 || blocks[0] != "0x11" || blocks[1] != "0x11" || res.Block != "0x11" {
+		t.Fatalf("both traces should run on the resolved block, got %v", blocks)
+	}
+	if len(overrides) != 2 || string(overrides[0]) != `{"`+user.Hex()+`":{"balance":"0xde0b6b3a7640000"}}` {
+		t.Fatalf("unexpected state overrides %s", overrides)
+	}
+
+	// 回滚的调用不产生资产变化
+	callResult["error"] = "execution reverted"
+	callResult["revertReason"] = "INSUFFICIENT_OUTPUT_AMOUNT"
+	res, err = SimulateCall(server.URL, CallRequest{From: user, To: &router}, SimulateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Reverted || res.RevertReason != "INSUFFICIENT_OUTPUT_AMOUNT" || len(res.Changes) != 0 {
+		t.Fatalf("unexpected reverted result %+v", res)
+	}
+
+	// 取消的 ctx 不再发出 trace 请求
+	before := len(blocks)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := SimulateCallContext(ctx, server.URL, CallRequest{From: user, To: &router}, SimulateOptions{Block: "0x11"}); err == nil {
+		t.Fatal("expected error for cancelled context")
+	}
+	if len(blocks) != before {
+		t.Fatalf("cancelled simulation should not reach the node, got %d traces", len(blocks)-before)
+	}
+}
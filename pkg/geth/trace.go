@@ -2,13 +2,18 @@ package geth
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/lonelybeanz/tools/pkg/metrics"
+	"github.com/lonelybeanz/tools/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type TraceAction struct {
@@ -43,21 +48,59 @@ type tracerObject struct {
 	TracerConfig tracerConfigObject `json:"tracerConfig"`
 }
 
+var rpcHTTPClient = http.DefaultClient
+
+// SetRPCHTTPClient 设置 trace 等原始 JSON-RPC 请求使用的 http.Client，例如 rpccache.NewHTTPClient
+func SetRPCHTTPClient(client *http.Client) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	rpcHTTPClient = client
+}
+
 func callRPC(rpcURL, method string, params []interface{}) ([]byte, error) {
+	return callRPCContext(context.Background(), rpcURL, method, params)
+}
+
+// callRPCContext 发送原始 JSON-RPC 请求，记录指标和 span，并把 trace context 写入请求头
+func callRPCContext(ctx context.Context, rpcURL, method string, params []interface{}) (body []byte, err error) {
+	ctx, span := tracing.Start(ctx, "rpc "+method,
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", method),
+		attribute.String("server.address", metrics.EndpointLabel(rpcURL)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	reqBody, _ := json.Marshal(map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      1,
 		"method":  method,
 		"params":  params,
 	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rpcURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req.Header)
 
-	resp, err := http.Post(rpcURL, "application/json", bytes.NewBuffer(reqBody))
+	start := time.Now()
+	resp, err := rpcHTTPClient.Do(req)
 	if err != nil {
+		metrics.ObserveRPC(metrics.EndpointLabel(rpcURL), method, start, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
+	if metrics.Enabled() {
+		rpcErr := err
+		if rpcErr == nil {
+			rpcErr = metrics.ResponseError(body, false)
+		}
+		metrics.ObserveRPC(metrics.EndpointLabel(rpcURL), method, start, rpcErr)
+	}
+	return body, err
 }
 
 type RPCTraceResult struct {
@@ -66,6 +109,14 @@ type RPCTraceResult struct {
 }
 
 func TraceTransaction(rpcURL, txHash string) (*TraceCall, error) {
+	return TraceTransactionContext(context.Background(), rpcURL, txHash)
+}
+
+// TraceTransactionContext 与 TraceTransaction 相同，span 挂在 ctx 的链路下
+func TraceTransactionContext(ctx context.Context, rpcURL, txHash string) (root *TraceCall, err error) {
+	ctx, span := tracing.Start(ctx, "geth.TraceTransaction", attribute.String("tx.hash", txHash))
+	defer func() { tracing.End(span, err) }()
+
 	type tracerObject struct {
 		Tracer  string `json:"tracer"`
 		Timeout string `json:"timeout"`
@@ -74,10 +125,17 @@ func TraceTransaction(rpcURL, txHash string) (*TraceCall, error) {
 		Tracer:  "callTracer",
 		Timeout: "5s",
 	}
-	resp, err := callRPC(rpcURL, "debug_traceTransaction", []interface{}{txHash, tracer})
+	resp, err := callRPCContext(ctx, rpcURL, "debug_traceTransaction", []interface{}{txHash, tracer})
 	if err != nil {
 		return nil, err
 	}
+	return parseTraceResult(ctx, resp)
+}
+
+// parseTraceResult 解析 callTracer 的响应，单独记录 span 以区分节点耗时和解析耗时
+func parseTraceResult(ctx context.Context, resp []byte) (root *TraceCall, err error) {
+	_, span := tracing.Start(ctx, "geth.parseTrace", attribute.Int("response.bytes", len(resp)))
+	defer func() { tracing.End(span, err) }()
 
 	var result RPCTraceResult
 	if err := json.Unmarshal(resp, &result); err != nil {
@@ -86,7 +144,6 @@ func TraceTransaction(rpcURL, txHash string) (*TraceCall, error) {
 	if result.Error != "" {
 		return nil, fmt.Errorf("API error: %v", result.Error)
 	}
-
 	return result.Result, nil
 }
 
@@ -100,6 +157,18 @@ type TraceCall struct {
 	Input   string       `json:"input"` // ERC20 调用
 	Error   string       `json:"error,omitempty"`
 	Calls   []*TraceCall `json:"calls,omitempty"`
+	Logs    []*TraceLog  `json:"logs,omitempty"` // 仅在 tracerConfig.withLog 为 true 时返回
+
+	RevertReason string `json:"revertReason,omitempty"` // 回滚时节点解码出的 Error(string) 信息
+}
+
+// TraceLog callTracer 在 withLog 模式下返回的事件
+type TraceLog struct {
+	Address  string   `json:"address"`
+	Topics   []string `json:"topics"`
+	Data     string   `json:"data"`
+	Index    string   `json:"index,omitempty"` // 交易内的 log index
+	Position string   `json:"position"`        // 事件发出前当前调用帧已发起的子调用数
 }
 
 // 递归找到所有的call
@@ -112,16 +181,68 @@ func (call *TraceCall) getAllCalls() []TraceCall {
 	return calls
 }
 
+// TraceTransactionWithLogs 与 TraceTransaction 相同，但开启 withLog，调用帧中会带上事件及其相对子调用的位置，
+// 可以用 NewTransferTrackerFromTrace 按执行顺序还原转账。
+func TraceTransactionWithLogs(rpcURL, txHash string) (*TraceCall, error) {
+	return TraceTransactionWithLogsContext(context.Background(), rpcURL, txHash)
+}
+
+// TraceTransactionWithLogsContext 与 TraceTransactionWithLogs 相同，span 挂在 ctx 的链路下
+func TraceTransactionWithLogsContext(ctx context.Context, rpcURL, txHash string) (root *TraceCall, err error) {
+	ctx, span := tracing.Start(ctx, "geth.TraceTransactionWithLogs", attribute.String("tx.hash", txHash))
+	defer func() { tracing.End(span, err) }()
+
+	type tracerConfigObject struct {
+		WithLog bool `json:"withLog"`
+	}
+	type tracerObject struct {
+		Tracer       string             `json:"tracer"`
+		Timeout      string             `json:"timeout"`
+		TracerConfig tracerConfigObject `json:"tracerConfig"`
+	}
+	tracer := tracerObject{
+		Tracer:       "callTracer",
+		Timeout:      "5s",
+		TracerConfig: tracerConfigObject{WithLog: true},
+	}
+	resp, err := callRPCContext(ctx, rpcURL, "debug_traceTransaction", []interface{}{txHash, tracer})
+	if err != nil {
+		return nil, err
+	}
+	return parseTraceResult(ctx, resp)
+}
+
 type BlockTraceResult struct {
 	TxHash string `json:"txHash"`
 	Result struct {
 		Calls []TraceCall `json:"calls"`
 		From  string      `json:"from"`
 		To    string      `json:"to"`
+		Value string      `json:"value,omitempty"`
+		Error string      `json:"error,omitempty"`
 	} `json:"result"`
 }
 
+// Root 把区块 trace 中的一笔交易转换为根调用帧
+func (r *BlockTraceResult) Root() *TraceCall {
+	root := &TraceCall{
+		From:  r.Result.From,
+		To:    r.Result.To,
+		Value: r.Result.Value,
+		Error: r.Result.Error,
+	}
+	for i := range r.Result.Calls {
+		root.Calls = append(root.Calls, &r.Result.Calls[i])
+	}
+	return root
+}
+
 func TraceBlock(rpcURL string, blockNumber uint64) ([]BlockTraceResult, error) {
+	return TraceBlockContext(context.Background(), rpcURL, blockNumber)
+}
+
+// TraceBlockContext 与 TraceBlock 相同，ctx 取消时中断请求
+func TraceBlockContext(ctx context.Context, rpcURL string, blockNumber uint64) ([]BlockTraceResult, error) {
 	type tracerObject struct {
 		Tracer  string `json:"tracer"`
 		Timeout string `json:"timeout"`
@@ -130,7 +251,7 @@ func TraceBlock(rpcURL string, blockNumber uint64) ([]BlockTraceResult, error) {
 		Tracer:  "callTracer",
 		Timeout: "5s",
 	}
-	resp, err := callRPC(rpcURL, "debug_traceBlockByNumber", []interface{}{hexutil.EncodeUint64(blockNumber), tracer})
+	resp, err := callRPCContext(ctx, rpcURL, "debug_traceBlockByNumber", []interface{}{hexutil.EncodeUint64(blockNumber), tracer})
 	if err != nil {
 		return nil, err
 	}
@@ -245,6 +366,11 @@ type AccountState struct {
 }
 
 func TraceBlockForChange(rpcURL string, blockNumber uint64) ([]PrestateTxResult, error) {
+	return TraceBlockForChangeContext(context.Background(), rpcURL, blockNumber)
+}
+
+// TraceBlockForChangeContext 与 TraceBlockForChange 相同，ctx 取消时中断请求
+func TraceBlockForChangeContext(ctx context.Context, rpcURL string, blockNumber uint64) ([]PrestateTxResult, error) {
 
 	tracerConfig := tracerConfigObject{
 		OnlyTopCall: false,
@@ -256,7 +382,7 @@ func TraceBlockForChange(rpcURL string, blockNumber uint64) ([]PrestateTxResult,
 		TracerConfig: tracerConfig,
 	}
 
-	resp, err := callRPC(rpcURL, "debug_traceBlockByNumber", []interface{}{hexutil.EncodeUint64(blockNumber), tracer})
+	resp, err := callRPCContext(ctx, rpcURL, "debug_traceBlockByNumber", []interface{}{hexutil.EncodeUint64(blockNumber), tracer})
 	if err != nil {
 		return nil, err
 	}
@@ -273,7 +399,11 @@ func TraceBlockForChange(rpcURL string, blockNumber uint64) ([]PrestateTxResult,
 }
 
 func TraceTransactionForChange(rpcURL, method, txHash string) (*PrestateTxResult, error) {
+	return TraceTransactionForChangeContext(context.Background(), rpcURL, method, txHash)
+}
 
+// TraceTransactionForChangeContext 与 TraceTransactionForChange 相同，ctx 取消时中断请求
+func TraceTransactionForChangeContext(ctx context.Context, rpcURL, method, txHash string) (*PrestateTxResult, error) {
 	tracerConfig := tracerConfigObject{
 		OnlyTopCall: false,
 		DiffMode:    true,
@@ -287,7 +417,7 @@ func TraceTransactionForChange(rpcURL, method, txHash string) (*PrestateTxResult
 	if method != "" {
 		debugMethod = method
 	}
-	resp, err := callRPC(rpcURL, debugMethod, []interface{}{txHash, tracer})
+	resp, err := callRPCContext(ctx, rpcURL, debugMethod, []interface{}{txHash, tracer})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,228 @@
+package geth
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GraphNode 转账图中的一个地址
+type GraphNode struct {
+	ID      string         `json:"id"`
+	Address common.Address `json:"address"`
+	Label   string         `json:"label,omitempty"` // 地址标签，例如 "PancakeRouter"
+}
+
+// GraphEdge 同一对地址之间同一代币的聚合转账
+type GraphEdge struct {
+	From       common.Address `json:"from"`
+	To         common.Address `json:"to"`
+	Token      common.Address `json:"token"`
+	Symbol     string         `json:"symbol,omitempty"`
+	Amount     *big.Int       `json:"-"`
+	AmountRaw  string         `json:"amount"`                // 原始数量（最小单位）
+	AmountText string         `json:"amount_text,omitempty"` // 按精度格式化后的数量，没有代币信息时为空
+	Count      int            `json:"count"`                 // 聚合的转账笔数
+}
+
+// TransferGraph 转账流转图，节点和边都按首次出现的顺序排列，相同输入总是得到相同输出
+type TransferGraph struct {
+	TxHash string       `json:"tx_hash,omitempty"`
+	Nodes  []*GraphNode `json:"nodes"`
+	Edges  []*GraphEdge `json:"edges"`
+}
+
+// Graph 聚合同一对地址之间同一代币的转账，生成转账图。
+// tokenDetails 用于格式化数量，labels 为可选的地址标签。
+func (tt *TransferTracker) Graph(tokenDetails map[common.Address]*TokenPrice, labels map[common.Address]string) *TransferGraph {
+	graph := &TransferGraph{
+		TxHash: tt.TxHash,
+		Nodes:  make([]*GraphNode, 0),
+		Edges:  make([]*GraphEdge, 0),
+	}
+
+	nodes := make(map[common.Address]*GraphNode)
+	addNode := func(addr common.Address) {
+		if _, ok := nodes[addr]; ok {
+			return
+		}
+		node := &GraphNode{ID: fmt.Sprintf("n%d", len(graph.Nodes)), Address: addr, Label: labels[addr]}
+		nodes[addr] = node
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	type transferKey struct {
+		from, to, token common.Address
+	}
+	edges := make(map[transferKey]*GraphEdge)
+
+	for _, tx := range tt.GetTransfers() {
+		addNode(tx.From)
+		addNode(tx.To)
+
+		key := transferKey{from: tx.From, to: tx.To, token: tx.Token}
+		edge, ok := edges[key]
+		if !ok {
+			edge = &GraphEdge{From: tx.From, To: tx.To, Token: tx.Token, Amount: new(big.Int)}
+			edges[key] = edge
+			graph.Edges = append(graph.Edges, edge)
+		}
+		edge.Amount.Add(edge.Amount, tx.Amount)
+		edge.Count++
+	}
+
+	for _, edge := range graph.Edges {
+		edge.AmountRaw = edge.Amount.String()
+		if details, ok := tokenDetails[edge.Token]; ok && details.Decimal > 0 {
+			edge.Symbol = details.Symbol
+			edge.AmountText = formatTokenAmount(edge.Amount, details.Decimal)
+		}
+	}
+
+	return graph
+}
+
+func formatTokenAmount(amount *big.Int, decimal int) string {
+	fAmount := new(big.Float).SetInt(amount)
+	powerOf10 := new(big.Float).SetFloat64(math.Pow10(decimal))
+	fAmount.Quo(fAmount, powerOf10)
+	return fAmount.Text('f', 6)
+}
+
+// edgeLabel 有代币信息时显示 "数量 符号"，否则显示原始数量和代币地址。
+// escape 只作用于各部分文本，不转义 separator
+func (e *GraphEdge) edgeLabel(separator string, escape func(string) string) string {
+	if e.AmountText != "" {
+		return escape(e.AmountText + " " + e.Symbol)
+	}
+	return escape(e.AmountRaw) + separator + escape(e.Token.Hex())
+}
+
+// nodeLabel 有标签时显示 "标签 + 地址"，否则只显示地址。
+// escape 只作用于各部分文本，不转义 separator
+func (n *GraphNode) nodeLabel(separator string, escape func(string) string) string {
+	if n.Label != "" {
+		return escape(n.Label) + separator + escape(n.Address.Hex())
+	}
+	return escape(n.Address.Hex())
+}
+
+// ToDOT generates a string representation of the transfer graph in DOT format.
+// This can be used with tools like Graphviz to visualize the flow.
+// tokenDetails is a map from token address to its details (symbol, decimals).
+func (tt *TransferTracker) ToDOT(tokenDetails map[common.Address]*TokenPrice) string {
+	return tt.Graph(tokenDetails, nil).ToDOT()
+}
+
+// ToDOT 输出 Graphviz DOT 格式
+func (g *TransferGraph) ToDOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph transfers {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString(`  node [shape=box, style="rounded,filled", fillcolor=lightblue];` + "\n")
+	sb.WriteString("  edge [fontsize=10];\n\n")
+
+	for _, node := range g.Nodes {
+		if node.Label != "" {
+			sb.WriteString(fmt.Sprintf(`  "%s" [label="%s"];`+"\n", node.Address.Hex(), node.nodeLabel(`\n`, dotEscape)))
+		}
+	}
+
+	for _, edge := range g.Edges {
+		sb.WriteString(fmt.Sprintf(`  "%s" -> "%s" [label="%s"];`+"\n", edge.From.Hex(), edge.To.Hex(), edge.edgeLabel(`\n`, dotEscape)))
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// dotEscape 转义 DOT 字符串中的反斜杠和双引号
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// ToMermaid 生成 Mermaid flowchart，可直接嵌入 Markdown 或看板
+func (tt *TransferTracker) ToMermaid(tokenDetails map[common.Address]*TokenPrice, labels map[common.Address]string) string {
+	return tt.Graph(tokenDetails, labels).ToMermaid()
+}
+
+// ToMermaid 输出 Mermaid flowchart 格式
+func (g *TransferGraph) ToMermaid() string {
+	ids := make(map[common.Address]string, len(g.Nodes))
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	for _, node := range g.Nodes {
+		ids[node.Address] = node.ID
+		sb.WriteString(fmt.Sprintf(`  %s["%s"]`+"\n", node.ID, node.nodeLabel("<br/>", mermaidEscape)))
+	}
+	for _, edge := range g.Edges {
+		sb.WriteString(fmt.Sprintf(`  %s -->|"%s"| %s`+"\n", ids[edge.From], edge.edgeLabel("<br/>", mermaidEscape), ids[edge.To]))
+	}
+	return sb.String()
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+// ToGraphML 生成 GraphML，可导入 Gephi、yEd 等工具
+func (tt *TransferTracker) ToGraphML(tokenDetails map[common.Address]*TokenPrice, labels map[common.Address]string) string {
+	return tt.Graph(tokenDetails, labels).ToGraphML()
+}
+
+// ToGraphML 输出 GraphML 格式
+func (g *TransferGraph) ToGraphML() string {
+	ids := make(map[common.Address]string, len(g.Nodes))
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sb.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	sb.WriteString(`  <key id="address" for="node" attr.name="address" attr.type="string"/>` + "\n")
+	sb.WriteString(`  <key id="label" for="node" attr.name="label" attr.type="string"/>` + "\n")
+	sb.WriteString(`  <key id="token" for="edge" attr.name="token" attr.type="string"/>` + "\n")
+	sb.WriteString(`  <key id="symbol" for="edge" attr.name="symbol" attr.type="string"/>` + "\n")
+	sb.WriteString(`  <key id="amount" for="edge" attr.name="amount" attr.type="string"/>` + "\n")
+	sb.WriteString(`  <key id="amount_text" for="edge" attr.name="amount_text" attr.type="string"/>` + "\n")
+	sb.WriteString(`  <key id="count" for="edge" attr.name="count" attr.type="int"/>` + "\n")
+	sb.WriteString(`  <graph id="transfers" edgedefault="directed">` + "\n")
+	for _, node := range g.Nodes {
+		ids[node.Address] = node.ID
+		sb.WriteString(fmt.Sprintf(`    <node id="%s">`+"\n", node.ID))
+		writeGraphMLData(&sb, "address", node.Address.Hex())
+		if node.Label != "" {
+			writeGraphMLData(&sb, "label", node.Label)
+		}
+		sb.WriteString("    </node>\n")
+	}
+	for i, edge := range g.Edges {
+		sb.WriteString(fmt.Sprintf(`    <edge id="e%d" source="%s" target="%s">`+"\n", i, ids[edge.From], ids[edge.To]))
+		writeGraphMLData(&sb, "token", edge.Token.Hex())
+		if edge.Symbol != "" {
+			writeGraphMLData(&sb, "symbol", edge.Symbol)
+		}
+		writeGraphMLData(&sb, "amount", edge.AmountRaw)
+		if edge.AmountText != "" {
+			writeGraphMLData(&sb, "amount_text", edge.AmountText)
+		}
+		writeGraphMLData(&sb, "count", fmt.Sprintf("%d", edge.Count))
+		sb.WriteString("    </edge>\n")
+	}
+	sb.WriteString("  </graph>\n")
+	sb.WriteString("</graphml>\n")
+	return sb.String()
+}
+
+func writeGraphMLData(sb *strings.Builder, key, value string) {
+	sb.WriteString(fmt.Sprintf(`      <data key="%s">`, key))
+	_ = xml.EscapeText(sb, []byte(value))
+	sb.WriteString("</data>\n")
+}
+
+// ToGraphJSON 生成包含节点、边、地址标签和数量的 JSON
+func (tt *TransferTracker) ToGraphJSON(tokenDetails map[common.Address]*TokenPrice, labels map[common.Address]string) ([]byte, error) {
+	return json.Marshal(tt.Graph(tokenDetails, labels))
+}
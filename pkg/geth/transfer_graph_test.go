@@ -0,0 +1,73 @@
+package geth
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func newGraphTestTracker() *TransferTracker {
+	tt := NewTransferTracker("0xabc")
+	user := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	pool := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	tt.AddTransfer(user, pool, USDT.Address, big.NewInt(1e18))
+	tt.AddTransfer(pool, user, WBNB.Address, big.NewInt(2e15))
+	tt.AddTransfer(user, pool, USDT.Address, big.NewInt(5e17))
+	return tt
+}
+
+func TestTransferGraphDeterministic(t *testing.T) {
+	tokenDetails := map[common.Address]*TokenPrice{USDT.Address: &USDT}
+	labels := map[common.Address]string{common.HexToAddress("0x2222222222222222222222222222222222222222"): "Pool"}
+
+	want := `digraph transfers {
+  rankdir=LR;
+  node [shape=box, style="rounded,filled", fillcolor=lightblue];
+  edge [fontsize=10];
+
+  "0x1111111111111111111111111111111111111111" -> "0x2222222222222222222222222222222222222222" [label="1.500000 USDT"];
+  "0x2222222222222222222222222222222222222222" -> "0x1111111111111111111111111111111111111111" [label="2000000000000000\n0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c"];
+}
+`
+	for i := 0; i < 20; i++ {
+		if got := newGraphTestTracker().ToDOT(tokenDetails); got != want {
+			t.Fatalf("unexpected DOT output:\n%s", got)
+		}
+	}
+
+	mermaid := newGraphTestTracker().ToMermaid(tokenDetails, labels)
+	if !strings.Contains(mermaid, `n1["Pool<br/>0x2222222222222222222222222222222222222222"]`) ||
+		!strings.Contains(mermaid, `n0 -->|"1.500000 USDT"| n1`) {
+		t.Fatalf("unexpected mermaid output:\n%s", mermaid)
+	}
+
+	graphML := newGraphTestTracker().ToGraphML(tokenDetails, labels)
+	if strings.Count(graphML, "<edge ") != 2 || strings.Count(graphML, "<node ") != 2 {
+		t.Fatalf("unexpected graphml output:\n%s", graphML)
+	}
+
+	data, err := newGraphTestTracker().ToGraphJSON(tokenDetails, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var graph TransferGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Edges) != 2 || graph.Edges[0].AmountRaw != "1500000000000000000" || graph.Edges[0].Count != 2 || graph.Nodes[1].Label != "Pool" {
+		t.Fatalf("unexpected graph json: %s", data)
+	}
+}
+
+func TestTransferGraphDOTEscape(t *testing.T) {
+	pool := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	labels := map[common.Address]string{pool: `Pool\x"y`}
+	dot := newGraphTestTracker().Graph(nil, labels).ToDOT()
+	want := `  "0x2222222222222222222222222222222222222222" [label="Pool\\x\"y\n0x2222222222222222222222222222222222222222"];`
+	if !strings.Contains(dot, want) {
+		t.Fatalf("DOT output missing %s:\n%s", want, dot)
+	}
+}
@@ -0,0 +1,252 @@
+package geth
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/lonelybeanz/tools/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// FIFOMatch 一笔转入与一笔转出按先进先出配对的结果。
+// In 为 nil 表示转出的资金来自交易前已有的余额，Out 为 nil 表示转入的资金在交易结束时仍留在账户中。
+type FIFOMatch struct {
+	In     *TransferRecord
+	Out    *TransferRecord
+	Amount *big.Int
+}
+
+// ReceivedBefore 返回账户在发出 sent 之前收到的所有转账（任意代币），按写入顺序排列
+func (tt *TransferTracker) ReceivedBefore(account common.Address, sent *TransferRecord) []*TransferRecord {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
+	records := make([]*TransferRecord, 0)
+	for _, idx := range tt.byAccount[account] {
+		if idx >= sent.Seq {
+			break
+		}
+		if record := tt.transfers[idx]; record.To == account {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// SentAfter 返回账户在收到 received 之后转出的所有转账（任意代币），按写入顺序排列
+func (tt *TransferTracker) SentAfter(account common.Address, received *TransferRecord) []*TransferRecord {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
+	records := make([]*TransferRecord, 0)
+	for _, idx := range tt.byAccount[account] {
+		if idx <= received.Seq {
+			continue
+		}
+		if record := tt.transfers[idx]; record.From == account {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// MatchFIFO 按写入顺序把账户某个代币的转出与之前的转入做先进先出配对，
+// 可以用来回答"这笔转出的资金来自哪几笔转入"。
+func (tt *TransferTracker) MatchFIFO(account, token common.Address) []*FIFOMatch {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
+	type lot struct {
+		record    *TransferRecord
+		remaining *big.Int
+	}
+	lots := make([]*lot, 0)
+	matches := make([]*FIFOMatch, 0)
+
+	key := accountToken{account: account, token: token}
+	ins, outs := tt.incoming[key], tt.outgoing[key]
+	i, j := 0, 0
+	for i < len(ins) || j < len(outs) {
+		// 自转账同时出现在转入和转出中，先记转入再记转出
+		if j >= len(outs) || (i < len(ins) && ins[i] <= outs[j]) {
+			record := tt.transfers[ins[i]]
+			lots = append(lots, &lot{record: record, remaining: new(big.Int).Set(record.Amount)})
+			i++
+			continue
+		}
+
+		record := tt.transfers[outs[j]]
+		j++
+		left := new(big.Int).Set(record.Amount)
+		for left.Sign() > 0 && len(lots) > 0 {
+			head := lots[0]
+			amount := new(big.Int).Set(left)
+			if head.remaining.Cmp(left) < 0 {
+				amount.Set(head.remaining)
+			}
+			matches = append(matches, &FIFOMatch{In: head.record, Out: record, Amount: amount})
+			head.remaining.Sub(head.remaining, amount)
+			left.Sub(left, amount)
+			if head.remaining.Sign() == 0 {
+				lots = lots[1:]
+			}
+		}
+		if left.Sign() > 0 {
+			matches = append(matches, &FIFOMatch{Out: record, Amount: left})
+		}
+	}
+
+	for _, l := range lots {
+		if l.remaining.Sign() > 0 {
+			matches = append(matches, &FIFOMatch{In: l.record, Amount: l.remaining})
+		}
+	}
+	return matches
+}
+
+// transferSource 根据解析结果判断事件类型：WBNB 的 Deposit 由代币合约转出，Withdrawal 转入代币合约
+func transferSource(t *TransferToken) TransferSource {
+	if !t.IsWBNB {
+		return SourceEvent
+	}
+	if t.From == t.Token {
+		return SourceWrap
+	}
+	return SourceUnwrap
+}
+
+// addLogTransfers 按 log index 顺序写入事件转账，返回包含 Swap 事件的交易
+func addLogTransfers(tt *TransferTracker, logs []*types.Log) map[common.Hash]bool {
+	sorted := append(make([]*types.Log, 0, len(logs)), logs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Index < sorted[j].Index
+	})
+
+	swapHashs := make(map[common.Hash]bool)
+	for _, l := range sorted {
+		transferToken, isSwap := ParseTokenEventLog(context.Background(), l)
+		if isSwap {
+			swapHashs[l.TxHash] = true
+		}
+		if transferToken == nil {
+			continue
+		}
+		tt.AddTransferWithMeta(transferToken.From, transferToken.To, transferToken.Token, transferToken.Amount, TransferMeta{
+			Source:   transferSource(transferToken),
+			Contract: l.Address,
+			LogIndex: int(l.Index),
+		})
+	}
+	return swapHashs
+}
+
+// addNativeTransfers 写入调用帧中的原生代币转账
+func addNativeTransfers(tt *TransferTracker, nativeCalls []*NativeTransfer) {
+	for _, v := range nativeCalls {
+		tt.AddTransferWithMeta(v.From, v.To, BNB.Address, v.Amount, TransferMeta{
+			Source:    SourceNativeCall,
+			Contract:  v.From,
+			LogIndex:  -1,
+			TracePath: v.TracePath,
+		})
+	}
+}
+
+// NewTransferTrackerFromLogs 由回执事件和 callTracer 结果构建转账记录，与 CalculateTransactionVolume 使用相同的数据。
+// 事件按 log index 写入，原生代币转账排在事件之后；需要按实际执行顺序时使用 NewTransferTrackerFromTrace。
+func NewTransferTrackerFromLogs(txHash string, logs []*types.Log, root *TraceCall) *TransferTracker {
+	return NewTransferTrackerFromLogsContext(context.Background(), txHash, logs, root)
+}
+
+// NewTransferTrackerFromLogsContext 与 NewTransferTrackerFromLogs 相同，span 挂在 ctx 的链路下
+func NewTransferTrackerFromLogsContext(ctx context.Context, txHash string, logs []*types.Log, root *TraceCall) *TransferTracker {
+	_, span := tracing.Start(ctx, "geth.NewTransferTrackerFromLogs", attribute.String("tx.hash", txHash), attribute.Int("logs", len(logs)))
+	defer span.End()
+
+	tt := NewTransferTracker(txHash)
+	addLogTransfers(tt, logs)
+	if root != nil {
+		addNativeTransfers(tt, ParseNativeFromTrace(root))
+	}
+	return tt
+}
+
+// NewTransferTrackerFromTrace 从 TraceTransactionWithLogs 的结果按实际执行顺序构建转账记录：
+// 原生代币转账在进入调用帧时记录，事件按 position 穿插在子调用之间。失败的调用帧及其子调用会被回滚，不计入。
+func NewTransferTrackerFromTrace(txHash string, root *TraceCall) *TransferTracker {
+	return NewTransferTrackerFromTraceContext(context.Background(), txHash, root)
+}
+
+// NewTransferTrackerFromTraceContext 与 NewTransferTrackerFromTrace 相同，span 挂在 ctx 的链路下
+func NewTransferTrackerFromTraceContext(ctx context.Context, txHash string, root *TraceCall) *TransferTracker {
+	_, span := tracing.Start(ctx, "geth.NewTransferTrackerFromTrace", attribute.String("tx.hash", txHash))
+	defer span.End()
+
+	tt := NewTransferTracker(txHash)
+	if root == nil {
+		return tt
+	}
+
+	addLogs := func(c *TraceCall, position int) {
+		for _, tl := range c.Logs {
+			if int(hexToUint64(tl.Position)) != position {
+				continue
+			}
+			l := tl.toLog()
+			l.TxHash = common.HexToHash(txHash)
+			addLogTransfers(tt, []*types.Log{l})
+		}
+	}
+
+	var walk func(c *TraceCall, path []int)
+	walk = func(c *TraceCall, path []int) {
+		if c.Error != "" {
+			return
+		}
+		value := HexToBigInt(c.Value)
+		if value != nil && value.Sign() > 0 {
+			addNativeTransfers(tt, []*NativeTransfer{{
+				From:      common.HexToAddress(c.From),
+				To:        common.HexToAddress(c.To),
+				Amount:    value,
+				TracePath: path,
+			}})
+		}
+		for i, sub := range c.Calls {
+			addLogs(c, i)
+			walk(sub, append(path, i))
+		}
+		addLogs(c, len(c.Calls))
+	}
+
+	walk(root, nil)
+	return tt
+}
+
+func (tl *TraceLog) toLog() *types.Log {
+	topics := make([]common.Hash, 0, len(tl.Topics))
+	for _, t := range tl.Topics {
+		topics = append(topics, common.HexToHash(t))
+	}
+	return &types.Log{
+		Address: common.HexToAddress(tl.Address),
+		Topics:  topics,
+		Data:    common.FromHex(tl.Data),
+		Index:   uint(hexToUint64(tl.Index)),
+	}
+}
+
+func hexToUint64(s string) uint64 {
+	if s == "" {
+		return 0
+	}
+	v, err := hexutil.DecodeUint64(s)
+	if err != nil {
+		return 0
+	}
+	return v
+}
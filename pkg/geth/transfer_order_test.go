@@ -0,0 +1,95 @@
+package geth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestTransferTrackerMatchFIFO(t *testing.T) {
+	tt := NewTransferTracker("")
+	token := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+	a, b, c := common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")
+
+	tt.AddTransfer(a, b, token, big.NewInt(5))
+	tt.AddTransfer(a, b, token, big.NewInt(3))
+	tt.AddTransfer(b, c, token, big.NewInt(6))
+	tt.AddTransfer(b, c, token, big.NewInt(4))
+
+	out := tt.GetTransactionsByAccount(b)[2]
+	if got := tt.ReceivedBefore(b, out); len(got) != 2 {
+		t.Fatalf("ReceivedBefore: want 2 records, got %d", len(got))
+	}
+
+	matches := tt.MatchFIFO(b, token)
+	want := []struct {
+		in, out int // Seq，-1 表示 nil
+		amount  int64
+	}{
+		{0, 2, 5},
+		{1, 2, 1},
+		{1, 3, 2},
+		{-1, 3, 2},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("want %d matches, got %d", len(want), len(matches))
+	}
+	seq := func(r *TransferRecord) int {
+		if r == nil {
+			return -1
+		}
+		return r.Seq
+	}
+	for i, w := range want {
+		m := matches[i]
+		if seq(m.In) != w.in || seq(m.Out) != w.out || m.Amount.Int64() != w.amount {
+			t.Fatalf("match %d: got in=%d out=%d amount=%s", i, seq(m.In), seq(m.Out), m.Amount)
+		}
+	}
+}
+
+func TestNewTransferTrackerFromTrace(t *testing.T) {
+	user, router, pair := common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")
+	token := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+
+	transfer := func(index, position string, from, to common.Address) *TraceLog {
+		l := transferLog(0, token, from, to, 7)
+		topics := make([]string, 0, len(l.Topics))
+		for _, topic := range l.Topics {
+			topics = append(topics, topic.Hex())
+		}
+		return &TraceLog{Address: token.Hex(), Topics: topics, Data: common.Bytes2Hex(l.Data), Index: index, Position: position}
+	}
+
+	root := &TraceCall{
+		From:  user.Hex(),
+		To:    router.Hex(),
+		Value: "0x64",
+		Calls: []*TraceCall{
+			{From: router.Hex(), To: pair.Hex(), Value: "0x1", Error: "execution reverted"},
+			{From: router.Hex(), To: pair.Hex(), Value: "0x2"},
+		},
+		Logs: []*TraceLog{
+			transfer("0x1", "0x2", pair, user),
+			transfer("0x0", "0x1", router, pair),
+		},
+	}
+
+	records := NewTransferTrackerFromTrace("0xabc", root).GetTransfers()
+	if len(records) != 4 {
+		t.Fatalf("want 4 records, got %d", len(records))
+	}
+	if records[0].Source != SourceNativeCall || len(records[0].TracePath) != 0 || records[0].Amount.Int64() != 100 {
+		t.Fatalf("unexpected root call record: %+v", records[0])
+	}
+	if records[1].Source != SourceEvent || records[1].LogIndex != 0 || records[1].From != router {
+		t.Fatalf("unexpected first event record: %+v", records[1])
+	}
+	if records[2].Source != SourceNativeCall || len(records[2].TracePath) != 1 || records[2].TracePath[0] != 1 {
+		t.Fatalf("unexpected sub call record: %+v", records[2])
+	}
+	if records[3].LogIndex != 1 || records[3].Contract != token || records[3].Seq != 3 {
+		t.Fatalf("unexpected last event record: %+v", records[3])
+	}
+}
@@ -1,20 +1,40 @@
 package geth
 
 import (
-	"fmt"
-	"math"
 	"math/big"
-	"strings"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/lonelybeanz/tools/pkg/log"
 )
 
 // TransactionTracker 用于跟踪账户间的代币转账
+// 写入时同步维护按账户、按代币的索引和累计收支，查询不需要遍历全部转账；可以并发调用 AddTransfer。
 type TransferTracker struct {
+	mu sync.RWMutex
 	// 存储所有转账记录
 	transfers []*TransferRecord
 	TxHash    string
+
+	byAccount map[common.Address][]int // 账户 -> 相关转账下标
+	byToken   map[common.Address][]int // 代币 -> 转账下标
+	incoming  map[accountToken][]int   // (账户, 代币) -> 转入下标
+	outgoing  map[accountToken][]int   // (账户, 代币) -> 转出下标
+	inTotal   map[accountToken]*big.Int
+	outTotal  map[accountToken]*big.Int
+
+	// 按首次出现顺序保存，保证 GetAllXxx 的结果顺序稳定
+	accounts []common.Address
+	tokens   []common.Address
+	froms    []common.Address
+	tos      []common.Address
+	seenFrom map[common.Address]bool
+	seenTo   map[common.Address]bool
+}
+
+type accountToken struct {
+	account common.Address
+	token   common.Address
 }
 
 // TransferRecord 表示一次转账记录
@@ -23,6 +43,31 @@ type TransferRecord struct {
 	To     common.Address // 转入账户
 	Token  common.Address // 代币地址
 	Amount *big.Int       // 转账数量
+
+	Seq       int            // 写入顺序，从 0 开始；按执行顺序写入时即为资金流转顺序
+	Source    TransferSource // 转账来源
+	Contract  common.Address // 发出事件的合约；原生转账为发起调用的地址
+	LogIndex  int            // 事件的 log index，非事件来源为 -1
+	TracePath []int          // 调用帧路径，例如 [0 2 1] 表示根调用的第 1 个子调用的第 3 个子调用的第 2 个子调用
+}
+
+// TransferSource 转账记录的来源
+type TransferSource string
+
+const (
+	SourceUnknown    TransferSource = ""
+	SourceEvent      TransferSource = "event"       // ERC20 Transfer 事件
+	SourceNativeCall TransferSource = "native_call" // 调用帧中的原生代币转账
+	SourceWrap       TransferSource = "wrap"        // WBNB Deposit
+	SourceUnwrap     TransferSource = "unwrap"      // WBNB Withdrawal
+)
+
+// TransferMeta 转账记录的来源信息
+type TransferMeta struct {
+	Source    TransferSource
+	Contract  common.Address
+	LogIndex  int
+	TracePath []int
 }
 
 // NewTransactionTracker 创建一个新的TransactionTracker实例
@@ -30,136 +75,172 @@ func NewTransferTracker(txHash string) *TransferTracker {
 	return &TransferTracker{
 		TxHash:    txHash,
 		transfers: make([]*TransferRecord, 0),
+		byAccount: make(map[common.Address][]int),
+		byToken:   make(map[common.Address][]int),
+		incoming:  make(map[accountToken][]int),
+		outgoing:  make(map[accountToken][]int),
+		inTotal:   make(map[accountToken]*big.Int),
+		outTotal:  make(map[accountToken]*big.Int),
+		accounts:  make([]common.Address, 0),
+		tokens:    make([]common.Address, 0),
+		froms:     make([]common.Address, 0),
+		tos:       make([]common.Address, 0),
+		seenFrom:  make(map[common.Address]bool),
+		seenTo:    make(map[common.Address]bool),
 	}
 }
 
 // AddTransfer 添加一笔转账记录
 func (tt *TransferTracker) AddTransfer(from, to, token common.Address, amount *big.Int) {
+	tt.AddTransferWithMeta(from, to, token, amount, TransferMeta{LogIndex: -1})
+}
+
+// AddTransferWithMeta 添加一笔带来源信息的转账记录
+func (tt *TransferTracker) AddTransferWithMeta(from, to, token common.Address, amount *big.Int, meta TransferMeta) {
 	record := &TransferRecord{
-		From:   from,
-		To:     to,
-		Token:  token,
-		Amount: new(big.Int).Set(amount), // 创建amount的副本以避免外部修改
+		From:      from,
+		To:        to,
+		Token:     token,
+		Amount:    new(big.Int).Set(amount), // 创建amount的副本以避免外部修改
+		Source:    meta.Source,
+		Contract:  meta.Contract,
+		LogIndex:  meta.LogIndex,
+		TracePath: append([]int(nil), meta.TracePath...),
 	}
 
-	tt.transfers = append(tt.transfers, record)
+	tt.mu.Lock()
+	tt.addRecordLocked(record)
+	tt.mu.Unlock()
 
 	log.Debugf("{%s} Added transfer:[%s] %s -> %s (%s)", tt.TxHash, token.String(), from.String(), to.String(), amount.String())
 }
 
+// addRecordLocked 追加记录并更新索引，调用方需持有写锁
+func (tt *TransferTracker) addRecordLocked(record *TransferRecord) {
+	idx := len(tt.transfers)
+	record.Seq = idx
+	tt.transfers = append(tt.transfers, record)
+
+	if _, ok := tt.byAccount[record.From]; !ok {
+		tt.accounts = append(tt.accounts, record.From)
+	}
+	tt.byAccount[record.From] = append(tt.byAccount[record.From], idx)
+	if record.To != record.From {
+		if _, ok := tt.byAccount[record.To]; !ok {
+			tt.accounts = append(tt.accounts, record.To)
+		}
+		tt.byAccount[record.To] = append(tt.byAccount[record.To], idx)
+	}
+
+	if _, ok := tt.byToken[record.Token]; !ok {
+		tt.tokens = append(tt.tokens, record.Token)
+	}
+	tt.byToken[record.Token] = append(tt.byToken[record.Token], idx)
+
+	if !tt.seenFrom[record.From] {
+		tt.seenFrom[record.From] = true
+		tt.froms = append(tt.froms, record.From)
+	}
+	if !tt.seenTo[record.To] {
+		tt.seenTo[record.To] = true
+		tt.tos = append(tt.tos, record.To)
+	}
+
+	inKey := accountToken{account: record.To, token: record.Token}
+	tt.incoming[inKey] = append(tt.incoming[inKey], idx)
+	if _, ok := tt.inTotal[inKey]; !ok {
+		tt.inTotal[inKey] = new(big.Int)
+	}
+	tt.inTotal[inKey].Add(tt.inTotal[inKey], record.Amount)
+
+	outKey := accountToken{account: record.From, token: record.Token}
+	tt.outgoing[outKey] = append(tt.outgoing[outKey], idx)
+	if _, ok := tt.outTotal[outKey]; !ok {
+		tt.outTotal[outKey] = new(big.Int)
+	}
+	tt.outTotal[outKey].Add(tt.outTotal[outKey], record.Amount)
+}
+
 // GetTransfers returns all transfer records.
 func (tt *TransferTracker) GetTransfers() []*TransferRecord {
-	return tt.transfers
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
+	return append(make([]*TransferRecord, 0, len(tt.transfers)), tt.transfers...)
+}
+
+// recordsLocked 按下标取出记录，调用方需持有读锁
+func (tt *TransferTracker) recordsLocked(indexes []int) []*TransferRecord {
+	records := make([]*TransferRecord, 0, len(indexes))
+	for _, idx := range indexes {
+		records = append(records, tt.transfers[idx])
+	}
+	return records
 }
 
 // GetIncoming 计算账户收到的特定代币总量
 func (tt *TransferTracker) GetIncoming(account, token common.Address) *big.Int {
-	total := new(big.Int)
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	for _, tx := range tt.transfers {
-		// 如果是转入账户且代币匹配
-		if tx.To == account && tx.Token == token {
-			total.Add(total, tx.Amount)
-		}
+	total := new(big.Int)
+	if in, ok := tt.inTotal[accountToken{account: account, token: token}]; ok {
+		total.Set(in)
 	}
-
 	return total
 }
 
 // GetOutgoing 计算账户转出的特定代币总量
 func (tt *TransferTracker) GetOutgoing(account, token common.Address) *big.Int {
-	total := new(big.Int)
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	for _, tx := range tt.transfers {
-		// 如果是转出账户且代币匹配
-		if tx.From == account && tx.Token == token {
-			total.Add(total, tx.Amount)
-		}
+	total := new(big.Int)
+	if out, ok := tt.outTotal[accountToken{account: account, token: token}]; ok {
+		total.Set(out)
 	}
-
 	return total
 }
 
 func (tt *TransferTracker) GetAllTokens() []common.Address {
-	tokens := make([]common.Address, 0)
-
-	for _, tx := range tt.transfers {
-		if !contains(tokens, tx.Token) {
-			tokens = append(tokens, tx.Token)
-		}
-	}
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	return tokens
+	return append(make([]common.Address, 0, len(tt.tokens)), tt.tokens...)
 }
 
 func (tt *TransferTracker) GetAllFrom() []common.Address {
-	addresses := make([]common.Address, 0)
-	seen := make(map[common.Address]bool)
-
-	for _, tx := range tt.transfers {
-		if !seen[tx.From] {
-			seen[tx.From] = true
-			addresses = append(addresses, tx.From)
-		}
-	}
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	return addresses
+	return append(make([]common.Address, 0, len(tt.froms)), tt.froms...)
 }
 
 func (tt *TransferTracker) GetAllTo() []common.Address {
-	addresses := make([]common.Address, 0)
-	seen := make(map[common.Address]bool)
-
-	for _, tx := range tt.transfers {
-		if !seen[tx.To] {
-			seen[tx.To] = true
-			addresses = append(addresses, tx.To)
-		}
-	}
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	return addresses
+	return append(make([]common.Address, 0, len(tt.tos)), tt.tos...)
 }
 
 func (tt *TransferTracker) GetAllAccounts() []common.Address {
-	accounts := make([]common.Address, 0)
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	for _, tx := range tt.transfers {
-		if !contains(accounts, tx.From) {
-			accounts = append(accounts, tx.From)
-		}
-		if !contains(accounts, tx.To) {
-			accounts = append(accounts, tx.To)
-		}
-	}
-
-	return accounts
+	return append(make([]common.Address, 0, len(tt.accounts)), tt.accounts...)
 }
 
 func (tt *TransferTracker) GetTokenTransactions(token common.Address) []*TransferRecord {
-	transactions := make([]*TransferRecord, 0)
-
-	for _, tx := range tt.transfers {
-		if tx.Token == token {
-			transactions = append(transactions, tx)
-		}
-	}
-
-	return transactions
+	return tt.GetTransactionsByToken(token)
 }
 
 // GetTransferCounts returns the number of incoming and outgoing transfers for a specific account and token.
 func (tt *TransferTracker) GetTransferCounts(account, token common.Address) (inCount, outCount int) {
-	for _, tx := range tt.transfers {
-		if tx.Token == token {
-			if tx.To == account {
-				inCount++
-			}
-			if tx.From == account {
-				outCount++
-			}
-		}
-	}
-	return
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
+	key := accountToken{account: account, token: token}
+	return len(tt.incoming[key]), len(tt.outgoing[key])
 }
 
 // TraceUltimateSource traces a transfer backward to find the original sender in a chain.
@@ -171,6 +252,9 @@ func (tt *TransferTracker) GetTransferCounts(account, token common.Address) (inC
 // `token`: The token being transferred.
 // `nonIntermediate`: A set of addresses (e.g., your own wallets) that are considered final sources/sinks and will stop the trace.
 func (tt *TransferTracker) TraceUltimateSource(address, token common.Address, nonIntermediate map[common.Address]bool) common.Address {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
 	current := address
 	visited := make(map[common.Address]bool) // To prevent infinite loops in case of cycles
 
@@ -185,34 +269,23 @@ func (tt *TransferTracker) TraceUltimateSource(address, token common.Address, no
 			return current
 		}
 
-		netBalance := tt.GetNetBalance(current, token)
-		inCount, outCount := tt.GetTransferCounts(current, token)
-
 		// An address is intermediate if it's a simple 1-in-1-out pass-through for the token.
-		if netBalance.Sign() == 0 && inCount == 1 && outCount == 1 {
-			// It's an intermediate node. Find the single incoming transfer to trace back.
-			var sourceFound bool
-			for _, tx := range tt.transfers {
-				if tx.To == current && tx.Token == token {
-					current = tx.From // Move to the previous address in the chain.
-					sourceFound = true
-					break
-				}
-			}
-			if !sourceFound {
-				// Should not happen if inCount is 1, but as a safeguard.
-				return current
-			}
-		} else {
+		key := accountToken{account: current, token: token}
+		if !tt.isIntermediateLocked(key) {
 			// Not an intermediate node, so it's the source in this context.
 			return current
 		}
+		// It's an intermediate node. Move to the previous address in the chain.
+		current = tt.transfers[tt.incoming[key][0]].From
 	}
 }
 
 // TraceUltimateSink traces a transfer forward to find the final recipient in a chain.
 // It skips over "intermediate" addresses using the same logic as TraceUltimateSource.
 func (tt *TransferTracker) TraceUltimateSink(address, token common.Address, nonIntermediate map[common.Address]bool) common.Address {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
 	current := address
 	visited := make(map[common.Address]bool) // To prevent infinite loops
 
@@ -226,63 +299,82 @@ func (tt *TransferTracker) TraceUltimateSink(address, token common.Address, nonI
 			return current
 		}
 
-		netBalance := tt.GetNetBalance(current, token)
-		inCount, outCount := tt.GetTransferCounts(current, token)
-
-		if netBalance.Sign() == 0 && inCount == 1 && outCount == 1 {
-			var sinkFound bool
-			for _, tx := range tt.transfers {
-				if tx.From == current && tx.Token == token {
-					current = tx.To // Move to the next address in the chain.
-					sinkFound = true
-					break
-				}
-			}
-			if !sinkFound {
-				return current
-			}
-		} else {
+		key := accountToken{account: current, token: token}
+		if !tt.isIntermediateLocked(key) {
 			return current
 		}
+		current = tt.transfers[tt.outgoing[key][0]].To // Move to the next address in the chain.
+	}
+}
+
+// isIntermediateLocked 判断账户对该代币是否为 1 进 1 出且净额为 0 的中转地址，调用方需持有读锁
+func (tt *TransferTracker) isIntermediateLocked(key accountToken) bool {
+	return len(tt.incoming[key]) == 1 && len(tt.outgoing[key]) == 1 && tt.netBalanceLocked(key).Sign() == 0
+}
+
+// netBalanceLocked 调用方需持有读锁
+func (tt *TransferTracker) netBalanceLocked(key accountToken) *big.Int {
+	net := new(big.Int)
+	if in, ok := tt.inTotal[key]; ok {
+		net.Add(net, in)
+	}
+	if out, ok := tt.outTotal[key]; ok {
+		net.Sub(net, out)
 	}
+	return net
 }
 
 // GetNetBalance 计算账户特定代币的净余额（收到 - 转出）
 func (tt *TransferTracker) GetNetBalance(account, token common.Address) *big.Int {
-	incoming := tt.GetIncoming(account, token)
-	outgoing := tt.GetOutgoing(account, token)
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
 	// 计算净余额 = 收到 - 转出
-	net := new(big.Int).Sub(incoming, outgoing)
-	return net
+	return tt.netBalanceLocked(accountToken{account: account, token: token})
 }
 
-// GetTransactionsByAccount 获取与特定账户相关的所有交易
-func (tt *TransferTracker) GetTransactionsByAccount(account common.Address) []*TransferRecord {
-	records := make([]*TransferRecord, 0)
+// NetBalances 返回所有账户所有代币的非零净余额（收到 - 转出）：account -> token -> net
+func (tt *TransferTracker) NetBalances() map[common.Address]map[common.Address]*big.Int {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	for _, tx := range tt.transfers {
-		// 如果是转出账户或转入账户
-		if tx.From == account || tx.To == account {
-			records = append(records, tx)
+	balances := make(map[common.Address]map[common.Address]*big.Int)
+	add := func(key accountToken) {
+		if _, ok := balances[key.account][key.token]; ok {
+			return
 		}
+		net := tt.netBalanceLocked(key)
+		if net.Sign() == 0 {
+			return
+		}
+		if _, ok := balances[key.account]; !ok {
+			balances[key.account] = make(map[common.Address]*big.Int)
+		}
+		balances[key.account][key.token] = net
+	}
+	for key := range tt.inTotal {
+		add(key)
 	}
+	for key := range tt.outTotal {
+		add(key)
+	}
+	return balances
+}
 
-	return records
+// GetTransactionsByAccount 获取与特定账户相关的所有交易
+func (tt *TransferTracker) GetTransactionsByAccount(account common.Address) []*TransferRecord {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
+	return tt.recordsLocked(tt.byAccount[account])
 }
 
 // GetTransactionsByToken 获取特定代币的所有交易
 func (tt *TransferTracker) GetTransactionsByToken(token common.Address) []*TransferRecord {
-	records := make([]*TransferRecord, 0)
-
-	for _, tx := range tt.transfers {
-		// 如果是该代币的交易
-		if tx.Token == token {
-			records = append(records, tx)
-		}
-	}
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
 
-	return records
+	return tt.recordsLocked(tt.byToken[token])
 }
 
 func contains[T comparable](slice []T, value T) bool {
@@ -293,51 +385,3 @@ func contains[T comparable](slice []T, value T) bool {
 	}
 	return false
 }
-
-// ToDOT generates a string representation of the transfer graph in DOT format.
-// This can be used with tools like Graphviz to visualize the flow.
-// tokenDetails is a map from token address to its details (symbol, decimals).
-func (tt *TransferTracker) ToDOT(tokenDetails map[common.Address]*TokenPrice) string {
-	var sb strings.Builder
-	sb.WriteString("digraph transfers {\n")
-	sb.WriteString("  rankdir=LR;\n")
-	sb.WriteString(`  node [shape=box, style="rounded,filled", fillcolor=lightblue];` + "\n")
-	sb.WriteString("  edge [fontsize=10];\n\n")
-
-	// Aggregate transfers between the same two accounts for the same token
-	type transferKey struct {
-		from, to, token common.Address
-	}
-	aggregated := make(map[transferKey]*big.Int)
-
-	for _, tx := range tt.transfers {
-		key := transferKey{from: tx.From, to: tx.To, token: tx.Token}
-		if _, ok := aggregated[key]; !ok {
-			aggregated[key] = new(big.Int)
-		}
-		aggregated[key].Add(aggregated[key], tx.Amount)
-	}
-
-	for key, amount := range aggregated {
-		from, to, tokenAddr := key.from, key.to, key.token
-
-		details, ok := tokenDetails[tokenAddr]
-		var label string
-		if ok && details.Decimal > 0 {
-			// Format amount with decimals
-			fAmount := new(big.Float).SetInt(amount)
-			powerOf10 := new(big.Float).SetFloat64(math.Pow10(details.Decimal))
-			fAmount.Quo(fAmount, powerOf10)
-
-			label = fmt.Sprintf(`"%s %s"`, fAmount.Text('f', 6), details.Symbol)
-		} else {
-			// Fallback to amount in wei and token address
-			label = fmt.Sprintf(`"%s\n%s"`, amount.String(), tokenAddr.Hex())
-		}
-
-		sb.WriteString(fmt.Sprintf(`  "%s" -> "%s" [label=%s];`+"\n", from.Hex(), to.Hex(), label))
-	}
-
-	sb.WriteString("}\n")
-	return sb.String()
-}
@@ -2,6 +2,7 @@ package geth
 
 import (
 	"math/big"
+	"sync"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -16,3 +17,74 @@ func TestTt(t *testing.T) {
 	t.Log(tt.GetNetBalance(from, token))
 
 }
+
+func TestTransferTrackerConcurrentAdd(t *testing.T) {
+	tt := NewTransferTracker("")
+	token := common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+	from, to := common.HexToAddress("0xDb18729070d3aBdC72F9cd57D3b949540Cc4486a"), common.HexToAddress("0x9999b0CdD35d7F3B281BA02EfC0d228486940515")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tt.AddTransfer(from, to, token, big.NewInt(1))
+				tt.GetNetBalance(to, token)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if in, out := tt.GetTransferCounts(to, token); in != 800 || out != 0 {
+		t.Fatalf("unexpected counts: in=%d out=%d", in, out)
+	}
+	balances := tt.NetBalances()
+	if balances[from][token].Int64() != -800 || balances[to][token].Int64() != 800 {
+		t.Fatalf("unexpected balances: %v", balances)
+	}
+}
+
+// newBlockSizedTracker 模拟一个区块内的转账规模：5000 笔转账、1000 个账户、50 种代币
+func newBlockSizedTracker() *TransferTracker {
+	tt := NewTransferTracker("")
+	accounts := make([]common.Address, 1000)
+	for i := range accounts {
+		accounts[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	tokens := make([]common.Address, 50)
+	for i := range tokens {
+		tokens[i] = common.BigToAddress(big.NewInt(int64(100000 + i)))
+	}
+	for i := 0; i < 5000; i++ {
+		tt.AddTransfer(accounts[i%len(accounts)], accounts[(i*7+3)%len(accounts)], tokens[i%len(tokens)], big.NewInt(int64(i+1)))
+	}
+	return tt
+}
+
+func BenchmarkTransferTrackerAdd(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		newBlockSizedTracker()
+	}
+}
+
+func BenchmarkTransferTrackerNetBalances(b *testing.B) {
+	tt := newBlockSizedTracker()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tt.NetBalances()
+	}
+}
+
+// BenchmarkTransferTrackerAllAccountsAllTokens 按账户 x 代币逐个查询净余额，对比 NetBalances
+func BenchmarkTransferTrackerAllAccountsAllTokens(b *testing.B) {
+	tt := newBlockSizedTracker()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, account := range tt.GetAllAccounts() {
+			for _, token := range tt.GetAllTokens() {
+				tt.GetNetBalance(account, token)
+			}
+		}
+	}
+}
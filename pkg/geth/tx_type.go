@@ -0,0 +1,144 @@
+package geth
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// TxTypeName 交易类型名称
+func TxTypeName(txType uint8) string {
+	switch txType {
+	case types.LegacyTxType:
+		return "legacy"
+	case types.AccessListTxType:
+		return "access_list"
+	case types.DynamicFeeTxType:
+		return "dynamic_fee"
+	case types.BlobTxType:
+		return "blob"
+	case types.SetCodeTxType:
+		return "set_code"
+	default:
+		return "unknown"
+	}
+}
+
+// Authorization EIP-7702 授权：Authority 把自己的代码委托给 Delegate。
+// 签名无法恢复出 Authority 时 Valid 为 false，这样的授权在链上会被跳过。
+type Authorization struct {
+	Authority common.Address `json:"authority"`
+	Delegate  common.Address `json:"delegate"` // 零地址表示撤销委托
+	ChainID   *big.Int       `json:"chain_id"`
+	Nonce     uint64         `json:"nonce"`
+	Valid     bool           `json:"valid"`
+}
+
+// TxTypeInfo 与交易类型相关的信息
+type TxTypeInfo struct {
+	Type             uint8            `json:"type"`
+	TypeName         string           `json:"type_name"`
+	ContractCreation bool             `json:"contract_creation"`
+	AccessListLength int              `json:"access_list_length"` // access list 中的地址数
+	GasFeeCap        *big.Int         `json:"gas_fee_cap,omitempty"`
+	GasTipCap        *big.Int         `json:"gas_tip_cap,omitempty"`
+	BlobHashes       []common.Hash    `json:"blob_hashes,omitempty"`
+	BlobGasFeeCap    *big.Int         `json:"blob_gas_fee_cap,omitempty"`
+	BlobGasUsed      uint64           `json:"blob_gas_used,omitempty"`
+	BlobGasPrice     *big.Int         `json:"blob_gas_price,omitempty"`
+	BlobFee          *big.Int         `json:"blob_fee,omitempty"` // BlobGasUsed * BlobGasPrice，需要回执
+	GasFee           *big.Int         `json:"gas_fee,omitempty"`  // 执行 gas 费用 + blob 费用，需要回执
+	Authorizations   []*Authorization `json:"authorizations,omitempty"`
+}
+
+// ParseTxType 解析交易类型相关字段，receipt 可以为 nil，此时不计算实际费用
+func ParseTxType(tx *types.Transaction, receipt *types.Receipt) *TxTypeInfo {
+	info := &TxTypeInfo{
+		Type:             tx.Type(),
+		TypeName:         TxTypeName(tx.Type()),
+		ContractCreation: tx.To() == nil,
+		AccessListLength: len(tx.AccessList()),
+	}
+
+	switch tx.Type() {
+	case types.DynamicFeeTxType, types.BlobTxType, types.SetCodeTxType:
+		info.GasFeeCap = tx.GasFeeCap()
+		info.GasTipCap = tx.GasTipCap()
+	}
+
+	if tx.Type() == types.BlobTxType {
+		info.BlobHashes = tx.BlobHashes()
+		info.BlobGasFeeCap = tx.BlobGasFeeCap()
+	}
+
+	if tx.Type() == types.SetCodeTxType {
+		for _, auth := range tx.SetCodeAuthorizations() {
+			a := &Authorization{
+				Delegate: auth.Address,
+				ChainID:  auth.ChainID.ToBig(),
+				Nonce:    auth.Nonce,
+			}
+			if authority, err := auth.Authority(); err == nil {
+				a.Authority = authority
+				a.Valid = true
+			}
+			info.Authorizations = append(info.Authorizations, a)
+		}
+	}
+
+	if receipt != nil {
+		info.GasFee = receiptGasFee(receipt)
+		if receipt.BlobGasPrice != nil {
+			info.BlobGasUsed = receipt.BlobGasUsed
+			info.BlobGasPrice = receipt.BlobGasPrice
+			info.BlobFee = new(big.Int).Mul(new(big.Int).SetUint64(receipt.BlobGasUsed), receipt.BlobGasPrice)
+		}
+	}
+	return info
+}
+
+// GetDelegation 查询 EOA 当前的 EIP-7702 委托目标，没有委托时第二个返回值为 false
+func GetDelegation(ctx context.Context, client *ethclient.Client, address common.Address) (common.Address, bool, error) {
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return common.Address{}, false, err
+	}
+	delegate, ok := types.ParseDelegation(code)
+	return delegate, ok, nil
+}
+
+// isEoaCode 没有代码，或者代码只是 EIP-7702 委托标记
+func isEoaCode(code []byte) bool {
+	if len(code) == 0 {
+		return true
+	}
+	_, ok := types.ParseDelegation(code)
+	return ok
+}
+
+// GetTxFlagForTx 与 GetTxFlag 相同，但能处理创建合约（to 为空）、blob 和 set-code 交易
+func GetTxFlagForTx(logs []*types.Log, tx *types.Transaction) string {
+	if tx.To() == nil {
+		if flag := GetTxFlag(logs, "", nil); flag != "" {
+			return flag
+		}
+		return "Deploy"
+	}
+
+	flag := GetTxFlag(logs, tx.To().Hex(), tx.Data())
+	switch tx.Type() {
+	case types.SetCodeTxType:
+		// 只设置委托、没有调用数据
+		if len(tx.Data()) == 0 && flag != "Swap" {
+			return "SetCode"
+		}
+	case types.BlobTxType:
+		if flag == "" || flag == "Transfer" || flag == "other" {
+			return "Blob"
+		}
+	}
+	return flag
+}
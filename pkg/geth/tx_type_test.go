@@ -0,0 +1,114 @@
+package geth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+func TestParseTxTypeSetCode(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	authority := crypto.PubkeyToAddress(key.PublicKey)
+	delegate := common.HexToAddress("0x63c0c19a282a1B52b07dD5a65b58948A07DAE32B")
+
+	auth, err := types.SignSetCode(key, types.SetCodeAuthorization{
+		ChainID: *uint256.NewInt(56),
+		Address: delegate,
+		Nonce:   7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x1")
+	tx := types.NewTx(&types.SetCodeTx{
+		ChainID:   uint256.NewInt(56),
+		To:        to,
+		GasTipCap: uint256.NewInt(1),
+		GasFeeCap: uint256.NewInt(2),
+		AuthList:  []types.SetCodeAuthorization{auth, {Address: delegate}},
+	})
+
+	info := ParseTxType(tx, nil)
+	if info.TypeName != "set_code" || info.ContractCreation {
+		t.Fatalf("unexpected type %+v", info)
+	}
+	if len(info.Authorizations) != 2 {
+		t.Fatalf("expected 2 authorizations, got %d", len(info.Authorizations))
+	}
+	a := info.Authorizations[0]
+	if !a.Valid || a.Authority != authority || a.Delegate != delegate || a.Nonce != 7 || a.ChainID.Int64() != 56 {
+		t.Fatalf("unexpected authorization %+v", a)
+	}
+	if info.Authorizations[1].Valid {
+		t.Fatal("unsigned authorization should be invalid")
+	}
+	if flag := GetTxFlagForTx(nil, tx); flag != "SetCode" {
+		t.Fatalf("expected SetCode, got %s", flag)
+	}
+}
+
+func TestParseTxTypeBlob(t *testing.T) {
+	hashes := []common.Hash{common.HexToHash("0x01aa"), common.HexToHash("0x01bb")}
+	tx := types.NewTx(&types.BlobTx{
+		ChainID:    uint256.NewInt(1),
+		To:         common.HexToAddress("0x2"),
+		GasTipCap:  uint256.NewInt(1),
+		GasFeeCap:  uint256.NewInt(2),
+		BlobFeeCap: uint256.NewInt(10),
+		BlobHashes: hashes,
+	})
+	receipt := &types.Receipt{
+		GasUsed:           21000,
+		EffectiveGasPrice: big.NewInt(2),
+		BlobGasUsed:       2 * 131072,
+		BlobGasPrice:      big.NewInt(3),
+	}
+
+	info := ParseTxType(tx, receipt)
+	if info.TypeName != "blob" || len(info.BlobHashes) != 2 || info.BlobGasFeeCap.Int64() != 10 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if info.BlobFee.Int64() != 2*131072*3 {
+		t.Fatalf("unexpected blob fee %s", info.BlobFee)
+	}
+	if info.GasFee.Int64() != 21000*2+2*131072*3 {
+		t.Fatalf("unexpected gas fee %s", info.GasFee)
+	}
+	if flag := GetTxFlagForTx(nil, tx); flag != "Blob" {
+		t.Fatalf("expected Blob, got %s", flag)
+	}
+}
+
+func TestGetTxFlagForTxDeploy(t *testing.T) {
+	tx := types.NewTx(&types.LegacyTx{Data: common.FromHex("0x6080604052")})
+	if flag := GetTxFlagForTx(nil, tx); flag != "Deploy" {
+		t.Fatalf("expected Deploy, got %s", flag)
+	}
+	if info := ParseTxType(tx, nil); !info.ContractCreation || info.TypeName != "legacy" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+}
+
+func TestLabelerDelegatedEOA(t *testing.T) {
+	eoa := common.HexToAddress("0x1111")
+	delegate := common.HexToAddress("0x2222")
+	reader := &fakeChainReader{code: map[common.Address][]byte{
+		eoa: types.AddressToDelegation(delegate),
+	}}
+	labeler := &AddressLabeler{client: reader, labels: map[common.Address]*AddressLabel{}, bots: map[common.Address]bool{}}
+	label, err := labeler.probe(context.Background(), eoa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label.Role != RoleEOA || label.Delegate == nil || *label.Delegate != delegate {
+		t.Fatalf("unexpected label %+v", label)
+	}
+	if !isEoaCode(types.AddressToDelegation(delegate)) || isEoaCode(common.FromHex("0x6080")) {
+		t.Fatal("isEoaCode mismatch")
+	}
+}
@@ -1,8 +1,6 @@
 package geth
 
 import (
-	"context"
-	"fmt"
 	"math"
 	"math/big"
 
@@ -17,30 +15,32 @@ import (
  */
 
 type NativeTransfer struct {
-	From   common.Address
-	To     common.Address
-	Amount *big.Int
+	From      common.Address
+	To        common.Address
+	Amount    *big.Int
+	TracePath []int // 调用帧路径，根调用为空
 }
 
 func ParseNativeFromTrace(root *TraceCall) []*NativeTransfer {
 	var out []*NativeTransfer
 
-	var walk func(c *TraceCall)
-	walk = func(c *TraceCall) {
+	var walk func(c *TraceCall, path []int)
+	walk = func(c *TraceCall, path []int) {
 		value := HexToBigInt(c.Value)
 		if value != nil && value.Sign() > 0 {
 			out = append(out, &NativeTransfer{
-				From:   common.HexToAddress(c.From),
-				To:     common.HexToAddress(c.To),
-				Amount: new(big.Int).Set(value),
+				From:      common.HexToAddress(c.From),
+				To:        common.HexToAddress(c.To),
+				Amount:    new(big.Int).Set(value),
+				TracePath: append([]int(nil), path...),
 			})
 		}
-		for _, sub := range c.Calls {
-			walk(sub)
+		for i, sub := range c.Calls {
+			walk(sub, append(path, i))
 		}
 	}
 
-	walk(root)
+	walk(root, nil)
 	return out
 }
 
@@ -74,6 +74,7 @@ type AssetChange struct {
 	Tokens map[common.Address]*big.Int // tokenAddress -> amount
 }
 
+// CalculateTransactionVolume 计算每个地址的代币净变化，闪电贷的本金借出与归还不计入，手续费计入
 func CalculateTransactionVolume(
 	logs []*types.Log,
 	traceRoot *TraceCall,
@@ -81,43 +82,19 @@ func CalculateTransactionVolume(
 
 	changes := make(map[common.Address]*AssetChange)
 
-	transfer, _ := parseTxLogs(context.Background(), logs)
+	transferTracker := NewTransferTrackerFromLogs("", withoutFlashLoans(logs), traceRoot)
 
-	transferTracker := NewTransferTracker("")
-	for _, v := range transfer {
-		for _, vv := range v {
-			transferTracker.AddTransfer(vv.From, vv.To, vv.Token, vv.Amount)
-		}
-	}
-
-	nativeCalls := ParseNativeFromTrace(traceRoot)
-	for _, v := range nativeCalls {
-		transferTracker.AddTransfer(v.From, v.To, BNB.Address, v.Amount)
-	}
-
-	for _, vv := range transferTracker.GetAllAccounts() {
-		fmt.Println("------------------------------------------")
-		fmt.Println("Address:", vv)
-		tokenChanges := &AssetChange{
-			Tokens: make(map[common.Address]*big.Int),
-		}
-		for _, v := range transferTracker.GetAllTokens() {
-			net := transferTracker.GetNetBalance(vv, v)
-			if net.Cmp(big.NewInt(0)) == 0 {
-				continue
-			}
-			tokenChanges.Tokens[v] = net
-			fmt.Println("  Token:", v, "change:", net.String())
-		}
-		fmt.Println("------------------------------------------")
-		if len(tokenChanges.Tokens) == 0 {
-			continue
+	for account, tokens := range transferTracker.NetBalances() {
+		for token, net := range tokens {
+			log.Debugf("Address:%s Token:%s change:%s", account.Hex(), token.Hex(), net.String())
 		}
-		changes[vv] = tokenChanges
+		changes[account] = &AssetChange{Tokens: tokens}
 	}
 	return changes
 }
 
+// CalculateTransactionTokenBalanceChanges 计算每个地址的代币净变化和包含 Swap 的交易。
+// 闪电贷的本金借出与归还不计入、手续费计入，只包含闪电兑换的 V2 Swap 不会把交易标记为 swap。
 func CalculateTransactionTokenBalanceChanges(
 	logs []*types.Log,
 	balanceChangeResult *PrestateTxResult,
@@ -128,36 +105,15 @@ func CalculateTransactionTokenBalanceChanges(
 	var changes map[common.Address]*AssetChange
 
 	// 解析 ERC20 代币转账
-	transfer, swapHashs := parseTxLogs(context.Background(), logs)
-
-	// 创建转账追踪器
 	transferTracker := NewTransferTracker("")
-	for _, v := range transfer {
-		for _, vv := range v {
-			transferTracker.AddTransfer(vv.From, vv.To, vv.Token, vv.Amount)
-		}
-	}
+	swapHashs := addLogTransfers(transferTracker, withoutFlashLoans(logs))
 
 	// 从 balance change 计算原生代币转账
 	changes = ParseNativeChange(balanceChangeResult)
 
-	// 遍历所有涉及的账户，计算余额变化
-	for _, addr := range transferTracker.GetAllAccounts() {
-		tokenChanges := &AssetChange{
-			Tokens: make(map[common.Address]*big.Int),
-		}
-
-		// 获取该账户所有代币的净余额变化
-		for _, token := range transferTracker.GetAllTokens() {
-			netBalance := transferTracker.GetNetBalance(addr, token)
-			if netBalance.Cmp(big.NewInt(0)) != 0 {
-				tokenChanges.Tokens[token] = netBalance
-			}
-		}
-
-		if len(tokenChanges.Tokens) > 0 {
-			changes[addr] = tokenChanges
-		}
+	// 所有涉及账户的代币净余额变化
+	for addr, tokens := range transferTracker.NetBalances() {
+		changes[addr] = &AssetChange{Tokens: tokens}
 	}
 
 	return changes, swapHashs
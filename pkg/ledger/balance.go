@@ -0,0 +1,89 @@
+package ledger
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+// SubjectBalance 试算平衡表中一个科目一种代币的借贷发生额
+type SubjectBalance struct {
+	Subject string
+	Token   string
+	Debit   *big.Int
+	Credit  *big.Int
+}
+
+// Net 借方 - 贷方
+func (s *SubjectBalance) Net() *big.Int {
+	return new(big.Int).Sub(s.Debit, s.Credit)
+}
+
+// TrialBalance 按明细科目和代币汇总借贷发生额，结果按科目、代币排序
+func TrialBalance(entries []*Entry) []*SubjectBalance {
+	type key struct{ subject, token string }
+	balances := make(map[key]*SubjectBalance)
+	get := func(subject, token string) *SubjectBalance {
+		k := key{subject: subject, token: token}
+		if b, ok := balances[k]; ok {
+			return b
+		}
+		b := &SubjectBalance{Subject: subject, Token: token, Debit: new(big.Int), Credit: new(big.Int)}
+		balances[k] = b
+		return b
+	}
+
+	for _, entry := range entries {
+		debit := get(entry.DebitSubject, entry.Token)
+		debit.Debit.Add(debit.Debit, entry.Amount)
+		credit := get(entry.CreditSubject, entry.Token)
+		credit.Credit.Add(credit.Credit, entry.Amount)
+	}
+
+	result := make([]*SubjectBalance, 0, len(balances))
+	for _, b := range balances {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Subject != result[j].Subject {
+			return result[i].Subject < result[j].Subject
+		}
+		return result[i].Token < result[j].Token
+	})
+	return result
+}
+
+// IsBalanced 每条分录都有借贷双方且金额为正，此时按代币汇总的借方合计等于贷方合计
+func IsBalanced(entries []*Entry) bool {
+	for _, entry := range entries {
+		if entry.DebitSubject == "" || entry.CreditSubject == "" || entry.Amount == nil || entry.Amount.Sign() <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedAddresses(changes map[common.Address]*geth.AssetChange) []common.Address {
+	addresses := make([]common.Address, 0, len(changes))
+	for addr := range changes {
+		addresses = append(addresses, addr)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+	return addresses
+}
+
+func sortedTokens(tokens map[common.Address]*big.Int) []common.Address {
+	addresses := make([]common.Address, 0, len(tokens))
+	for addr := range tokens {
+		addresses = append(addresses, addr)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+	return addresses
+}
@@ -0,0 +1,290 @@
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/lonelybeanz/tools/pkg/es"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+// 账目类型
+const (
+	LedgerTransfer    = "transfer"     // 单笔转账
+	LedgerAssetChange = "asset_change" // 交易净额变化
+	LedgerGas         = "gas"          // 手续费
+)
+
+// 资金方向，相对自有钱包
+const (
+	DirectionIn       = "in"
+	DirectionOut      = "out"
+	DirectionInternal = "internal"
+	DirectionExternal = "external"
+)
+
+// Entry 一条复式记账分录，字段与 pkg/es/READEME.md 中 bsc_financial 模板一致。
+// 借方为资金流入的一方，贷方为资金流出的一方，借贷金额相等。
+type Entry struct {
+	ID string `json:"-"` // ES 文档 ID，同一笔交易重复写入时会版本冲突而不是重复记账
+
+	ChainID     int64     `json:"chain_id"`
+	BlockNumber uint64    `json:"block_number"`
+	BlockTime   time.Time `json:"block_time"`
+	CreateAt    time.Time `json:"create_at"`
+	TxHash      string    `json:"tx_hash"`
+	TxFrom      string    `json:"tx_from"`
+	TxTo        string    `json:"tx_to"`
+	TxType      string    `json:"tx_type"`
+	LedgerType  string    `json:"ledger_type"`
+	Direction   string    `json:"direction"`
+
+	From     string `json:"from"`
+	FromRole string `json:"from_role"`
+	To       string `json:"to"`
+	ToRole   string `json:"to_role"`
+
+	Token          string   `json:"token"`
+	Symbol         string   `json:"symbol"`
+	Decimals       int      `json:"decimals"`
+	Amount         *big.Int `json:"-"`
+	AmountRaw      string   `json:"amount_raw"`
+	AmountHi       int64    `json:"amount_hi"`
+	AmountLo       int64    `json:"amount_lo"`
+	AmountOverflow bool     `json:"amount_overflow"` // 数量超出 hi/lo 可精确表示的范围，见 es.EncodeAmount
+	ValueUSD       string   `json:"value_usd"`
+
+	DebitSubject         string `json:"debit_subject"`
+	DebitSubjectCode     string `json:"debit_subject_code"`
+	DebitSubjectName     string `json:"debit_subject_name"`
+	DebitSubjectPath     string `json:"debit_subject_path"`
+	DebitSubjectRootCode string `json:"debit_subject_root_code"`
+
+	CreditSubject         string `json:"credit_subject"`
+	CreditSubjectCode     string `json:"credit_subject_code"`
+	CreditSubjectName     string `json:"credit_subject_name"`
+	CreditSubjectPath     string `json:"credit_subject_path"`
+	CreditSubjectRootCode string `json:"credit_subject_root_code"`
+}
+
+// TxContext 生成分录需要的交易信息
+type TxContext struct {
+	ChainID     int64
+	BlockNumber uint64
+	BlockTime   time.Time
+	TxHash      common.Hash
+	TxFrom      common.Address
+	TxTo        *common.Address // 创建合约时为 nil
+	TxType      string          // 例如 geth.GetTxFlag 的结果
+	GasFee      *big.Int        // 交易手续费（wei），为 nil 时不生成 gas 分录
+}
+
+// RoleResolver 地址角色查询，*geth.AddressLabeler 满足该接口
+type RoleResolver interface {
+	Role(ctx context.Context, address common.Address) geth.AddressRole
+}
+
+// Builder 把交易的转账记录和净额变化转换为分录
+type Builder struct {
+	chart  *ChartOfAccounts
+	roles  RoleResolver
+	tokens map[common.Address]*geth.TokenPrice
+}
+
+// NewBuilder tokens 用于填充符号、精度和 USD 价值，可以为 nil
+func NewBuilder(chart *ChartOfAccounts, roles RoleResolver, tokens map[common.Address]*geth.TokenPrice) *Builder {
+	if tokens == nil {
+		tokens = make(map[common.Address]*geth.TokenPrice)
+	}
+	return &Builder{chart: chart, roles: roles, tokens: tokens}
+}
+
+// FromTransfers 每笔转账生成一条分录：借收款方科目，贷付款方科目
+func (b *Builder) FromTransfers(ctx context.Context, tx *TxContext, records []*geth.TransferRecord) []*Entry {
+	entries := make([]*Entry, 0, len(records))
+	for _, record := range records {
+		if record.Amount == nil || record.Amount.Sign() <= 0 {
+			continue
+		}
+		entry := b.newEntry(ctx, tx, LedgerTransfer, record.From, record.To, record.Token, record.Amount)
+		entry.ID = fmt.Sprintf("%s-%s-%d", tx.TxHash.Hex(), LedgerTransfer, record.Seq)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// FromAssetChanges 只关心结果时按净额记账：自有钱包的增加记借方，减少记贷方，对方科目为交易清算。
+// 其他角色的地址不生成分录。
+func (b *Builder) FromAssetChanges(ctx context.Context, tx *TxContext, changes map[common.Address]*geth.AssetChange) []*Entry {
+	entries := make([]*Entry, 0)
+	for _, account := range sortedAddresses(changes) {
+		if b.roles.Role(ctx, account) != geth.RoleOwn {
+			continue
+		}
+		change := changes[account]
+		for _, token := range sortedTokens(change.Tokens) {
+			amount := change.Tokens[token]
+			if amount == nil || amount.Sign() == 0 {
+				continue
+			}
+			var entry *Entry
+			if amount.Sign() > 0 {
+				entry = b.newEntry(ctx, tx, LedgerAssetChange, common.Address{}, account, token, amount)
+				b.setCredit(entry, b.chart.Subject(SubjectSwapClearing), "")
+			} else {
+				entry = b.newEntry(ctx, tx, LedgerAssetChange, account, common.Address{}, token, new(big.Int).Neg(amount))
+				b.setDebit(entry, b.chart.Subject(SubjectSwapClearing), "")
+			}
+			entry.ID = fmt.Sprintf("%s-%s-%s-%s", tx.TxHash.Hex(), LedgerAssetChange, account.Hex(), token.Hex())
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// GasEntry 手续费分录：借 Gas 费，贷交易发起方
+func (b *Builder) GasEntry(ctx context.Context, tx *TxContext) *Entry {
+	if tx.GasFee == nil || tx.GasFee.Sign() <= 0 {
+		return nil
+	}
+	entry := b.newEntry(ctx, tx, LedgerGas, tx.TxFrom, common.Address{}, geth.BNB.Address, tx.GasFee)
+	b.setDebit(entry, b.chart.Subject(SubjectGasFee), "")
+	entry.ID = fmt.Sprintf("%s-%s", tx.TxHash.Hex(), LedgerGas)
+	return entry
+}
+
+// Build 生成一笔交易的全部分录：逐笔转账加手续费
+func (b *Builder) Build(ctx context.Context, tx *TxContext, tracker *geth.TransferTracker) []*Entry {
+	entries := b.FromTransfers(ctx, tx, tracker.GetTransfers())
+	if gas := b.GasEntry(ctx, tx); gas != nil {
+		entries = append(entries, gas)
+	}
+	return entries
+}
+
+func (b *Builder) newEntry(ctx context.Context, tx *TxContext, ledgerType string, from, to, token common.Address, amount *big.Int) *Entry {
+	entry := &Entry{
+		ChainID:     tx.ChainID,
+		BlockNumber: tx.BlockNumber,
+		BlockTime:   tx.BlockTime,
+		CreateAt:    time.Now(),
+		TxHash:      tx.TxHash.Hex(),
+		TxFrom:      tx.TxFrom.Hex(),
+		TxType:      tx.TxType,
+		LedgerType:  ledgerType,
+		Token:       token.Hex(),
+		Amount:      new(big.Int).Set(amount),
+		AmountRaw:   amount.String(),
+	}
+	if tx.TxTo != nil {
+		entry.TxTo = tx.TxTo.Hex()
+	}
+	entry.AmountHi, entry.AmountLo = es.EncodeAmount(amount)
+	entry.AmountOverflow = es.AmountOverflow(amount)
+
+	if info, ok := b.tokens[token]; ok {
+		entry.Symbol = info.Symbol
+		entry.Decimals = info.Decimal
+		entry.ValueUSD = valueUSD(amount, info)
+	}
+
+	// 零地址一方为铸造或销毁，记入铸造销毁科目，保证每条分录都有借贷双方；
+	// 净额和手续费分录随后会改为各自的对方科目
+	var fromRole, toRole geth.AddressRole
+	if from != (common.Address{}) {
+		fromRole = b.roles.Role(ctx, from)
+		entry.From = from.Hex()
+		entry.FromRole = string(fromRole)
+		b.setCredit(entry, b.chart.SubjectFor(from, fromRole), from.Hex())
+	} else {
+		b.setCredit(entry, b.chart.Subject(SubjectMintBurn), "")
+	}
+	if to != (common.Address{}) {
+		toRole = b.roles.Role(ctx, to)
+		entry.To = to.Hex()
+		entry.ToRole = string(toRole)
+		b.setDebit(entry, b.chart.SubjectFor(to, toRole), to.Hex())
+	} else {
+		b.setDebit(entry, b.chart.Subject(SubjectMintBurn), "")
+	}
+	entry.Direction = direction(fromRole, toRole)
+	return entry
+}
+
+// subjectName 明细科目，带地址时为 "科目代码:地址"
+func subjectName(subject *Subject, address string) string {
+	if address == "" {
+		return subject.Code
+	}
+	return subject.Code + ":" + address
+}
+
+func (b *Builder) setDebit(entry *Entry, subject *Subject, address string) {
+	entry.DebitSubject = subjectName(subject, address)
+	entry.DebitSubjectCode = subject.Code
+	entry.DebitSubjectName = subject.Name
+	entry.DebitSubjectPath, entry.DebitSubjectRootCode = b.chart.path(subject)
+}
+
+func (b *Builder) setCredit(entry *Entry, subject *Subject, address string) {
+	entry.CreditSubject = subjectName(subject, address)
+	entry.CreditSubjectCode = subject.Code
+	entry.CreditSubjectName = subject.Name
+	entry.CreditSubjectPath, entry.CreditSubjectRootCode = b.chart.path(subject)
+}
+
+func direction(fromRole, toRole geth.AddressRole) string {
+	switch {
+	case fromRole == geth.RoleOwn && toRole == geth.RoleOwn:
+		return DirectionInternal
+	case toRole == geth.RoleOwn:
+		return DirectionIn
+	case fromRole == geth.RoleOwn:
+		return DirectionOut
+	default:
+		return DirectionExternal
+	}
+}
+
+func valueUSD(amount *big.Int, info *geth.TokenPrice) string {
+	if info.Price == 0 {
+		return ""
+	}
+	value := new(big.Float).SetInt(amount)
+	value.Quo(value, new(big.Float).SetFloat64(math.Pow10(info.Decimal)))
+	value.Mul(value, new(big.Float).SetFloat64(info.Price))
+	f, _ := value.Float64()
+	return strconv.FormatFloat(f, 'f', 6, 64)
+}
+
+// BuildBulkBody 生成 ES bulk 请求体，可以直接交给 es.SaveAndRetry。
+// 使用 create 操作，重复写入同一笔交易时返回版本冲突。
+func BuildBulkBody(indexName string, entries []*Entry) (bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	for _, entry := range entries {
+		meta := map[string]map[string]string{"create": {"_index": indexName}}
+		if entry.ID != "" {
+			meta["create"]["_id"] = entry.ID
+		}
+		metaLine, err := json.Marshal(meta)
+		if err != nil {
+			return buffer, err
+		}
+		doc, err := json.Marshal(entry)
+		if err != nil {
+			return buffer, err
+		}
+		buffer.Write(metaLine)
+		buffer.WriteByte('\n')
+		buffer.Write(doc)
+		buffer.WriteByte('\n')
+	}
+	return buffer, nil
+}
@@ -0,0 +1,140 @@
+package ledger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+type staticRoles map[common.Address]geth.AddressRole
+
+func (r staticRoles) Role(ctx context.Context, address common.Address) geth.AddressRole {
+	return r[address]
+}
+
+func TestBuilder(t *testing.T) {
+	own := common.HexToAddress("0x01")
+	pool := common.HexToAddress("0x02")
+	roles := staticRoles{own: geth.RoleOwn, pool: geth.RoleDexPool}
+	usdt := geth.USDT
+	builder := NewBuilder(DefaultChartOfAccounts(), roles, map[common.Address]*geth.TokenPrice{usdt.Address: &usdt})
+
+	tracker := geth.NewTransferTracker("")
+	tracker.AddTransfer(own, pool, geth.WBNB.Address, big.NewInt(10))
+	tracker.AddTransfer(pool, own, usdt.Address, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+
+	tx := &TxContext{ChainID: 56, TxHash: common.HexToHash("0xaa"), TxFrom: own, GasFee: big.NewInt(3)}
+	entries := builder.Build(context.Background(), tx, tracker)
+	if len(entries) != 3 {
+		t.Fatalf("want 3 entries, got %d", len(entries))
+	}
+	if !IsBalanced(entries) {
+		t.Fatal("entries not balanced")
+	}
+
+	out := entries[0]
+	if out.Direction != DirectionOut || out.CreditSubjectCode != SubjectOwnWallet || out.DebitSubjectCode != SubjectDexPool {
+		t.Fatalf("unexpected out entry: %+v", out)
+	}
+	if out.DebitSubjectPath != "2/2001" || out.DebitSubjectRootCode != "2" {
+		t.Fatalf("unexpected subject path: %s %s", out.DebitSubjectPath, out.DebitSubjectRootCode)
+	}
+	in := entries[1]
+	if in.Direction != DirectionIn || in.Symbol != "USDT" || in.ValueUSD != "1.000000" || in.AmountHi != 0 {
+		t.Fatalf("unexpected in entry: %+v", in)
+	}
+	gas := entries[2]
+	if gas.LedgerType != LedgerGas || gas.DebitSubjectCode != SubjectGasFee || gas.CreditSubject != SubjectOwnWallet+":"+own.Hex() {
+		t.Fatalf("unexpected gas entry: %+v", gas)
+	}
+
+	var ownWBNB *SubjectBalance
+	for _, b := range TrialBalance(entries) {
+		if b.Subject == SubjectOwnWallet+":"+own.Hex() && b.Token == geth.WBNB.Address.Hex() {
+			ownWBNB = b
+		}
+	}
+	if ownWBNB == nil || ownWBNB.Net().Int64() != -10 {
+		t.Fatalf("unexpected trial balance: %+v", ownWBNB)
+	}
+
+	body, err := BuildBulkBody("bsc_financial_write", entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(body.String()))
+	lines := 0
+	for scanner.Scan() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+	}
+	if lines != 6 {
+		t.Fatalf("want 6 bulk lines, got %d", lines)
+	}
+}
+
+func TestBuilderFromAssetChanges(t *testing.T) {
+	own := common.HexToAddress("0x01")
+	other := common.HexToAddress("0x02")
+	builder := NewBuilder(DefaultChartOfAccounts(), staticRoles{own: geth.RoleOwn}, nil)
+
+	changes := map[common.Address]*geth.AssetChange{
+		own:   {Tokens: map[common.Address]*big.Int{geth.WBNB.Address: big.NewInt(-5), geth.USDT.Address: big.NewInt(7)}},
+		other: {Tokens: map[common.Address]*big.Int{geth.WBNB.Address: big.NewInt(5)}},
+	}
+	entries := builder.FromAssetChanges(context.Background(), &TxContext{TxHash: common.HexToHash("0xbb")}, changes)
+	if len(entries) != 2 || !IsBalanced(entries) {
+		t.Fatalf("unexpected entries: %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.DebitSubjectCode != SubjectSwapClearing && entry.CreditSubjectCode != SubjectSwapClearing {
+			t.Fatalf("missing clearing subject: %+v", entry)
+		}
+	}
+}
+
+func TestBuilderMintAndBurn(t *testing.T) {
+	own := common.HexToAddress("0x01")
+	builder := NewBuilder(DefaultChartOfAccounts(), staticRoles{own: geth.RoleOwn}, nil)
+
+	tracker := geth.NewTransferTracker("")
+	tracker.AddTransfer(common.Address{}, own, geth.USDT.Address, big.NewInt(100))
+	tracker.AddTransfer(own, common.Address{}, geth.USDT.Address, big.NewInt(40))
+
+	entries := builder.Build(context.Background(), &TxContext{TxHash: common.HexToHash("0xcc"), TxFrom: own}, tracker)
+	if len(entries) != 2 || !IsBalanced(entries) {
+		t.Fatalf("mint and burn entries should be balanced: %+v", entries)
+	}
+	mint, burn := entries[0], entries[1]
+	if mint.CreditSubjectCode != SubjectMintBurn || mint.DebitSubjectCode != SubjectOwnWallet || mint.Direction != DirectionIn {
+		t.Fatalf("unexpected mint entry: %+v", mint)
+	}
+	if burn.DebitSubjectCode != SubjectMintBurn || burn.CreditSubjectCode != SubjectOwnWallet || burn.Direction != DirectionOut {
+		t.Fatalf("unexpected burn entry: %+v", burn)
+	}
+	if mint.AmountOverflow {
+		t.Fatalf("small amount flagged as overflow: %+v", mint)
+	}
+	if burn.DebitSubjectPath != "3/3002" {
+		t.Fatalf("unexpected mint/burn subject path: %s", burn.DebitSubjectPath)
+	}
+
+	var mintBurn *SubjectBalance
+	for _, b := range TrialBalance(entries) {
+		if b.Subject == SubjectMintBurn {
+			mintBurn = b
+		}
+	}
+	if mintBurn == nil || mintBurn.Net().Int64() != -60 {
+		t.Fatalf("unexpected mint/burn balance: %+v", mintBurn)
+	}
+}
@@ -0,0 +1,125 @@
+package ledger
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+// 默认科目表
+const (
+	SubjectAssets       = "1"    // 资产
+	SubjectOwnWallet    = "1001" // 自有钱包
+	SubjectCEX          = "1002" // 交易所账户
+	SubjectExternal     = "2"    // 外部往来
+	SubjectDexPool      = "2001" // DEX 池子
+	SubjectRouter       = "2002" // 路由合约
+	SubjectBot          = "2003" // 其他机器人
+	SubjectEOA          = "2004" // 外部账户
+	SubjectContract     = "2005" // 其他合约
+	SubjectUnknown      = "2999" // 未识别
+	SubjectClearing     = "3"    // 清算
+	SubjectSwapClearing = "3001" // 交易清算，用于没有对手方的净额变化
+	SubjectMintBurn     = "3002" // 铸造销毁，零地址转入转出的对方科目
+	SubjectExpense      = "5"    // 费用
+	SubjectGasFee       = "5001" // Gas 费
+)
+
+// Subject 会计科目
+type Subject struct {
+	Code       string
+	Name       string
+	ParentCode string // 一级科目为空
+}
+
+// ChartOfAccounts 科目表，以及地址/角色到科目的映射。地址映射优先于角色映射。
+type ChartOfAccounts struct {
+	subjects  map[string]*Subject
+	byAddress map[common.Address]string
+	byRole    map[geth.AddressRole]string
+	fallback  string
+}
+
+func NewChartOfAccounts(fallback string) *ChartOfAccounts {
+	return &ChartOfAccounts{
+		subjects:  make(map[string]*Subject),
+		byAddress: make(map[common.Address]string),
+		byRole:    make(map[geth.AddressRole]string),
+		fallback:  fallback,
+	}
+}
+
+// DefaultChartOfAccounts 按地址角色划分往来科目
+func DefaultChartOfAccounts() *ChartOfAccounts {
+	chart := NewChartOfAccounts(SubjectUnknown)
+	chart.AddSubject(&Subject{Code: SubjectAssets, Name: "资产"})
+	chart.AddSubject(&Subject{Code: SubjectOwnWallet, Name: "自有钱包", ParentCode: SubjectAssets})
+	chart.AddSubject(&Subject{Code: SubjectCEX, Name: "交易所账户", ParentCode: SubjectAssets})
+	chart.AddSubject(&Subject{Code: SubjectExternal, Name: "外部往来"})
+	chart.AddSubject(&Subject{Code: SubjectDexPool, Name: "DEX池子", ParentCode: SubjectExternal})
+	chart.AddSubject(&Subject{Code: SubjectRouter, Name: "路由合约", ParentCode: SubjectExternal})
+	chart.AddSubject(&Subject{Code: SubjectBot, Name: "其他机器人", ParentCode: SubjectExternal})
+	chart.AddSubject(&Subject{Code: SubjectEOA, Name: "外部账户", ParentCode: SubjectExternal})
+	chart.AddSubject(&Subject{Code: SubjectContract, Name: "其他合约", ParentCode: SubjectExternal})
+	chart.AddSubject(&Subject{Code: SubjectUnknown, Name: "未识别", ParentCode: SubjectExternal})
+	chart.AddSubject(&Subject{Code: SubjectClearing, Name: "清算"})
+	chart.AddSubject(&Subject{Code: SubjectSwapClearing, Name: "交易清算", ParentCode: SubjectClearing})
+	chart.AddSubject(&Subject{Code: SubjectMintBurn, Name: "铸造销毁", ParentCode: SubjectClearing})
+	chart.AddSubject(&Subject{Code: SubjectExpense, Name: "费用"})
+	chart.AddSubject(&Subject{Code: SubjectGasFee, Name: "Gas费", ParentCode: SubjectExpense})
+
+	chart.MapRole(geth.RoleOwn, SubjectOwnWallet)
+	chart.MapRole(geth.RoleCEX, SubjectCEX)
+	chart.MapRole(geth.RoleDexPool, SubjectDexPool)
+	chart.MapRole(geth.RoleRouter, SubjectRouter)
+	chart.MapRole(geth.RoleBot, SubjectBot)
+	chart.MapRole(geth.RoleEOA, SubjectEOA)
+	chart.MapRole(geth.RoleContract, SubjectContract)
+	return chart
+}
+
+func (c *ChartOfAccounts) AddSubject(subject *Subject) {
+	c.subjects[subject.Code] = subject
+}
+
+// MapAddress 指定地址使用的科目，例如把某个冷钱包单独记账
+func (c *ChartOfAccounts) MapAddress(address common.Address, code string) {
+	c.byAddress[address] = code
+}
+
+func (c *ChartOfAccounts) MapRole(role geth.AddressRole, code string) {
+	c.byRole[role] = code
+}
+
+// SubjectFor 返回地址对应的科目
+func (c *ChartOfAccounts) SubjectFor(address common.Address, role geth.AddressRole) *Subject {
+	if code, ok := c.byAddress[address]; ok {
+		return c.Subject(code)
+	}
+	if code, ok := c.byRole[role]; ok {
+		return c.Subject(code)
+	}
+	return c.Subject(c.fallback)
+}
+
+// Subject 按科目代码查找，未登记的代码返回只有代码的科目
+func (c *ChartOfAccounts) Subject(code string) *Subject {
+	if subject, ok := c.subjects[code]; ok {
+		return subject
+	}
+	return &Subject{Code: code, Name: code}
+}
+
+// path 返回从一级科目到当前科目的代码路径（例如 "1/1001"）和一级科目代码
+func (c *ChartOfAccounts) path(subject *Subject) (string, string) {
+	codes := []string{subject.Code}
+	seen := map[string]bool{subject.Code: true}
+	for parent := subject.ParentCode; parent != "" && !seen[parent]; {
+		seen[parent] = true
+		p := c.Subject(parent)
+		codes = append([]string{p.Code}, codes...)
+		parent = p.ParentCode
+	}
+	return strings.Join(codes, "/"), codes[0]
+}
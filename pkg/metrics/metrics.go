@@ -0,0 +1,190 @@
+package metrics
+
+/**
+ * @Description: Prometheus 指标，默认关闭，调用 Enable 后开始记录
+ **/
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tools"
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+var (
+	enabled    atomic.Bool
+	enableOnce sync.Once
+
+	// Registry 所有指标注册在这里，不使用全局 DefaultRegisterer，避免和调用方的指标冲突
+	Registry = prometheus.NewRegistry()
+
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "requests_total",
+		Help:      "JSON-RPC requests by endpoint, method and status.",
+	}, []string{"endpoint", "method", "status"})
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "request_duration_seconds",
+		Help:      "JSON-RPC request latency by endpoint and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "method"})
+
+	esDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "es",
+		Name:      "request_duration_seconds",
+		Help:      "Elasticsearch request latency including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+	esRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "es",
+		Name:      "request_retries_total",
+		Help:      "Elasticsearch request retries by reason.",
+	}, []string{"reason"})
+	esBulkFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "es",
+		Name:      "bulk_item_failures_total",
+		Help:      "Failed items in Elasticsearch bulk responses by index and error type.",
+	}, []string{"index", "type"})
+
+	pcmQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "pcm",
+		Name:      "queue_depth",
+		Help:      "Messages waiting in the pcm server queue.",
+	}, []string{"server"})
+	pcmDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "pcm",
+		Name:      "process_duration_seconds",
+		Help:      "pcm message processing latency by server and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server", "status"})
+	pcmDedupeHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "pcm",
+		Name:      "dedupe_hits_total",
+		Help:      "Messages rejected as duplicates by the pcm server.",
+	}, []string{"server"})
+)
+
+func init() {
+	Registry.MustRegister(
+		rpcRequests, rpcDuration,
+		esDuration, esRetries, esBulkFailures,
+		pcmQueueDepth, pcmDuration, pcmDedupeHits,
+	)
+}
+
+// Enable 开始记录指标，同时注册 Go 运行时和进程指标；可以重复调用
+func Enable() {
+	enableOnce.Do(func() {
+		Registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	})
+	enabled.Store(true)
+}
+
+// Disable 停止记录，已记录的值保留
+func Disable() {
+	enabled.Store(false)
+}
+
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Handler 返回 /metrics 使用的 http.Handler
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+func status(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusOK
+}
+
+// EndpointLabel 只保留 scheme 和 host，去掉路径和参数里可能带的 API key，也避免标签基数过大
+func EndpointLabel(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// ObserveRPC 记录一次 JSON-RPC 调用，err 包括传输错误和节点返回的 error
+func ObserveRPC(endpoint, method string, start time.Time, err error) {
+	if !enabled.Load() {
+		return
+	}
+	rpcRequests.WithLabelValues(endpoint, method, status(err)).Inc()
+	rpcDuration.WithLabelValues(endpoint, method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveES 记录一次 Elasticsearch 请求（包含重试）的总耗时
+func ObserveES(start time.Time, err error) {
+	if !enabled.Load() {
+		return
+	}
+	esDuration.WithLabelValues(status(err)).Observe(time.Since(start).Seconds())
+}
+
+// IncESRetry 记录一次 Elasticsearch 重试，reason 例如 network / eof / read / 5xx
+func IncESRetry(reason string) {
+	if !enabled.Load() {
+		return
+	}
+	esRetries.WithLabelValues(reason).Inc()
+}
+
+// AddESBulkFailures 记录 bulk 响应中失败的条目数
+func AddESBulkFailures(index, errType string, n int) {
+	if !enabled.Load() || n <= 0 {
+		return
+	}
+	esBulkFailures.WithLabelValues(index, errType).Add(float64(n))
+}
+
+// SetQueueDepth 记录 pcm 队列中等待处理的消息数
+func SetQueueDepth(server string, depth int) {
+	if !enabled.Load() {
+		return
+	}
+	pcmQueueDepth.WithLabelValues(server).Set(float64(depth))
+}
+
+// ObserveProcess 记录 pcm 处理一条消息的耗时
+func ObserveProcess(server string, start time.Time, err error) {
+	if !enabled.Load() {
+		return
+	}
+	pcmDuration.WithLabelValues(server, status(err)).Observe(time.Since(start).Seconds())
+}
+
+// IncDedupeHit 记录一次被去重拒绝的消息
+func IncDedupeHit(server string) {
+	if !enabled.Load() {
+		return
+	}
+	pcmDedupeHits.WithLabelValues(server).Inc()
+}
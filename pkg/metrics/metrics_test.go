@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDisabledByDefault(t *testing.T) {
+	Disable()
+	ObserveRPC("http://a", "eth_call", time.Now(), nil)
+	IncDedupeHit("disabled")
+	if got := testutil.ToFloat64(rpcRequests.WithLabelValues("http://a", "eth_call", StatusOK)); got != 0 {
+		t.Fatalf("expected nothing recorded while disabled, got %v", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	Enable()
+	defer Disable()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "eth_fail") {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"boom"}}`))
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer node.Close()
+
+	client := NewHTTPClient(nil)
+	for _, method := range []string{"eth_blockNumber", "eth_blockNumber", "eth_fail"} {
+		resp, err := client.Post(node.URL+"/secret-key", "application/json",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":[]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), `"id":1`) {
+			t.Fatalf("response body not preserved: %s", body)
+		}
+	}
+
+	endpoint := EndpointLabel(node.URL + "/secret-key")
+	if strings.Contains(endpoint, "secret") {
+		t.Fatalf("endpoint label leaks path: %s", endpoint)
+	}
+	if got := testutil.ToFloat64(rpcRequests.WithLabelValues(endpoint, "eth_blockNumber", StatusOK)); got != 2 {
+		t.Fatalf("expected 2 ok calls, got %v", got)
+	}
+	if got := testutil.ToFloat64(rpcRequests.WithLabelValues(endpoint, "eth_fail", StatusError)); got != 1 {
+		t.Fatalf("expected 1 failed call, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	Enable()
+	defer Disable()
+
+	SetQueueDepth("worker", 3)
+	IncDedupeHit("worker")
+	ObserveProcess("worker", time.Now(), errors.New("failed"))
+	AddESBulkFailures("tx", "mapper_parsing_exception", 2)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`tools_pcm_queue_depth{server="worker"} 3`,
+		`tools_pcm_dedupe_hits_total{server="worker"} 1`,
+		`tools_pcm_process_duration_seconds_count{server="worker",status="error"} 1`,
+		`tools_es_bulk_item_failures_total{index="tx",type="mapper_parsing_exception"} 2`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("metrics output missing %q", want)
+		}
+	}
+}
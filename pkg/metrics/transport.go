@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type rpcRequest struct {
+	Method string `json:"method"`
+}
+
+type rpcResponse struct {
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+// Transport 记录 JSON-RPC 调用指标的 http.RoundTripper，用于 ethclient（geth.DialWithHTTPClient）。
+// geth 的 trace 等原始请求在 callRPC 中已经记录，不需要再通过 geth.SetRPCHTTPClient 使用它，否则会重复计数。
+// 批量请求的 method 记为 "batch"。
+type Transport struct {
+	Base http.RoundTripper // 为 nil 时使用 http.DefaultTransport
+}
+
+// NewHTTPClient 返回记录指标的 http.Client，base 为 nil 时使用 http.DefaultTransport
+func NewHTTPClient(base http.RoundTripper) *http.Client {
+	return &http.Client{Transport: &Transport{Base: base}}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !enabled.Load() || req.Method != http.MethodPost || req.Body == nil {
+		return t.base().RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	method, batch := "unknown", false
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		method, batch = "batch", true
+	} else {
+		var rpcReq rpcRequest
+		if json.Unmarshal(body, &rpcReq) == nil && rpcReq.Method != "" {
+			method = rpcReq.Method
+		}
+	}
+	endpoint := EndpointLabel(req.URL.String())
+
+	start := time.Now()
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		ObserveRPC(endpoint, method, start, err)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		ObserveRPC(endpoint, method, start, fmt.Errorf("http status %d", resp.StatusCode))
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		ObserveRPC(endpoint, method, start, err)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	ObserveRPC(endpoint, method, start, ResponseError(respBody, batch))
+	return resp, nil
+}
+
+// ResponseError 检查 JSON-RPC 响应中的 error 字段，批量响应中任意一项出错即返回错误
+func ResponseError(body []byte, batch bool) error {
+	if batch {
+		var resps []rpcResponse
+		if err := json.Unmarshal(body, &resps); err != nil {
+			return err
+		}
+		for _, r := range resps {
+			if hasError(r.Error) {
+				return fmt.Errorf("rpc error: %s", r.Error)
+			}
+		}
+		return nil
+	}
+	var r rpcResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return err
+	}
+	if hasError(r.Error) {
+		return fmt.Errorf("rpc error: %s", r.Error)
+	}
+	return nil
+}
+
+func hasError(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null" && string(raw) != `""`
+}
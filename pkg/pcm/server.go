@@ -14,7 +14,10 @@ import (
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/lonelybeanz/tools/pkg/metrics"
+	"github.com/lonelybeanz/tools/pkg/tracing"
 	"github.com/zeromicro/go-zero/core/logx"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const QueueLen = 100000
@@ -39,8 +42,10 @@ type Req struct {
 	ch   chan interface{}
 	msg  interface{}
 	err  error
-	ctx  context.Context
+	ctx  context.Context // 携带投递方的 trace context，处理消息时的 span 挂在投递的 span 下
 	sync bool
+
+	enqueuedAt time.Time
 }
 
 type Server struct {
@@ -187,8 +192,17 @@ func (server *Server) Go() {
 								}
 							}
 						}
+						metrics.SetQueueDepth(server.Name, len(server.Queue))
 						if server.MsgActioner != nil {
-							resp, err := server.MsgActioner(req.ctx, req.msg, number)
+							start := time.Now()
+							ctx, span := tracing.Start(req.ctx, "pcm.handle",
+								attribute.String("pcm.server", server.Name),
+								attribute.Int("pcm.worker", number),
+								attribute.Int64("pcm.queue_wait_ms", start.Sub(req.enqueuedAt).Milliseconds()),
+							)
+							resp, err := server.MsgActioner(ctx, req.msg, number)
+							tracing.End(span, err)
+							metrics.ObserveProcess(server.Name, start, err)
 							if req.sync {
 								req.err = err
 								req.ch <- resp
@@ -244,6 +258,9 @@ func (server *Server) Stop() {
 }
 
 func (server *Server) PostMsgToServer(ctx context.Context, msg interface{}) (resp interface{}, err error) {
+	ctx, span := tracing.Start(ctx, "pcm.post", attribute.String("pcm.server", server.Name))
+	defer func() { tracing.End(span, err) }()
+
 	if server.State == Stopped {
 		return nil, fmt.Errorf("server is stopped")
 	}
@@ -263,6 +280,7 @@ func (server *Server) PostMsgToServer(ctx context.Context, msg interface{}) (res
 		v, ok := msg.(UniqueMsg)
 		if ok {
 			if v.Unique() && server.Cache.Contains(v.Hash()) {
+				metrics.IncDedupeHit(server.Name)
 				return nil, fmt.Errorf("unique msg is exist")
 			} else {
 				server.Cache.Add(v.Hash(), struct{}{})
@@ -270,8 +288,9 @@ func (server *Server) PostMsgToServer(ctx context.Context, msg interface{}) (res
 		}
 	}
 
-	req := &Req{ch: make(chan interface{}), msg: msg, err: nil, ctx: ctx, sync: true}
+	req := &Req{ch: make(chan interface{}), msg: msg, err: nil, ctx: ctx, sync: true, enqueuedAt: time.Now()}
 	server.Queue <- req
+	metrics.SetQueueDepth(server.Name, len(server.Queue))
 	select {
 	case resp = <-req.ch:
 		close(req.ch)
@@ -286,6 +305,9 @@ func (server *Server) PostMsgToServer(ctx context.Context, msg interface{}) (res
 }
 
 func (server *Server) PushMsgToServer(ctx context.Context, msg interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "pcm.push", attribute.String("pcm.server", server.Name))
+	defer func() { tracing.End(span, err) }()
+
 	if server.State == Stopped {
 		return fmt.Errorf("server is stopped")
 	}
@@ -300,7 +322,7 @@ func (server *Server) PushMsgToServer(ctx context.Context, msg interface{}) (err
 		v, ok := msg.(UniqueMsg)
 		if ok {
 			if v.Unique() && server.Cache.Contains(v.Hash()) {
-				fmt.Errorf("deduplicate")
+				metrics.IncDedupeHit(server.Name)
 				return fmt.Errorf("unique msg is exist")
 			} else {
 				server.Cache.Add(v.Hash(), struct{}{})
@@ -308,8 +330,9 @@ func (server *Server) PushMsgToServer(ctx context.Context, msg interface{}) (err
 		}
 	}
 
-	req := &Req{ch: nil, msg: msg, err: nil, ctx: ctx, sync: false}
+	req := &Req{ch: nil, msg: msg, err: nil, ctx: ctx, sync: false, enqueuedAt: time.Now()}
 	server.Queue <- req
+	metrics.SetQueueDepth(server.Name, len(server.Queue))
 	return nil
 }
 
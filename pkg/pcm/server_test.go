@@ -7,6 +7,10 @@ import (
 	"time"
 
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestNewSvr(t *testing.T) {
@@ -84,3 +88,36 @@ func TestNewMs(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	s.Stop()
 }
+
+func TestTraceContextCarriedThroughQueue(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	handled := make(chan trace.SpanContext, 1)
+	s, err := NewSvr("trace-test", func(ctx context.Context, msg interface{}, num int) (resp interface{}, err error) {
+		handled <- trace.SpanFromContext(ctx).SpanContext()
+		return nil, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Go()
+	defer s.Stop()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "producer")
+	if err := s.PushMsgToServer(ctx, "msg"); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	select {
+	case sc := <-handled:
+		if sc.TraceID() != parent.SpanContext().TraceID() {
+			t.Fatalf("handler trace %s, producer trace %s", sc.TraceID(), parent.SpanContext().TraceID())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not handled")
+	}
+}
@@ -0,0 +1,160 @@
+package rpccache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// Options 缓存配置
+type Options struct {
+	MaxMemoryMB int           // 内存缓存上限，默认 256MB
+	LifeWindow  time.Duration // 内存中保留多久，默认 24 小时；不可变数据过期只是为了释放内存
+	Dir         string        // 磁盘缓存目录，为空时只用内存
+	// Finalized 返回当前可以视为不可变的最高区块。为 nil 时所有明确指定高度的请求都会缓存，
+	// 调用方需要自己保证不会查询可能重组的区块。
+	Finalized func() uint64
+}
+
+// Stats 命中统计
+type Stats struct {
+	Hits     int64 `json:"hits"`
+	DiskHits int64 `json:"disk_hits"`
+	Misses   int64 `json:"misses"`
+	Stores   int64 `json:"stores"`
+}
+
+// Cache 以 method+params 为 key 缓存不可变的 RPC 结果，先查内存（bigcache），再查磁盘
+type Cache struct {
+	mem       *bigcache.BigCache
+	dir       string
+	finalized func() uint64
+
+	hits     atomic.Int64
+	diskHits atomic.Int64
+	misses   atomic.Int64
+	stores   atomic.Int64
+}
+
+func New(opts Options) (*Cache, error) {
+	if opts.MaxMemoryMB <= 0 {
+		opts.MaxMemoryMB = 256
+	}
+	if opts.LifeWindow <= 0 {
+		opts.LifeWindow = 24 * time.Hour
+	}
+
+	config := bigcache.DefaultConfig(opts.LifeWindow)
+	config.HardMaxCacheSize = opts.MaxMemoryMB
+	config.MaxEntrySize = 64 * 1024 // 区块和 trace 通常较大
+	config.Verbose = false
+	mem, err := bigcache.New(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Cache{
+		mem:       mem,
+		dir:       opts.Dir,
+		finalized: opts.Finalized,
+	}, nil
+}
+
+// Get 返回缓存的 result 原始 JSON
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if v, err := c.mem.Get(key); err == nil {
+		c.hits.Add(1)
+		return v, true
+	}
+	if c.dir != "" {
+		if v, err := os.ReadFile(c.path(key)); err == nil {
+			_ = c.mem.Set(key, v)
+			c.diskHits.Add(1)
+			return v, true
+		}
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+// has 是否已经缓存，不计入命中统计
+func (c *Cache) has(key string) bool {
+	if _, err := c.mem.Get(key); err == nil {
+		return true
+	}
+	if c.dir == "" {
+		return false
+	}
+	_, err := os.Stat(c.path(key))
+	return err == nil
+}
+
+// Set 写入内存，配置了目录时同时写入磁盘
+func (c *Cache) Set(key string, value []byte) error {
+	c.stores.Add(1)
+	// 超过分片大小的条目写不进内存，有磁盘缓存时仍然落盘
+	if err := c.mem.Set(key, value); err != nil && c.dir == "" {
+		return err
+	}
+	if c.dir == "" {
+		return nil
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免并发读到半个文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:     c.hits.Load(),
+		DiskHits: c.diskHits.Load(),
+		Misses:   c.misses.Load(),
+		Stores:   c.stores.Load(),
+	}
+}
+
+func (c *Cache) Close() error {
+	return c.mem.Close()
+}
+
+// path 按 key 的哈希分两级目录存放
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name+".json")
+}
+
+func (c *Cache) isFinalized(blockNumber uint64) bool {
+	if c.finalized == nil {
+		return true
+	}
+	return blockNumber <= c.finalized()
+}
@@ -0,0 +1,235 @@
+package rpccache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+// hashMethods 参数里只有哈希。区块按哈希查询的结果不会变；交易、回执和 trace 在重组后可能变化，
+// 需要在 cacheableResult 中确认所在区块已经 finalized
+var hashMethods = map[string]bool{
+	"eth_getBlockByHash":                 true,
+	"eth_getTransactionByHash":           true,
+	"eth_getTransactionReceipt":          true,
+	"debug_traceTransaction":             true,
+	"debug_traceBlockByHash":             true,
+	"eth_getBlockTransactionCountByHash": true,
+}
+
+// blockParamMethods 方法 -> 区块参数的位置，只有明确指定且已确认的高度才缓存
+var blockParamMethods = map[string]int{
+	"eth_getBlockByNumber":                 0,
+	"eth_getBlockReceipts":                 0,
+	"debug_traceBlockByNumber":             0,
+	"eth_call":                             1,
+	"eth_getBalance":                       1,
+	"eth_getCode":                          1,
+	"eth_getTransactionCount":              1,
+	"eth_getStorageAt":                     2,
+	"eth_getBlockTransactionCountByNumber": 0,
+}
+
+// Transport 缓存不可变 JSON-RPC 结果的 http.RoundTripper，可以用于 ethclient（rpc.WithHTTPClient）和 geth.SetRPCHTTPClient。
+// 只处理单个请求，批量请求直接转发。
+type Transport struct {
+	Cache *Cache
+	Base  http.RoundTripper // 为 nil 时使用 http.DefaultTransport
+}
+
+// NewHTTPClient 返回使用缓存的 http.Client
+func NewHTTPClient(cache *Cache) *http.Client {
+	return &http.Client{Transport: &Transport{Cache: cache}}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || req.Body == nil {
+		return t.base().RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	var rpcReq rpcRequest
+	if err := json.Unmarshal(body, &rpcReq); err != nil {
+		return t.base().RoundTrip(req)
+	}
+	key, ok := t.cacheKey(&rpcReq)
+	if !ok {
+		return t.base().RoundTrip(req)
+	}
+
+	if result, ok := t.Cache.Get(key); ok {
+		return jsonResponse(req, &rpcResponse{JSONRPC: "2.0", ID: rpcReq.ID, Result: result})
+	}
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(respBody, &rpcResp); err == nil && len(rpcResp.Error) == 0 && t.cacheableResult(&rpcReq, rpcResp.Result) {
+		_ = t.Cache.Set(key, rpcResp.Result)
+	}
+	return resp, nil
+}
+
+// cacheKey 返回 method+params 组成的 key，不可缓存时返回 false
+func (t *Transport) cacheKey(req *rpcRequest) (string, bool) {
+	if !t.cacheableRequest(req) {
+		return "", false
+	}
+	params := make([]string, 0, len(req.Params))
+	for _, p := range req.Params {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, p); err != nil {
+			return "", false
+		}
+		params = append(params, buf.String())
+	}
+	return req.Method + "|" + strings.Join(params, ","), true
+}
+
+func (t *Transport) cacheableRequest(req *rpcRequest) bool {
+	if hashMethods[req.Method] {
+		return true
+	}
+	if req.Method == "eth_getLogs" {
+		return len(req.Params) == 1 && t.cacheableLogFilter(req.Params[0])
+	}
+	pos, ok := blockParamMethods[req.Method]
+	if !ok || pos >= len(req.Params) {
+		return false
+	}
+	return t.cacheableBlockParam(req.Params[pos])
+}
+
+// cacheableBlockParam 区块参数为已确认的明确高度或区块哈希
+func (t *Transport) cacheableBlockParam(raw json.RawMessage) bool {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if strings.HasPrefix(s, "0x") && len(s) == 66 {
+			return true // 区块哈希
+		}
+		n, err := hexutil.DecodeUint64(s)
+		return err == nil && t.Cache.isFinalized(n)
+	}
+
+	var obj struct {
+		BlockHash   string `json:"blockHash"`
+		BlockNumber string `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return false
+	}
+	if obj.BlockHash != "" {
+		return true
+	}
+	n, err := hexutil.DecodeUint64(obj.BlockNumber)
+	return err == nil && t.Cache.isFinalized(n)
+}
+
+func (t *Transport) cacheableLogFilter(raw json.RawMessage) bool {
+	var filter struct {
+		BlockHash string `json:"blockHash"`
+		FromBlock string `json:"fromBlock"`
+		ToBlock   string `json:"toBlock"`
+	}
+	if err := json.Unmarshal(raw, &filter); err != nil {
+		return false
+	}
+	if filter.BlockHash != "" {
+		return true
+	}
+	if _, err := hexutil.DecodeUint64(filter.FromBlock); err != nil {
+		return false
+	}
+	to, err := hexutil.DecodeUint64(filter.ToBlock)
+	return err == nil && t.Cache.isFinalized(to)
+}
+
+// cacheableResult 交易/回执查询在打包前返回 null，pending 交易没有 blockNumber，都不缓存；
+// 交易和回执所在区块未 finalized 时也不缓存。trace 结果中没有区块号，只有同一交易的回执已经缓存时才缓存
+func (t *Transport) cacheableResult(req *rpcRequest, result json.RawMessage) bool {
+	if len(result) == 0 || string(result) == "null" {
+		return false
+	}
+	switch req.Method {
+	case "eth_getTransactionByHash", "eth_getTransactionReceipt":
+		var tx struct {
+			BlockNumber *string `json:"blockNumber"`
+		}
+		if err := json.Unmarshal(result, &tx); err != nil || tx.BlockNumber == nil {
+			return false
+		}
+		n, err := hexutil.DecodeUint64(*tx.BlockNumber)
+		return err == nil && t.Cache.isFinalized(n)
+	case "debug_traceTransaction":
+		if t.Cache.finalized == nil {
+			return true
+		}
+		if len(req.Params) == 0 {
+			return false
+		}
+		key, ok := t.cacheKey(&rpcRequest{Method: "eth_getTransactionReceipt", Params: req.Params[:1]})
+		return ok && t.Cache.has(key)
+	}
+	return true
+}
+
+func jsonResponse(req *http.Request, resp *rpcResponse) (*http.Response, error) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}, "Content-Length": []string{strconv.Itoa(len(body))}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,176 @@
+package rpccache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/lonelybeanz/tools/pkg/geth"
+)
+
+func newTestNode(t *testing.T, calls *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("bad request: %s", body)
+			return
+		}
+		var result string
+		switch req.Method {
+		case "eth_getBalance":
+			result = `"0x64"`
+		case "eth_getTransactionReceipt", "eth_getTransactionByHash":
+			// 0x32 为已确认的交易，0xc8 为未确认的交易，其他哈希还没有打包
+			result = `null`
+			for hash, block := range map[string]string{"0x32": "0x32", "0xc8": "0xc8"} {
+				if string(req.Params[0]) == `"`+common.HexToHash(hash).Hex()+`"` {
+					result = `{"blockNumber":"` + block + `"}`
+				}
+			}
+		default:
+			result = `{"ok":true}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `,"result":` + result + `}`))
+	}))
+}
+
+func TestTransportCachesFinalizedBalance(t *testing.T) {
+	var calls int64
+	node := newTestNode(t, &calls)
+	defer node.Close()
+
+	dir := t.TempDir()
+	cache, err := New(Options{MaxMemoryMB: 8, Dir: dir, Finalized: func() uint64 { return 100 }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := geth.DialWithHTTPClient(context.Background(), node.URL, NewHTTPClient(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	account := common.HexToAddress("0x01")
+
+	for i := 0; i < 3; i++ {
+		balance, err := client.BalanceAt(ctx, account, big.NewInt(50))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Int64() != 100 {
+			t.Fatalf("unexpected balance %s", balance)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("finalized balance should be fetched once, got %d calls", calls)
+	}
+
+	// 未确认的高度和 latest 不缓存
+	client.BalanceAt(ctx, account, big.NewInt(200))
+	client.BalanceAt(ctx, account, big.NewInt(200))
+	client.BalanceAt(ctx, account, nil)
+	if calls != 4 {
+		t.Fatalf("unfinalized requests should not be cached, got %d calls", calls)
+	}
+
+	// null 结果不缓存
+	client.TransactionReceipt(ctx, common.HexToHash("0xaa"))
+	client.TransactionReceipt(ctx, common.HexToHash("0xaa"))
+	if calls != 6 {
+		t.Fatalf("null results should not be cached, got %d calls", calls)
+	}
+
+	// 新建缓存实例从磁盘读取
+	cache.Close()
+	reopened, err := New(Options{MaxMemoryMB: 8, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ = geth.DialWithHTTPClient(ctx, node.URL, NewHTTPClient(reopened))
+	if _, err := client.BalanceAt(ctx, account, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 6 || reopened.Stats().DiskHits != 1 {
+		t.Fatalf("expected disk hit, calls=%d stats=%+v", calls, reopened.Stats())
+	}
+}
+
+func TestTransportTraceThroughCallRPC(t *testing.T) {
+	var calls int64
+	node := newTestNode(t, &calls)
+	defer node.Close()
+
+	cache, err := New(Options{MaxMemoryMB: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	geth.SetRPCHTTPClient(NewHTTPClient(cache))
+	defer geth.SetRPCHTTPClient(nil)
+
+	for i := 0; i < 2; i++ {
+		if _, err := geth.TraceTransaction(node.URL, "0xabc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("trace should be fetched once, got %d calls", calls)
+	}
+}
+
+// postRPC 通过 client 发送单个 JSON-RPC 请求，只关心请求是否到达节点
+func postRPC(t *testing.T, client *http.Client, url, method, hash string) {
+	t.Helper()
+	body := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":["` + common.HexToHash(hash).Hex() + `"]}`
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func TestTransportCachesFinalizedTransactionOnly(t *testing.T) {
+	var calls int64
+	node := newTestNode(t, &calls)
+	defer node.Close()
+
+	cache, err := New(Options{MaxMemoryMB: 8, Dir: t.TempDir(), Finalized: func() uint64 { return 100 }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewHTTPClient(cache)
+
+	for _, tc := range []struct {
+		hash  string
+		calls int64
+	}{
+		{hash: "0x32", calls: 1}, // 已确认
+		{hash: "0xc8", calls: 2}, // 未确认，重组后可能变化
+	} {
+		for _, method := range []string{"eth_getTransactionByHash", "eth_getTransactionReceipt", "debug_traceTransaction"} {
+			before := calls
+			postRPC(t, client, node.URL, method, tc.hash)
+			postRPC(t, client, node.URL, method, tc.hash)
+			if got := calls - before; got != tc.calls {
+				t.Fatalf("%s %s: expected %d calls, got %d", method, tc.hash, tc.calls, got)
+			}
+		}
+	}
+
+	// 回执未缓存时无法确认 trace 所在区块
+	before := calls
+	postRPC(t, client, node.URL, "debug_traceTransaction", "0x01")
+	postRPC(t, client, node.URL, "debug_traceTransaction", "0x01")
+	if calls-before != 2 {
+		t.Fatalf("trace without cached receipt should not be cached, got %d calls", calls-before)
+	}
+}
@@ -3,6 +3,14 @@ package consts
 const (
 	SOL_TOKEN_PROGRAM_ID = "So11111111111111111111111111111111111111112"
 	SOL                  = "So11111111111111111111111111111111111111111"
+
+	// 铸造和销毁的虚拟账户，mintTo 记为 MINT_ACCOUNT 转出，burn 记为转入 BURN_ACCOUNT
+	MINT_ACCOUNT = "mint"
+	BURN_ACCOUNT = "burn"
+
+	// Token-2022 扣留的转账手续费和机密余额的虚拟账户
+	WITHHELD_ACCOUNT     = "withheld"
+	CONFIDENTIAL_ACCOUNT = "confidential"
 )
 
 func ProgramToString(programId string) string {
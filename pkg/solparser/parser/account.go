@@ -9,6 +9,7 @@ import (
 	"github.com/decert-me/solana-go-sdk/common"
 	"github.com/decert-me/solana-go-sdk/program/token"
 	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/lonelybeanz/tools/pkg/solparser/consts"
 )
 
@@ -59,6 +60,22 @@ func (s *SolParser) updateTokenAccountCache(mint, tokenAccount string) {
 	}
 }
 
+// cacheTokenBalances 用 meta 中的 token 余额记录代币账户的所有者和 mint，避免逐个账户查询 RPC
+func (s *SolParser) cacheTokenBalances(tx *rpc.GetParsedTransactionResult) {
+	if tx.Meta == nil {
+		return
+	}
+	keys := tx.Transaction.Message.AccountKeys
+	for _, balances := range [][]rpc.TokenBalance{tx.Meta.PreTokenBalances, tx.Meta.PostTokenBalances} {
+		for _, balance := range balances {
+			if int(balance.AccountIndex) >= len(keys) || balance.Owner == nil {
+				continue
+			}
+			s.updateAccountCache(true, keys[balance.AccountIndex].PublicKey.String(), balance.Owner.String(), balance.Mint.String())
+		}
+	}
+}
+
 // 清理当前交易缓存
 func (s *SolParser) clearAccountCache() {
 	s.accountCache = defaultCache
@@ -94,7 +111,11 @@ func (s *SolParser) FillTokenAmtWithTransferIx(transEvent *TransferEvent) error
 			s.updateAccountCache(true, transEvent.To, destInfo.Owner.String(), destInfo.Mint.String())
 		}
 
-		transEvent.Token = token
+		// 查不到账户时保留指令中的 mint（transferChecked 等）
+		if token != "" {
+			transEvent.Token = token
+		}
+		token = transEvent.Token
 
 		s.updateTokenAccountCache(token, transEvent.From)
 		s.updateTokenAccountCache(token, transEvent.To)
@@ -102,6 +123,19 @@ func (s *SolParser) FillTokenAmtWithTransferIx(transEvent *TransferEvent) error
 		return nil
 	}
 
+	// 场景2: 铸造、销毁等一侧为虚拟账户的转移，mint 已知，只需要补充代币账户的所有者
+	if isTokenEvent(transEvent.Type) {
+		for _, account := range []string{transEvent.From, transEvent.To} {
+			if isPseudoAccount(account) {
+				continue
+			}
+			if info, _ := s.GetTokenAccountInfoByTokenAccount(account); info != nil {
+				s.updateAccountCache(true, account, info.Owner.String(), "")
+			}
+		}
+		return nil
+	}
+
 	return nil
 }
 
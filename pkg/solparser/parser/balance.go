@@ -1,9 +1,14 @@
 package parser
 
 import (
+	"math/big"
+
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
+// tokenAccountSize SPL Token 账户（包括 WSOL）的数据长度
+const tokenAccountSize = 165
+
 func getBalance(address string, txResp *rpc.GetParsedTransactionResult) (uint64, uint64) {
 	message := txResp.Transaction.Message
 	txMeta := txResp.Meta
@@ -18,3 +23,32 @@ func getBalance(address string, txResp *rpc.GetParsedTransactionResult) (uint64,
 
 	return 0, 0
 }
+
+// getTokenBalance 从 meta 的 preTokenBalances/postTokenBalances 中取代币账户的余额，没有记录时返回 false
+func getTokenBalance(address string, balances []rpc.TokenBalance, txResp *rpc.GetParsedTransactionResult) (*big.Int, bool) {
+	keys := txResp.Transaction.Message.AccountKeys
+	for _, balance := range balances {
+		if int(balance.AccountIndex) >= len(keys) || keys[balance.AccountIndex].PublicKey.String() != address {
+			continue
+		}
+		if balance.UiTokenAmount == nil {
+			return nil, false
+		}
+		return new(big.Int).SetString(balance.UiTokenAmount.Amount, 10)
+	}
+	return nil, false
+}
+
+// rentExemptMinimum 免租所需的最少 lamports，(128 + space) * 3480 * 2
+func rentExemptMinimum(space uint64) uint64 {
+	return (space + 128) * 3480 * 2
+}
+
+// nativeRentReserve WSOL 账户中不属于代币余额的租金部分，交易前已存在的账户用 lamports 减去代币余额
+func nativeRentReserve(address string, txResp *rpc.GetParsedTransactionResult) *big.Int {
+	if amount, ok := getTokenBalance(address, txResp.Meta.PreTokenBalances, txResp); ok {
+		pre, _ := getBalance(address, txResp)
+		return new(big.Int).Sub(new(big.Int).SetUint64(pre), amount)
+	}
+	return new(big.Int).SetUint64(rentExemptMinimum(tokenAccountSize))
+}
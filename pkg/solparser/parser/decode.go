@@ -0,0 +1,553 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// System Program 指令序号（u32 小端）
+const (
+	systemCreateAccount         = 0
+	systemTransfer              = 2
+	systemCreateAccountWithSeed = 3
+	systemTransferWithSeed      = 11
+)
+
+// SPL Token / Token-2022 指令序号（u8）
+const (
+	tokenInitializeAccount  = 1
+	tokenTransfer           = 3
+	tokenApprove            = 4
+	tokenSetAuthority       = 6
+	tokenMintTo             = 7
+	tokenBurn               = 8
+	tokenCloseAccount       = 9
+	tokenTransferChecked    = 12
+	tokenApproveChecked     = 13
+	tokenMintToChecked      = 14
+	tokenBurnChecked        = 15
+	tokenInitializeAccount2 = 16
+	tokenSyncNative         = 17
+	tokenInitializeAccount3 = 18
+	tokenAmountToUiAmount   = 23
+	tokenUiAmountToAmount   = 24
+
+	// Token-2022 扩展，第二个字节为扩展内的指令序号
+	tokenTransferFeeExtension          = 26
+	tokenConfidentialTransferExtension = 27
+	tokenInterestBearingMintExtension  = 33
+	tokenTransferHookExtension         = 36
+	tokenConfidentialTransferFee       = 37
+	tokenConfidentialMintBurnExtension = 42
+	tokenScaledUiAmountExtension       = 43
+)
+
+// decodeInstruction 按二进制数据和账户解码 System 和 SPL Token/Token-2022 指令，
+// 输出与 RPC jsonParsed 相同结构的 info/type，不认识的指令返回 false
+func decodeInstruction(programID solana.PublicKey, accounts []solana.PublicKey, data []byte) (*rpc.InstructionInfo, bool) {
+	var (
+		info *rpc.InstructionInfo
+		err  error
+	)
+	switch {
+	case programID == solana.SystemProgramID:
+		info, err = decodeSystemInstruction(accounts, data)
+	case IsTokenProgramId(programID):
+		info, err = decodeTokenInstruction(accounts, data)
+	default:
+		return nil, false
+	}
+	return info, err == nil && info != nil
+}
+
+func decodeSystemInstruction(accounts []solana.PublicKey, data []byte) (*rpc.InstructionInfo, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("system instruction data too short")
+	}
+	body := data[4:]
+	switch binary.LittleEndian.Uint32(data) {
+	case systemCreateAccount:
+		if len(body) < 48 || len(accounts) < 2 {
+			return nil, fmt.Errorf("invalid createAccount instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "createAccount",
+			Info: map[string]interface{}{
+				"source":     accounts[0].String(),
+				"newAccount": accounts[1].String(),
+				"lamports":   binary.LittleEndian.Uint64(body),
+				"space":      binary.LittleEndian.Uint64(body[8:]),
+				"owner":      solana.PublicKeyFromBytes(body[16:48]).String(),
+			},
+		}, nil
+	case systemTransfer:
+		if len(body) < 8 || len(accounts) < 2 {
+			return nil, fmt.Errorf("invalid transfer instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "transfer",
+			Info: map[string]interface{}{
+				"source":      accounts[0].String(),
+				"destination": accounts[1].String(),
+				"lamports":    binary.LittleEndian.Uint64(body),
+			},
+		}, nil
+	case systemCreateAccountWithSeed:
+		// base(32) seed(u64 长度 + 字节) lamports(u64) space(u64) owner(32)
+		if len(body) < 32 || len(accounts) < 2 {
+			return nil, fmt.Errorf("invalid createAccountWithSeed instruction")
+		}
+		seed, rest, ok := decodeSeed(body[32:])
+		if !ok || len(rest) < 48 {
+			return nil, fmt.Errorf("invalid createAccountWithSeed instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "createAccountWithSeed",
+			Info: map[string]interface{}{
+				"source":     accounts[0].String(),
+				"newAccount": accounts[1].String(),
+				"base":       solana.PublicKeyFromBytes(body[:32]).String(),
+				"seed":       seed,
+				"lamports":   binary.LittleEndian.Uint64(rest),
+				"space":      binary.LittleEndian.Uint64(rest[8:]),
+				"owner":      solana.PublicKeyFromBytes(rest[16:48]).String(),
+			},
+		}, nil
+	case systemTransferWithSeed:
+		// lamports(u64) from_seed(u64 长度 + 字节) from_owner(32)，账户依次为 source、base、destination
+		if len(body) < 8 || len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid transferWithSeed instruction")
+		}
+		seed, rest, ok := decodeSeed(body[8:])
+		if !ok || len(rest) < 32 {
+			return nil, fmt.Errorf("invalid transferWithSeed instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "transferWithSeed",
+			Info: map[string]interface{}{
+				"source":      accounts[0].String(),
+				"sourceBase":  accounts[1].String(),
+				"destination": accounts[2].String(),
+				"lamports":    binary.LittleEndian.Uint64(body),
+				"sourceSeed":  seed,
+				"sourceOwner": solana.PublicKeyFromBytes(rest[:32]).String(),
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+// decodeSeed 解码 bincode 字符串（u64 小端长度 + UTF-8 字节），返回剩余数据
+func decodeSeed(data []byte) (string, []byte, bool) {
+	if len(data) < 8 {
+		return "", nil, false
+	}
+	length := binary.LittleEndian.Uint64(data)
+	if length > uint64(len(data)-8) {
+		return "", nil, false
+	}
+	return string(data[8 : 8+length]), data[8+length:], true
+}
+
+func decodeTokenInstruction(accounts []solana.PublicKey, data []byte) (*rpc.InstructionInfo, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("token instruction data is empty")
+	}
+	body := data[1:]
+	account := func(i int) string {
+		return accounts[i].String()
+	}
+	switch data[0] {
+	case tokenInitializeAccount:
+		if len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid initializeAccount instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "initializeAccount",
+			Info: map[string]interface{}{
+				"account": account(0),
+				"mint":    account(1),
+				"owner":   account(2),
+			},
+		}, nil
+	case tokenInitializeAccount2, tokenInitializeAccount3:
+		if len(body) < 32 || len(accounts) < 2 {
+			return nil, fmt.Errorf("invalid initializeAccount instruction")
+		}
+		instructionType := "initializeAccount3"
+		if data[0] == tokenInitializeAccount2 {
+			instructionType = "initializeAccount2"
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: instructionType,
+			Info: map[string]interface{}{
+				"account": account(0),
+				"mint":    account(1),
+				"owner":   solana.PublicKeyFromBytes(body[:32]).String(),
+			},
+		}, nil
+	case tokenTransfer:
+		if len(body) < 8 || len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid transfer instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "transfer",
+			Info: map[string]interface{}{
+				"source":      account(0),
+				"destination": account(1),
+				"authority":   account(2),
+				"amount":      strconv.FormatUint(binary.LittleEndian.Uint64(body), 10),
+			},
+		}, nil
+	case tokenTransferChecked:
+		if len(body) < 9 || len(accounts) < 4 {
+			return nil, fmt.Errorf("invalid transferChecked instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "transferChecked",
+			Info: map[string]interface{}{
+				"source":      account(0),
+				"mint":        account(1),
+				"destination": account(2),
+				"authority":   account(3),
+				"tokenAmount": tokenAmount(binary.LittleEndian.Uint64(body), body[8]),
+			},
+		}, nil
+	case tokenApprove:
+		if len(body) < 8 || len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid approve instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "approve",
+			Info: map[string]interface{}{
+				"source":   account(0),
+				"delegate": account(1),
+				"owner":    account(2),
+				"amount":   strconv.FormatUint(binary.LittleEndian.Uint64(body), 10),
+			},
+		}, nil
+	case tokenApproveChecked:
+		if len(body) < 9 || len(accounts) < 4 {
+			return nil, fmt.Errorf("invalid approveChecked instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "approveChecked",
+			Info: map[string]interface{}{
+				"source":      account(0),
+				"mint":        account(1),
+				"delegate":    account(2),
+				"owner":       account(3),
+				"tokenAmount": tokenAmount(binary.LittleEndian.Uint64(body), body[8]),
+			},
+		}, nil
+	case tokenSetAuthority:
+		if len(body) < 2 || len(accounts) < 2 {
+			return nil, fmt.Errorf("invalid setAuthority instruction")
+		}
+		authorityType := authorityTypeName(body[0])
+		info := map[string]interface{}{
+			"authority":     account(1),
+			"authorityType": authorityType,
+			"newAuthority":  nil,
+		}
+		if body[1] == 1 && len(body) >= 34 {
+			info["newAuthority"] = solana.PublicKeyFromBytes(body[2:34]).String()
+		}
+		// 与 jsonParsed 一致：mint 相关的权限用 mint 字段，其余用 account 字段
+		if authorityType == "mintTokens" || authorityType == "freezeAccount" {
+			info["mint"] = account(0)
+		} else {
+			info["account"] = account(0)
+		}
+		return &rpc.InstructionInfo{InstructionType: "setAuthority", Info: info}, nil
+	case tokenMintTo:
+		if len(body) < 8 || len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid mintTo instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "mintTo",
+			Info: map[string]interface{}{
+				"mint":          account(0),
+				"account":       account(1),
+				"mintAuthority": account(2),
+				"amount":        strconv.FormatUint(binary.LittleEndian.Uint64(body), 10),
+			},
+		}, nil
+	case tokenMintToChecked:
+		if len(body) < 9 || len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid mintToChecked instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "mintToChecked",
+			Info: map[string]interface{}{
+				"mint":          account(0),
+				"account":       account(1),
+				"mintAuthority": account(2),
+				"tokenAmount":   tokenAmount(binary.LittleEndian.Uint64(body), body[8]),
+			},
+		}, nil
+	case tokenBurn:
+		if len(body) < 8 || len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid burn instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "burn",
+			Info: map[string]interface{}{
+				"account":   account(0),
+				"mint":      account(1),
+				"authority": account(2),
+				"amount":    strconv.FormatUint(binary.LittleEndian.Uint64(body), 10),
+			},
+		}, nil
+	case tokenBurnChecked:
+		if len(body) < 9 || len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid burnChecked instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "burnChecked",
+			Info: map[string]interface{}{
+				"account":     account(0),
+				"mint":        account(1),
+				"authority":   account(2),
+				"tokenAmount": tokenAmount(binary.LittleEndian.Uint64(body), body[8]),
+			},
+		}, nil
+	case tokenCloseAccount:
+		if len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid closeAccount instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "closeAccount",
+			Info: map[string]interface{}{
+				"account":     account(0),
+				"destination": account(1),
+				"owner":       account(2),
+			},
+		}, nil
+	case tokenAmountToUiAmount:
+		if len(body) < 8 || len(accounts) < 1 {
+			return nil, fmt.Errorf("invalid amountToUiAmount instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "amountToUiAmount",
+			Info: map[string]interface{}{
+				"mint":   account(0),
+				"amount": strconv.FormatUint(binary.LittleEndian.Uint64(body), 10),
+			},
+		}, nil
+	case tokenUiAmountToAmount:
+		if len(accounts) < 1 {
+			return nil, fmt.Errorf("invalid uiAmountToAmount instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "uiAmountToAmount",
+			Info: map[string]interface{}{
+				"mint":     account(0),
+				"uiAmount": string(body),
+			},
+		}, nil
+	case tokenTransferFeeExtension:
+		return decodeTransferFeeInstruction(accounts, body)
+	case tokenConfidentialTransferExtension, tokenConfidentialTransferFee, tokenConfidentialMintBurnExtension:
+		return decodeConfidentialInstruction(data[0], accounts, body)
+	case tokenInterestBearingMintExtension, tokenTransferHookExtension, tokenScaledUiAmountExtension:
+		return decodeMintExtensionInstruction(data[0], accounts, body)
+	case tokenSyncNative:
+		if len(accounts) < 1 {
+			return nil, fmt.Errorf("invalid syncNative instruction")
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "syncNative",
+			Info: map[string]interface{}{
+				"account": account(0),
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+func decodeTransferFeeInstruction(accounts []solana.PublicKey, body []byte) (*rpc.InstructionInfo, error) {
+	if len(body) == 0 || len(accounts) < 1 {
+		return nil, fmt.Errorf("invalid transfer fee instruction")
+	}
+	data := body[1:]
+	account := func(i int) string {
+		return accounts[i].String()
+	}
+	switch body[0] {
+	case 0:
+		return &rpc.InstructionInfo{InstructionType: "initializeTransferFeeConfig", Info: map[string]interface{}{"mint": account(0)}}, nil
+	case 1:
+		if len(data) < 17 || len(accounts) < 4 {
+			return nil, fmt.Errorf("invalid transferCheckedWithFee instruction")
+		}
+		decimals := data[8]
+		return &rpc.InstructionInfo{
+			InstructionType: "transferCheckedWithFee",
+			Info: map[string]interface{}{
+				"source":      account(0),
+				"mint":        account(1),
+				"destination": account(2),
+				"authority":   account(3),
+				"tokenAmount": tokenAmount(binary.LittleEndian.Uint64(data), decimals),
+				"feeAmount":   tokenAmount(binary.LittleEndian.Uint64(data[9:]), decimals),
+			},
+		}, nil
+	case 2, 3:
+		if len(accounts) < 3 {
+			return nil, fmt.Errorf("invalid withdrawWithheldTokens instruction")
+		}
+		info := map[string]interface{}{
+			"mint":                      account(0),
+			"feeRecipient":              account(1),
+			"withdrawWithheldAuthority": account(2),
+		}
+		if body[0] == 2 {
+			return &rpc.InstructionInfo{InstructionType: "withdrawWithheldTokensFromMint", Info: info}, nil
+		}
+		// 来源账户在最后 num_token_accounts 个，前面可能是多签的签名者
+		if len(data) >= 1 && int(data[0]) <= len(accounts)-3 {
+			sources := []string{}
+			for _, source := range accounts[len(accounts)-int(data[0]):] {
+				sources = append(sources, source.String())
+			}
+			info["sourceAccounts"] = sources
+		}
+		return &rpc.InstructionInfo{InstructionType: "withdrawWithheldTokensFromAccounts", Info: info}, nil
+	case 4:
+		sources := []string{}
+		for _, source := range accounts[1:] {
+			sources = append(sources, source.String())
+		}
+		return &rpc.InstructionInfo{
+			InstructionType: "harvestWithheldTokensToMint",
+			Info:            map[string]interface{}{"mint": account(0), "sourceAccounts": sources},
+		}, nil
+	case 5:
+		return &rpc.InstructionInfo{InstructionType: "setTransferFee", Info: map[string]interface{}{"mint": account(0)}}, nil
+	}
+	return nil, nil
+}
+
+// confidentialInstructions 机密转账相关扩展的指令名称，下标即扩展内的指令序号
+var confidentialInstructions = map[byte][]string{
+	tokenConfidentialTransferExtension: {
+		"initializeConfidentialTransferMint", "updateConfidentialTransferMint",
+		"configureConfidentialTransferAccount", "approveConfidentialTransferAccount",
+		"emptyConfidentialTransferAccount", "depositConfidentialTransfer",
+		"withdrawConfidentialTransfer", "confidentialTransfer",
+		"applyPendingConfidentialTransferBalance", "enableConfidentialTransferConfidentialCredits",
+		"disableConfidentialTransferConfidentialCredits", "enableConfidentialTransferNonConfidentialCredits",
+		"disableConfidentialTransferNonConfidentialCredits", "confidentialTransferWithSplitProofs",
+	},
+	tokenConfidentialTransferFee: {
+		"initializeConfidentialTransferFeeConfig", "withdrawWithheldConfidentialTransferTokensFromMint",
+		"withdrawWithheldConfidentialTransferTokensFromAccounts", "harvestWithheldConfidentialTransferTokensToMint",
+		"enableConfidentialTransferFeeHarvestToMint", "disableConfidentialTransferFeeHarvestToMint",
+	},
+	tokenConfidentialMintBurnExtension: {
+		"initializeConfidentialMintBurnMint", "rotateConfidentialMintBurnSupplyElGamalPubkey",
+		"updateConfidentialMintBurnDecryptableSupply", "confidentialMint", "confidentialBurn",
+		"applyPendingConfidentialMintBurnBurnAmount",
+	},
+}
+
+// decodeConfidentialInstruction 机密转账的金额是加密的，只有存入和取出带有明文金额
+func decodeConfidentialInstruction(extension byte, accounts []solana.PublicKey, body []byte) (*rpc.InstructionInfo, error) {
+	if len(body) == 0 || len(accounts) < 1 {
+		return nil, fmt.Errorf("invalid confidential transfer instruction")
+	}
+	names := confidentialInstructions[extension]
+	instructionType := fmt.Sprintf("confidentialTransferExtension(%d/%d)", extension, body[0])
+	if int(body[0]) < len(names) {
+		instructionType = names[body[0]]
+	}
+
+	data := body[1:]
+	info := map[string]interface{}{"account": accounts[0].String()}
+	if len(accounts) > 1 {
+		info["mint"] = accounts[1].String()
+	}
+	// 初始化和更新 mint 配置的指令只有 mint 一个账户
+	if strings.HasSuffix(instructionType, "Mint") && len(accounts) == 1 {
+		info = map[string]interface{}{"mint": accounts[0].String()}
+	}
+	if (instructionType == "depositConfidentialTransfer" || instructionType == "withdrawConfidentialTransfer") && len(data) >= 9 && len(accounts) >= 2 {
+		info["source"] = accounts[0].String()
+		info["destination"] = accounts[0].String()
+		info["amount"] = binary.LittleEndian.Uint64(data)
+		info["decimals"] = data[8]
+	}
+	return &rpc.InstructionInfo{InstructionType: instructionType, Info: info}, nil
+}
+
+// decodeMintExtensionInstruction 计息、transfer hook 和缩放 UI 金额扩展的 mint 配置指令
+func decodeMintExtensionInstruction(extension byte, accounts []solana.PublicKey, body []byte) (*rpc.InstructionInfo, error) {
+	if len(body) == 0 || len(accounts) < 1 || body[0] > 1 {
+		return nil, fmt.Errorf("invalid mint extension instruction")
+	}
+	names := map[byte][2]string{
+		tokenInterestBearingMintExtension: {"initializeInterestBearingConfig", "updateInterestBearingConfigRate"},
+		tokenTransferHookExtension:        {"initializeTransferHook", "updateTransferHook"},
+		tokenScaledUiAmountExtension:      {"initializeScaledUiAmountConfig", "updateMultiplier"},
+	}
+	info := map[string]interface{}{"mint": accounts[0].String()}
+	data := body[1:]
+	switch {
+	case extension == tokenTransferHookExtension && body[0] == 0 && len(data) >= 64:
+		info["programId"] = solana.PublicKeyFromBytes(data[32:64]).String()
+	case extension == tokenTransferHookExtension && body[0] == 1 && len(data) >= 32:
+		info["programId"] = solana.PublicKeyFromBytes(data[:32]).String()
+	}
+	return &rpc.InstructionInfo{InstructionType: names[extension][body[0]], Info: info}, nil
+}
+
+// authorityTypes setAuthority 的权限类型，下标即链上的枚举值（4 之后为 Token-2022 扩展）
+var authorityTypes = []string{
+	"mintTokens", "freezeAccount", "accountOwner", "closeAccount",
+	"transferFeeConfig", "withheldWithdraw", "closeMint", "interestRate",
+	"permanentDelegate", "confidentialTransferMint", "transferHookProgramId",
+	"confidentialTransferFeeConfig", "metadataPointer", "groupPointer",
+	"groupMemberPointer", "scaledUiAmount", "pause",
+}
+
+func authorityTypeName(value byte) string {
+	if int(value) < len(authorityTypes) {
+		return authorityTypes[value]
+	}
+	return fmt.Sprintf("unknown(%d)", value)
+}
+
+// tokenAmount 与 jsonParsed 的 tokenAmount 字段一致，uiAmount 只按精度换算，不考虑计息和缩放 UI 金额扩展
+func tokenAmount(amount uint64, decimals uint8) map[string]interface{} {
+	uiAmountString := formatUiAmount(amount, decimals)
+	uiAmount, _ := strconv.ParseFloat(uiAmountString, 64)
+	return map[string]interface{}{
+		"amount":         strconv.FormatUint(amount, 10),
+		"decimals":       decimals,
+		"uiAmount":       uiAmount,
+		"uiAmountString": uiAmountString,
+	}
+}
+
+// formatUiAmount 按精度插入小数点并去掉末尾的 0，例如 1500000/6 -> 1.5
+func formatUiAmount(amount uint64, decimals uint8) string {
+	digits := strconv.FormatUint(amount, 10)
+	if decimals == 0 {
+		return digits
+	}
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(decimals)
+	fraction := strings.TrimRight(digits[point:], "0")
+	if fraction == "" {
+		return digits[:point]
+	}
+	return digits[:point] + "." + fraction
+}
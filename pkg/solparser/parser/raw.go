@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// ParseRawTransfer 解析 base64/base58/json 编码的 getTransaction 结果，用于没有 jsonParsed 的数据源（Geyser/gRPC 推送、归档数据）
+func (s *SolParser) ParseRawTransfer(result *rpc.GetTransactionResult) ([]*Transfer, error) {
+	if result == nil || result.Transaction == nil {
+		return nil, errors.New("transaction is nil")
+	}
+	tx, err := result.Transaction.GetTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("decoding transaction: %w", err)
+	}
+	parsed, err := ToParsedTransaction(tx, result.Meta)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Slot = result.Slot
+	parsed.BlockTime = result.BlockTime
+	parsed.Version = result.Version
+	return s.ParseTransfer(parsed)
+}
+
+// ParseTransactionWithMeta 解析已解码的交易和对应的 meta
+func (s *SolParser) ParseTransactionWithMeta(tx *solana.Transaction, meta *rpc.TransactionMeta) ([]*Transfer, error) {
+	parsed, err := ToParsedTransaction(tx, meta)
+	if err != nil {
+		return nil, err
+	}
+	return s.ParseTransfer(parsed)
+}
+
+// ToParsedTransaction 把原始交易转换为 jsonParsed 的结构：账户索引展开为地址（包含地址查找表加载的账户），
+// System 和 SPL Token/Token-2022 指令从二进制数据解码到 Parsed，其他程序的指令保留 Data 和 Accounts
+func ToParsedTransaction(tx *solana.Transaction, meta *rpc.TransactionMeta) (*rpc.GetParsedTransactionResult, error) {
+	if tx == nil {
+		return nil, errors.New("transaction is nil")
+	}
+	if meta == nil {
+		return nil, errors.New("transaction meta is nil")
+	}
+
+	keys := accountKeys(tx, meta)
+	message := rpc.ParsedMessage{
+		AccountKeys:     make([]rpc.ParsedMessageAccount, len(keys)),
+		RecentBlockHash: tx.Message.RecentBlockhash.String(),
+	}
+	for i, key := range keys {
+		message.AccountKeys[i] = rpc.ParsedMessageAccount{
+			PublicKey: key,
+			Signer:    i < int(tx.Message.Header.NumRequiredSignatures),
+			Writable:  isWritableIndex(tx, meta, i),
+		}
+	}
+	for i, inst := range tx.Message.Instructions {
+		parsedInst, err := toParsedInstruction(keys, inst.ProgramIDIndex, inst.Accounts, inst.Data, 1)
+		if err != nil {
+			return nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+		message.Instructions = append(message.Instructions, parsedInst)
+	}
+
+	parsedMeta := &rpc.ParsedTransactionMeta{
+		Err:               meta.Err,
+		Fee:               meta.Fee,
+		PreBalances:       meta.PreBalances,
+		PostBalances:      meta.PostBalances,
+		PreTokenBalances:  meta.PreTokenBalances,
+		PostTokenBalances: meta.PostTokenBalances,
+		LogMessages:       meta.LogMessages,
+	}
+	for _, inner := range meta.InnerInstructions {
+		parsedInner := rpc.ParsedInnerInstruction{Index: uint64(inner.Index)}
+		for i, inst := range inner.Instructions {
+			parsedInst, err := toParsedInstruction(keys, inst.ProgramIDIndex, inst.Accounts, inst.Data, int64(inst.StackHeight))
+			if err != nil {
+				return nil, fmt.Errorf("inner instruction %d.%d: %w", inner.Index, i, err)
+			}
+			parsedInner.Instructions = append(parsedInner.Instructions, parsedInst)
+		}
+		parsedMeta.InnerInstructions = append(parsedMeta.InnerInstructions, parsedInner)
+	}
+
+	return &rpc.GetParsedTransactionResult{
+		Transaction: &rpc.ParsedTransaction{
+			Signatures: tx.Signatures,
+			Message:    message,
+		},
+		Meta: parsedMeta,
+	}, nil
+}
+
+// accountKeys 静态账户在前，之后是地址查找表加载的可写账户和只读账户，与 meta 中余额的下标一致
+func accountKeys(tx *solana.Transaction, meta *rpc.TransactionMeta) solana.PublicKeySlice {
+	keys := make(solana.PublicKeySlice, 0, len(tx.Message.AccountKeys)+len(meta.LoadedAddresses.Writable)+len(meta.LoadedAddresses.ReadOnly))
+	keys = append(keys, tx.Message.AccountKeys...)
+	keys = append(keys, meta.LoadedAddresses.Writable...)
+	keys = append(keys, meta.LoadedAddresses.ReadOnly...)
+	return keys
+}
+
+func isWritableIndex(tx *solana.Transaction, meta *rpc.TransactionMeta, index int) bool {
+	header := tx.Message.Header
+	static := len(tx.Message.AccountKeys)
+	switch {
+	case index < int(header.NumRequiredSignatures):
+		return index < int(header.NumRequiredSignatures-header.NumReadonlySignedAccounts)
+	case index < static:
+		return index < static-int(header.NumReadonlyUnsignedAccounts)
+	default:
+		return index < static+len(meta.LoadedAddresses.Writable)
+	}
+}
+
+func toParsedInstruction(keys solana.PublicKeySlice, programIndex uint16, accountIndexes []uint16, data []byte, stackHeight int64) (*rpc.ParsedInstruction, error) {
+	if int(programIndex) >= len(keys) {
+		return nil, fmt.Errorf("program index %d out of range", programIndex)
+	}
+	inst := &rpc.ParsedInstruction{
+		ProgramId:   keys[programIndex],
+		Accounts:    make([]solana.PublicKey, len(accountIndexes)),
+		StackHeight: stackHeight,
+	}
+	for i, idx := range accountIndexes {
+		if int(idx) >= len(keys) {
+			return nil, fmt.Errorf("account index %d out of range", idx)
+		}
+		inst.Accounts[i] = keys[idx]
+	}
+
+	info, ok := decodeInstruction(inst.ProgramId, inst.Accounts, data)
+	if !ok {
+		inst.Data = data
+		return inst, nil
+	}
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	inst.Parsed = new(rpc.InstructionInfoEnvelope)
+	if err := inst.Parsed.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	inst.Program = programName(inst.ProgramId)
+	inst.Accounts = nil
+	return inst, nil
+}
+
+func programName(programID solana.PublicKey) string {
+	switch programID {
+	case solana.SystemProgramID:
+		return "system"
+	case solana.TokenProgramID:
+		return "spl-token"
+	case solana.Token2022ProgramID:
+		return "spl-token-2022"
+	}
+	return ""
+}
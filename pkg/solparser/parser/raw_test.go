@@ -0,0 +1,249 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/lonelybeanz/tools/pkg/solparser/consts"
+)
+
+func testKey(b byte) solana.PublicKey {
+	return solana.PublicKeyFromBytes(bytes.Repeat([]byte{b}, 32))
+}
+
+func systemTransferData(lamports uint64) []byte {
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint32(data, systemTransfer)
+	binary.LittleEndian.PutUint64(data[4:], lamports)
+	return data
+}
+
+func tokenTransferData(kind byte, amount uint64, extra ...byte) []byte {
+	data := make([]byte, 9)
+	data[0] = kind
+	binary.LittleEndian.PutUint64(data[1:], amount)
+	return append(data, extra...)
+}
+
+// rawFixture 外层一个 SOL 转账和一个 DEX 指令，DEX 内部两笔代币转账（transferChecked + transfer）
+func rawFixture() (*solana.Transaction, *rpc.TransactionMeta, map[string]solana.PublicKey) {
+	names := map[string]solana.PublicKey{
+		"payer":     testKey(1),
+		"userATA":   testKey(2),
+		"poolATA":   testKey(3),
+		"recipient": testKey(4),
+		"poolOwner": testKey(5),
+		"mint":      testKey(6),
+		"dex":       testKey(7),
+	}
+	keys := solana.PublicKeySlice{
+		names["payer"], names["userATA"], names["poolATA"], names["recipient"],
+		names["mint"], solana.SystemProgramID, solana.TokenProgramID, names["dex"],
+	}
+	tx := &solana.Transaction{
+		Signatures: []solana.Signature{{1}},
+		Message: solana.Message{
+			Header:          solana.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 4},
+			AccountKeys:     keys,
+			RecentBlockhash: solana.Hash(testKey(9)),
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 5, Accounts: []uint16{0, 3}, Data: systemTransferData(1000)},
+				{ProgramIDIndex: 7, Accounts: []uint16{0, 1, 2}, Data: []byte{1, 2, 3}},
+			},
+		},
+	}
+	owner := func(k solana.PublicKey) *solana.PublicKey { return &k }
+	meta := &rpc.TransactionMeta{
+		PreBalances:  make([]uint64, len(keys)),
+		PostBalances: make([]uint64, len(keys)),
+		InnerInstructions: []rpc.InnerInstruction{{
+			Index: 1,
+			Instructions: []rpc.CompiledInstruction{
+				{ProgramIDIndex: 6, Accounts: []uint16{1, 4, 2, 0}, Data: tokenTransferData(tokenTransferChecked, 1500000, 6), StackHeight: 2},
+				{ProgramIDIndex: 6, Accounts: []uint16{2, 1, 7}, Data: tokenTransferData(tokenTransfer, 42), StackHeight: 2},
+			},
+		}},
+		PreTokenBalances: []rpc.TokenBalance{
+			{AccountIndex: 1, Mint: names["mint"], Owner: owner(names["payer"])},
+			{AccountIndex: 2, Mint: names["mint"], Owner: owner(names["poolOwner"])},
+		},
+	}
+	return tx, meta, names
+}
+
+func checkRawTransfers(t *testing.T, transfers []*Transfer, names map[string]solana.PublicKey) {
+	t.Helper()
+	want := []Transfer{
+		{From: names["payer"].String(), To: names["recipient"].String(), Token: consts.SOL, Amount: "1000"},
+		{From: names["payer"].String(), To: names["poolOwner"].String(), Token: names["mint"].String(), Amount: "1500000"},
+		{From: names["poolOwner"].String(), To: names["payer"].String(), Token: names["mint"].String(), Amount: "42"},
+	}
+	if len(transfers) != len(want) {
+		t.Fatalf("expected %d transfers, got %d", len(want), len(transfers))
+	}
+	for i, transfer := range transfers {
+		if *transfer != want[i] {
+			t.Fatalf("transfer %d: got %+v, want %+v", i, *transfer, want[i])
+		}
+	}
+}
+
+func TestParseTransactionWithMeta(t *testing.T) {
+	tx, meta, names := rawFixture()
+	transfers, err := NewSolParser(nil, nil).ParseTransactionWithMeta(tx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRawTransfers(t, transfers, names)
+}
+
+func TestParseRawTransfer(t *testing.T) {
+	tx, meta, names := rawFixture()
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"slot":7,"transaction":["` + base64.StdEncoding.EncodeToString(raw) + `","base64"],"meta":` + string(metaJSON) + `}`
+	result := &rpc.GetTransactionResult{}
+	if err := json.Unmarshal([]byte(body), result); err != nil {
+		t.Fatal(err)
+	}
+
+	transfers, err := NewSolParser(nil, nil).ParseRawTransfer(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRawTransfers(t, transfers, names)
+}
+
+func TestToParsedTransaction(t *testing.T) {
+	tx, meta, _ := rawFixture()
+	loaded := testKey(8)
+	meta.LoadedAddresses.Writable = solana.PublicKeySlice{loaded}
+	meta.PreBalances = append(meta.PreBalances, 0)
+	meta.PostBalances = append(meta.PostBalances, 0)
+	tx.Message.Instructions[0].Accounts = []uint16{0, 8}
+
+	parsed, err := ToParsedTransaction(tx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := parsed.Transaction.Message.AccountKeys
+	if len(accounts) != 9 || accounts[8].PublicKey != loaded || !accounts[8].Writable {
+		t.Fatalf("loaded address not resolved: %+v", accounts)
+	}
+	if !accounts[0].Signer || !accounts[3].Writable || accounts[4].Writable {
+		t.Fatalf("unexpected account flags: %+v", accounts)
+	}
+
+	got, _ := json.Marshal(parsed.Transaction.Message.Instructions[0].Parsed)
+	want := `{"info":{"destination":"` + loaded.String() + `","lamports":1000,"source":"` + testKey(1).String() + `"},"type":"transfer"}`
+	if string(got) != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if dex := parsed.Transaction.Message.Instructions[1]; dex.Parsed != nil || len(dex.Accounts) != 3 {
+		t.Fatalf("unknown program instruction should keep raw data: %+v", dex)
+	}
+
+	got, _ = json.Marshal(parsed.Meta.InnerInstructions[0].Instructions[0].Parsed)
+	if !bytes.Contains(got, []byte(`"tokenAmount":{"amount":"1500000","decimals":6,"uiAmount":1.5,"uiAmountString":"1.5"}`)) {
+		t.Fatalf("unexpected transferChecked: %s", got)
+	}
+}
+
+// seedData bincode 编码的 seed 字符串
+func seedData(seed string) []byte {
+	return append(binary.LittleEndian.AppendUint64(nil, uint64(len(seed))), seed...)
+}
+
+func TestDecodeSystemWithSeedMatchesJSONParsed(t *testing.T) {
+	payer, seeded, base, dest := testKey(1), testKey(2), testKey(3), testKey(4)
+
+	createData := binary.LittleEndian.AppendUint32(nil, systemCreateAccountWithSeed)
+	createData = append(append(createData, base.Bytes()...), seedData("wsol-1")...)
+	createData = binary.LittleEndian.AppendUint64(createData, 2039280)
+	createData = binary.LittleEndian.AppendUint64(createData, 165)
+	createData = append(createData, solana.TokenProgramID.Bytes()...)
+
+	transferData := binary.LittleEndian.AppendUint32(nil, systemTransferWithSeed)
+	transferData = binary.LittleEndian.AppendUint64(transferData, 5000)
+	transferData = append(append(transferData, seedData("wsol-1")...), solana.TokenProgramID.Bytes()...)
+
+	for _, tc := range []struct {
+		accounts []solana.PublicKey
+		data     []byte
+		// RPC jsonParsed 返回的结构
+		parsed string
+	}{
+		{
+			accounts: []solana.PublicKey{payer, seeded, base},
+			data:     createData,
+			parsed: `{"info":{"base":"` + base.String() + `","lamports":2039280,"newAccount":"` + seeded.String() + `","owner":"` + solana.TokenProgramID.String() +
+				`","seed":"wsol-1","source":"` + payer.String() + `","space":165},"type":"createAccountWithSeed"}`,
+		},
+		{
+			accounts: []solana.PublicKey{seeded, base, dest},
+			data:     transferData,
+			parsed: `{"info":{"destination":"` + dest.String() + `","lamports":5000,"source":"` + seeded.String() + `","sourceBase":"` + base.String() +
+				`","sourceOwner":"` + solana.TokenProgramID.String() + `","sourceSeed":"wsol-1"},"type":"transferWithSeed"}`,
+		},
+	} {
+		info, ok := decodeInstruction(solana.SystemProgramID, tc.accounts, tc.data)
+		if !ok {
+			t.Fatalf("failed to decode %s", tc.parsed)
+		}
+		got, _ := json.Marshal(info)
+		if string(got) != tc.parsed {
+			t.Fatalf("got %s, want %s", got, tc.parsed)
+		}
+
+		jsonParsed := &rpc.ParsedInstruction{}
+		if err := json.Unmarshal([]byte(`{"program":"system","programId":"`+solana.SystemProgramID.String()+`","parsed":`+tc.parsed+`}`), jsonParsed); err != nil {
+			t.Fatal(err)
+		}
+		raw := &rpc.ParsedInstruction{ProgramId: solana.SystemProgramID, Accounts: tc.accounts, Data: tc.data}
+		want, err := NewSolParser(nil, nil).ParseSystemTransferEvent(jsonParsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event, err := NewSolParser(nil, nil).ParseSystemTransferEvent(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *event != *want {
+			t.Fatalf("raw event %+v differs from jsonParsed %+v", *event, *want)
+		}
+	}
+
+	// seed 长度超出数据时不越界
+	if _, ok := decodeInstruction(solana.SystemProgramID, []solana.PublicKey{seeded, base, dest}, transferData[:20]); ok {
+		t.Fatal("truncated transferWithSeed should not decode")
+	}
+}
+
+func TestFormatUiAmount(t *testing.T) {
+	for _, tc := range []struct {
+		amount   uint64
+		decimals uint8
+		want     string
+	}{
+		{1500000, 6, "1.5"},
+		{5, 9, "0.000000005"},
+		{1000, 3, "1"},
+		{0, 6, "0"},
+		{42, 0, "42"},
+	} {
+		if got := formatUiAmount(tc.amount, tc.decimals); got != tc.want {
+			t.Fatalf("formatUiAmount(%d, %d) = %s, want %s", tc.amount, tc.decimals, got, tc.want)
+		}
+	}
+}
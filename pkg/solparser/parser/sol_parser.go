@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -34,6 +35,8 @@ type SolParser struct {
 	cli               *rpc.Client
 	accountCache      map[string]*AccountInfo
 	tokenAccountCache map[string][]string
+	extensionEvents   []*ExtensionEvent
+	mintExtensions    map[string][]string
 }
 
 var defaultCache = make(map[string]*AccountInfo)
@@ -49,6 +52,7 @@ func NewSolParser(cli *rpc.Client, cache map[string]*AccountInfo) *SolParser {
 		cli:               cli,
 		accountCache:      cache,
 		tokenAccountCache: make(map[string][]string),
+		mintExtensions:    make(map[string][]string),
 	}
 }
 
@@ -66,6 +70,8 @@ func (s *SolParser) ParseTransfer(parsedTransaction *rpc.GetParsedTransactionRes
 	if err := validateTransaction(parsedTransaction); err != nil {
 		return nil, fmt.Errorf("invalid transaction: %w", err)
 	}
+	s.cacheTokenBalances(parsedTransaction)
+	s.extensionEvents = nil
 
 	events := []*TransferEvent{}
 
@@ -74,6 +80,7 @@ func (s *SolParser) ParseTransfer(parsedTransaction *rpc.GetParsedTransactionRes
 
 	innerEvents := s.processInstructions(parsedTransaction, s.getInnerInstructions)
 	events = append(events, innerEvents...)
+	s.detectTransferHooks(parsedTransaction)
 
 	wrapAmount := ""
 	for _, event := range events {
@@ -93,16 +100,23 @@ func (s *SolParser) ParseTransfer(parsedTransaction *rpc.GetParsedTransactionRes
 		}
 	}
 
+	s.detectMintExtensions(events)
+	splitTransferFees(events, parsedTransaction)
+	for _, event := range events {
+		if event.Type == "withdrawWithheld" {
+			event.Amount = withheldWithdrawal(event.To, event.Token, events, parsedTransaction).String()
+		}
+	}
+
 	transfers := []*Transfer{}
-	tt := NewTransferTracker("")
 	for _, event := range events {
 		var transferFrom, transferTo string
-		if from, ok := s.accountCache[event.From]; ok && from.IsATA && event.Type == "tokenTransfer" {
+		if from, ok := s.accountCache[event.From]; ok && from.IsATA && isTokenEvent(event.Type) {
 			transferFrom = from.Owner
 		} else {
 			transferFrom = event.From
 		}
-		if to, ok := s.accountCache[event.To]; ok && to.IsATA && event.Type == "tokenTransfer" {
+		if to, ok := s.accountCache[event.To]; ok && to.IsATA && isTokenEvent(event.Type) {
 			transferTo = to.Owner
 		} else {
 			transferTo = event.To
@@ -115,41 +129,91 @@ func (s *SolParser) ParseTransfer(parsedTransaction *rpc.GetParsedTransactionRes
 				To:     transferTo,
 				Token:  event.Token,
 			})
-
-			amount, _ := new(big.Int).SetString(event.Amount, 10)
-			tt.AddTransfer(transferFrom, transferTo, event.Token, amount)
 		}
-	}
 
-	for _, event := range events {
-		//处理WSOL关闭账户，将WSOl账户余额+租金费 为关闭账户的转账
-		if event.Type == "closeAccount" && IsATA(event.To, solana.WrappedSol.String(), event.From) {
-			//此次交易剩余的WSOL
-			net := tt.GetNetBalance(event.To, solana.WrappedSol.String())
-
-			//账户开始金额，包含了租金费和余额
-			pre, _ := getBalance(event.From, parsedTransaction)
-			//关闭返还的SOL
+		//Token-2022 转账手续费单独记为转入扣留账户
+		if fee, ok := new(big.Int).SetString(event.Fee, 10); ok && fee.Sign() > 0 {
 			transfers = append(transfers, &Transfer{
-				From:   event.From,
-				To:     event.To,
-				Amount: new(big.Int).Add(net, big.NewInt(int64(pre))).String(),
-				Token:  consts.SOL,
+				Amount: event.Fee,
+				From:   transferFrom,
+				To:     consts.WITHHELD_ACCOUNT,
+				Token:  event.Token,
 			})
+		}
+	}
 
-			//关闭账户的代币
-			transfers = append(transfers, &Transfer{
-				From:   event.To,
-				To:     event.From,
-				Amount: net.String(),
-				Token:  solana.WrappedSol.String(),
-			})
+	for _, event := range events {
+		if event.Type != "closeAccount" {
+			continue
+		}
+		//关闭账户返还的 SOL：账户开始金额加上本交易中的流入、减去流出
+		refund := s.closeAccountRefund(event.From, events, parsedTransaction)
+		event.Amount = refund.String()
+		transfers = append(transfers, &Transfer{
+			From:   event.From,
+			To:     event.To,
+			Amount: refund.String(),
+			Token:  consts.SOL,
+		})
+
+		//WSOL 账户剩余的代币随关闭换回 SOL，记为所有者把 WSOL 还给账户
+		info, ok := s.accountCache[event.From]
+		if !ok || info.Token != solana.WrappedSol.String() {
+			continue
 		}
+		remaining := new(big.Int).Sub(refund, nativeRentReserve(event.From, parsedTransaction))
+		if remaining.Sign() <= 0 {
+			continue
+		}
+		owner := info.Owner
+		if owner == "" {
+			owner = event.To
+		}
+		transfers = append(transfers, &Transfer{
+			From:   owner,
+			To:     event.From,
+			Amount: remaining.String(),
+			Token:  solana.WrappedSol.String(),
+		})
 	}
 
 	return transfers, nil
 }
 
+// closeAccountRefund 关闭账户时返还的 lamports，WSOL 账户的代币转账同样会改变 lamports
+func (s *SolParser) closeAccountRefund(account string, events []*TransferEvent, tx *rpc.GetParsedTransactionResult) *big.Int {
+	pre, post := getBalance(account, tx)
+	native := false
+	if info, ok := s.accountCache[account]; ok {
+		native = info.Token == solana.WrappedSol.String()
+	}
+
+	refund := new(big.Int).SetUint64(pre)
+	for _, event := range events {
+		if event.Type == "closeAccount" {
+			continue
+		}
+		if event.Token != consts.SOL && !(native && event.Type == "tokenTransfer" && event.Token == solana.WrappedSol.String()) {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(event.Amount, 10)
+		if !ok {
+			continue
+		}
+		if event.To == account {
+			refund.Add(refund, amount)
+		}
+		if event.From == account {
+			refund.Sub(refund, amount)
+		}
+	}
+	refund.Sub(refund, new(big.Int).SetUint64(post))
+	if refund.Sign() < 0 {
+		refund.SetInt64(0)
+	}
+	return refund
+}
+
 func (s *SolParser) processInstructions(
 	tx *rpc.GetParsedTransactionResult,
 	getInstructions func(*rpc.GetParsedTransactionResult) []InstructionContext,
@@ -275,5 +339,9 @@ func (s *SolParser) parseInstruction(ix *rpc.ParsedInstruction) ([]byte, error)
 	if ix.Data == nil {
 		return ix.Parsed.MarshalJSON()
 	}
+	// RPC 未能解析的指令（例如部分 Token-2022 扩展）按二进制数据解码
+	if info, ok := decodeInstruction(ix.ProgramId, ix.Accounts, ix.Data); ok {
+		return json.Marshal(info)
+	}
 	return ix.Data, nil
 }
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/lonelybeanz/tools/pkg/solparser/consts"
+)
+
+func createAccountData(lamports, space uint64, owner solana.PublicKey) []byte {
+	data := make([]byte, 52)
+	binary.LittleEndian.PutUint32(data, systemCreateAccount)
+	binary.LittleEndian.PutUint64(data[4:], lamports)
+	binary.LittleEndian.PutUint64(data[12:], space)
+	copy(data[20:], owner.Bytes())
+	return data
+}
+
+func closeAccountTx(keys solana.PublicKeySlice, instructions ...solana.CompiledInstruction) *solana.Transaction {
+	return &solana.Transaction{
+		Signatures: []solana.Signature{{1}},
+		Message: solana.Message{
+			Header:       solana.MessageHeader{NumRequiredSignatures: 1},
+			AccountKeys:  keys,
+			Instructions: instructions,
+		},
+	}
+}
+
+func tokenBalance(index uint16, mint, owner solana.PublicKey, amount string) rpc.TokenBalance {
+	return rpc.TokenBalance{
+		AccountIndex:  index,
+		Mint:          mint,
+		Owner:         &owner,
+		UiTokenAmount: &rpc.UiTokenAmount{Amount: amount},
+	}
+}
+
+func checkTransfers(t *testing.T, got []*Transfer, want []Transfer) {
+	t.Helper()
+	if len(got) != len(want) {
+		for _, transfer := range got {
+			t.Logf("%+v", *transfer)
+		}
+		t.Fatalf("expected %d transfers, got %d", len(want), len(got))
+	}
+	for i, transfer := range got {
+		if *transfer != want[i] {
+			t.Fatalf("transfer %d: got %+v, want %+v", i, *transfer, want[i])
+		}
+	}
+}
+
+func TestCloseAccountRefund(t *testing.T) {
+	payer, account, pool, poolOwner, mint := testKey(1), testKey(2), testKey(3), testKey(4), testKey(5)
+	wsol := solana.WrappedSol
+
+	t.Run("wsol account created in tx", func(t *testing.T) {
+		// 非 ATA 的 WSOL 账户：创建时多存 5000000 作为 WSOL，关闭时全部返还
+		keys := solana.PublicKeySlice{payer, account, wsol, solana.SystemProgramID, solana.TokenProgramID}
+		initData := append([]byte{tokenInitializeAccount3}, payer.Bytes()...)
+		tx := closeAccountTx(keys,
+			solana.CompiledInstruction{ProgramIDIndex: 3, Accounts: []uint16{0, 1}, Data: createAccountData(7039280, tokenAccountSize, solana.TokenProgramID)},
+			solana.CompiledInstruction{ProgramIDIndex: 4, Accounts: []uint16{1, 2}, Data: initData},
+			solana.CompiledInstruction{ProgramIDIndex: 4, Accounts: []uint16{1, 0, 0}, Data: []byte{tokenCloseAccount}},
+		)
+		meta := &rpc.TransactionMeta{PreBalances: make([]uint64, 5), PostBalances: make([]uint64, 5)}
+
+		transfers, err := NewSolParser(nil, nil).ParseTransactionWithMeta(tx, meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTransfers(t, transfers, []Transfer{
+			{From: payer.String(), To: account.String(), Token: consts.SOL, Amount: "7039280"},
+			{From: account.String(), To: payer.String(), Token: consts.SOL, Amount: "7039280"},
+			{From: payer.String(), To: account.String(), Token: wsol.String(), Amount: "5000000"},
+		})
+	})
+
+	t.Run("token-2022 account with extensions", func(t *testing.T) {
+		// 带扩展的 Token-2022 账户租金与 SPL Token 不同，按实际余额返还
+		keys := solana.PublicKeySlice{payer, account, solana.Token2022ProgramID}
+		tx := closeAccountTx(keys,
+			solana.CompiledInstruction{ProgramIDIndex: 2, Accounts: []uint16{1, 0, 0}, Data: []byte{tokenCloseAccount}},
+		)
+		meta := &rpc.TransactionMeta{
+			PreBalances:      []uint64{1e9, 2500000, 1},
+			PostBalances:     []uint64{1e9 + 2500000, 0, 1},
+			PreTokenBalances: []rpc.TokenBalance{tokenBalance(1, mint, payer, "0")},
+		}
+
+		transfers, err := NewSolParser(nil, nil).ParseTransactionWithMeta(tx, meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTransfers(t, transfers, []Transfer{
+			{From: account.String(), To: payer.String(), Token: consts.SOL, Amount: "2500000"},
+		})
+	})
+
+	t.Run("existing wsol account receives and closes", func(t *testing.T) {
+		// 交易前持有 1000 WSOL，从池子收到 500 后关闭
+		keys := solana.PublicKeySlice{payer, account, pool, wsol, solana.TokenProgramID}
+		transferData := tokenTransferData(tokenTransferChecked, 500, 9)
+		tx := closeAccountTx(keys,
+			solana.CompiledInstruction{ProgramIDIndex: 4, Accounts: []uint16{2, 3, 1, 0}, Data: transferData},
+			solana.CompiledInstruction{ProgramIDIndex: 4, Accounts: []uint16{1, 0, 0}, Data: []byte{tokenCloseAccount}},
+		)
+		meta := &rpc.TransactionMeta{
+			PreBalances:  []uint64{1e9, 2040280, 3e9, 1, 1},
+			PostBalances: []uint64{1e9 + 2040780, 0, 3e9 - 500, 1, 1},
+			PreTokenBalances: []rpc.TokenBalance{
+				tokenBalance(1, wsol, payer, "1000"),
+				tokenBalance(2, wsol, poolOwner, "2997960720"),
+			},
+		}
+
+		transfers, err := NewSolParser(nil, nil).ParseTransactionWithMeta(tx, meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTransfers(t, transfers, []Transfer{
+			{From: poolOwner.String(), To: payer.String(), Token: wsol.String(), Amount: "500"},
+			{From: account.String(), To: payer.String(), Token: consts.SOL, Amount: "2040780"},
+			{From: payer.String(), To: account.String(), Token: wsol.String(), Amount: "1500"},
+		})
+	})
+}
+
+func TestRentExemptMinimum(t *testing.T) {
+	if got := rentExemptMinimum(tokenAccountSize); got != 2039280 {
+		t.Fatalf("unexpected token account rent %d", got)
+	}
+}
@@ -0,0 +1,417 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/lonelybeanz/tools/pkg/solparser/consts"
+)
+
+// Token-2022 扩展名称，用于 ExtensionEvent.Extension
+const (
+	ExtensionTransferFee          = "transferFee"
+	ExtensionConfidentialTransfer = "confidentialTransfer"
+	ExtensionInterestBearing      = "interestBearing"
+	ExtensionScaledUiAmount       = "scaledUiAmount"
+	ExtensionTransferHook         = "transferHook"
+)
+
+// mint 账户数据中需要调用方额外处理的扩展，key 为 spl-token-2022 的 ExtensionType
+var mintAccountExtensions = map[uint16]string{
+	10: ExtensionInterestBearing,
+	14: ExtensionTransferHook,
+	25: ExtensionScaledUiAmount,
+}
+
+// token2022MintTLVOffset 基础 mint 数据补齐到代币账户长度 165 字节，之后是 1 字节账户类型和 TLV 扩展
+const token2022MintTLVOffset = 166
+
+// transferHookExecute spl-transfer-hook-interface 的 Execute 指令标识，sha256("spl-transfer-hook-interface:execute")[:8]
+var transferHookExecute = []byte{105, 37, 101, 197, 75, 251, 102, 26}
+
+type TransferCheckedWithFee struct {
+	Info struct {
+		Authority   string      `json:"authority"`
+		Destination string      `json:"destination"`
+		Mint        string      `json:"mint"`
+		Source      string      `json:"source"`
+		TokenAmount TokenAmount `json:"tokenAmount"`
+		FeeAmount   TokenAmount `json:"feeAmount"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+type WithdrawWithheldTokens struct {
+	Info struct {
+		Mint                      string   `json:"mint"`
+		FeeRecipient              string   `json:"feeRecipient"`
+		WithdrawWithheldAuthority string   `json:"withdrawWithheldAuthority"`
+		SourceAccounts            []string `json:"sourceAccounts"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+type ConfidentialTransfer struct {
+	Info struct {
+		Account     string      `json:"account"`
+		Source      string      `json:"source"`
+		Destination string      `json:"destination"`
+		Mint        string      `json:"mint"`
+		Amount      json.Number `json:"amount"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+type MintExtensionConfig struct {
+	Info struct {
+		Mint string `json:"mint"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+// ExtensionEvents 最近一次 ParseTransfer 中出现的 Token-2022 扩展。计息、缩放 UI 金额和 transfer hook 的 mint
+// 由交易中的配置指令识别，设置了 RPC 客户端时也会查询转账 mint 的账户数据识别
+func (s *SolParser) ExtensionEvents() []*ExtensionEvent {
+	return s.extensionEvents
+}
+
+func (s *SolParser) recordExtension(extension, instruction, mint, account string) {
+	s.extensionEvents = append(s.extensionEvents, &ExtensionEvent{
+		Extension:   extension,
+		Instruction: instruction,
+		Mint:        mint,
+		Account:     account,
+	})
+}
+
+// parseExtensionEvent 解析 Token-2022 扩展指令，第二个返回值表示是否认识该指令
+func (s *SolParser) parseExtensionEvent(instructionType string, byteMsg []byte) (*TransferEvent, bool, error) {
+	switch instructionType {
+	case "transferCheckedWithFee":
+		transfer := &TransferCheckedWithFee{}
+		if err := json.Unmarshal(byteMsg, transfer); err != nil {
+			return nil, true, fmt.Errorf("unmarshaling transfer with fee: %w", err)
+		}
+		amount, ok := new(big.Int).SetString(transfer.Info.TokenAmount.Amount, 10)
+		fee, feeOk := new(big.Int).SetString(transfer.Info.FeeAmount.Amount, 10)
+		if !ok || !feeOk {
+			return nil, true, fmt.Errorf("invalid transfer with fee amount")
+		}
+		s.updateAccountCache(true, transfer.Info.Source, "", transfer.Info.Mint)
+		s.updateAccountCache(true, transfer.Info.Destination, "", transfer.Info.Mint)
+
+		// 接收方实际到账 amount - fee，手续费扣留在接收账户中
+		return &TransferEvent{
+			Type:   "tokenTransfer",
+			From:   transfer.Info.Source,
+			To:     transfer.Info.Destination,
+			Token:  transfer.Info.Mint,
+			Amount: new(big.Int).Sub(amount, fee).String(),
+			Fee:    fee.String(),
+		}, true, nil
+
+	case "withdrawWithheldTokensFromMint", "withdrawWithheldTokensFromAccounts":
+		withdraw := &WithdrawWithheldTokens{}
+		if err := json.Unmarshal(byteMsg, withdraw); err != nil {
+			return nil, true, fmt.Errorf("unmarshaling withdraw withheld tokens: %w", err)
+		}
+		s.updateAccountCache(true, withdraw.Info.FeeRecipient, "", withdraw.Info.Mint)
+
+		// 提取的金额不在指令数据中，在 ParseTransfer 中根据接收账户的余额变化计算
+		return &TransferEvent{
+			Type:  "withdrawWithheld",
+			From:  consts.WITHHELD_ACCOUNT,
+			To:    withdraw.Info.FeeRecipient,
+			Token: withdraw.Info.Mint,
+		}, true, nil
+
+	case "harvestWithheldTokensToMint", "initializeTransferFeeConfig", "setTransferFee":
+		// 手续费仍然处于扣留状态，余额不变
+		return nil, true, nil
+
+	case "initializeInterestBearingConfig", "updateInterestBearingConfigRate":
+		return nil, true, s.recordMintExtension(ExtensionInterestBearing, instructionType, byteMsg)
+
+	case "initializeScaledUiAmountConfig", "updateMultiplier":
+		return nil, true, s.recordMintExtension(ExtensionScaledUiAmount, instructionType, byteMsg)
+
+	case "initializeTransferHook", "updateTransferHook":
+		return nil, true, s.recordMintExtension(ExtensionTransferHook, instructionType, byteMsg)
+
+	case "amountToUiAmount", "uiAmountToAmount":
+		return nil, true, nil
+	}
+
+	if !strings.Contains(strings.ToLower(instructionType), "confidential") {
+		return nil, false, nil
+	}
+	confidential := &ConfidentialTransfer{}
+	if err := json.Unmarshal(byteMsg, confidential); err != nil {
+		return nil, true, fmt.Errorf("unmarshaling confidential transfer: %w", err)
+	}
+	account := confidential.Info.Account
+	if account == "" {
+		account = confidential.Info.Source
+	}
+	s.recordExtension(ExtensionConfidentialTransfer, instructionType, confidential.Info.Mint, account)
+
+	// 存入和取出会改变公开余额，其他机密指令的金额是加密的
+	switch instructionType {
+	case "depositConfidentialTransfer":
+		s.updateAccountCache(true, confidential.Info.Source, "", confidential.Info.Mint)
+		return &TransferEvent{
+			Type:   "confidentialDeposit",
+			From:   confidential.Info.Source,
+			To:     consts.CONFIDENTIAL_ACCOUNT,
+			Token:  confidential.Info.Mint,
+			Amount: confidential.Info.Amount.String(),
+		}, true, nil
+	case "withdrawConfidentialTransfer":
+		s.updateAccountCache(true, confidential.Info.Destination, "", confidential.Info.Mint)
+		return &TransferEvent{
+			Type:   "confidentialWithdraw",
+			From:   consts.CONFIDENTIAL_ACCOUNT,
+			To:     confidential.Info.Destination,
+			Token:  confidential.Info.Mint,
+			Amount: confidential.Info.Amount.String(),
+		}, true, nil
+	}
+	return nil, true, nil
+}
+
+func (s *SolParser) recordMintExtension(extension, instructionType string, byteMsg []byte) error {
+	config := &MintExtensionConfig{}
+	if err := json.Unmarshal(byteMsg, config); err != nil {
+		return fmt.Errorf("unmarshaling %s: %w", instructionType, err)
+	}
+	s.recordExtension(extension, instructionType, config.Info.Mint, "")
+	return nil
+}
+
+// detectMintExtensions 查询本交易转账涉及的 mint 账户，记录开启了计息、缩放 UI 金额或 transfer hook 的 mint。
+// 交易中已有同一 mint 的配置指令或 Execute 调用时不重复记录；没有 RPC 客户端时跳过
+func (s *SolParser) detectMintExtensions(events []*TransferEvent) {
+	if s.cli == nil {
+		return
+	}
+	for _, event := range events {
+		if !isTokenEvent(event.Type) || event.Token == "" || event.Token == consts.SOL {
+			continue
+		}
+		for _, extension := range s.getMintExtensions(event.Token) {
+			if s.hasExtension(extension, event.Token) {
+				continue
+			}
+			s.recordExtension(extension, event.Type, event.Token, event.From)
+		}
+	}
+}
+
+func (s *SolParser) hasExtension(extension, mint string) bool {
+	for _, event := range s.extensionEvents {
+		if event.Extension == extension && event.Mint == mint {
+			return true
+		}
+	}
+	return false
+}
+
+// getMintExtensions mint 账户开启的扩展，结果按 mint 缓存，查询失败时不缓存
+func (s *SolParser) getMintExtensions(mint string) []string {
+	if extensions, ok := s.mintExtensions[mint]; ok {
+		return extensions
+	}
+	key, err := solana.PublicKeyFromBase58(mint)
+	if err != nil {
+		return nil
+	}
+	account, err := s.cli.GetAccountInfo(context.Background(), key)
+	if err != nil || account.Value == nil {
+		return nil
+	}
+	var extensions []string
+	if account.Value.Owner.Equals(solana.Token2022ProgramID) {
+		extensions = mintExtensionsFromData(account.GetBinary())
+	}
+	if s.mintExtensions == nil {
+		s.mintExtensions = make(map[string][]string)
+	}
+	s.mintExtensions[mint] = extensions
+	return extensions
+}
+
+// mintExtensionsFromData 从 Token-2022 mint 账户数据的 TLV 中找出 mintAccountExtensions 里的扩展
+func mintExtensionsFromData(data []byte) []string {
+	var extensions []string
+	for offset := token2022MintTLVOffset; offset+4 <= len(data); {
+		extensionType := binary.LittleEndian.Uint16(data[offset:])
+		length := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		if extensionType == 0 {
+			break
+		}
+		if name, ok := mintAccountExtensions[extensionType]; ok {
+			extensions = append(extensions, name)
+		}
+		offset += 4 + length
+	}
+	return extensions
+}
+
+// detectTransferHooks 找出 Token-2022 转账时 CPI 调用的 transfer hook 程序（Execute 指令）
+func (s *SolParser) detectTransferHooks(tx *rpc.GetParsedTransactionResult) {
+	instructions := append([]*rpc.ParsedInstruction{}, tx.Transaction.Message.Instructions...)
+	for _, inner := range tx.Meta.InnerInstructions {
+		instructions = append(instructions, inner.Instructions...)
+	}
+	for _, inst := range instructions {
+		if inst.Parsed != nil || !bytes.HasPrefix(inst.Data, transferHookExecute) || len(inst.Accounts) < 3 {
+			continue
+		}
+		// Execute 的账户依次为 source、mint、destination、authority
+		s.extensionEvents = append(s.extensionEvents, &ExtensionEvent{
+			Extension:   ExtensionTransferHook,
+			Instruction: "execute",
+			Mint:        inst.Accounts[1].String(),
+			Account:     inst.Accounts[0].String(),
+			Program:     inst.ProgramId.String(),
+		})
+	}
+}
+
+// splitTransferFees 普通 transfer/transferChecked 转入开启了转账手续费的 Token-2022 账户时，指令数据中没有手续费，
+// 接收账户实际到账比指令金额少。根据接收账户交易前后的余额差和本交易中的其他转入转出得到被扣留的手续费，
+// 按金额比例分摊到这些转账上。需要节点在 token balances 中返回 programId。
+func splitTransferFees(events []*TransferEvent, tx *rpc.GetParsedTransactionResult) {
+	type accountKey struct{ account, mint string }
+	incoming := make(map[accountKey][]*TransferEvent)
+	order := make([]accountKey, 0)
+	for _, event := range events {
+		if event.Type != "tokenTransfer" || event.Fee != "" || !isToken2022Account(event.To, tx) {
+			continue
+		}
+		key := accountKey{account: event.To, mint: event.Token}
+		if _, ok := incoming[key]; !ok {
+			order = append(order, key)
+		}
+		incoming[key] = append(incoming[key], event)
+	}
+
+	for _, key := range order {
+		expected, ok := expectedTokenBalance(key.account, key.mint, events, tx)
+		if !ok {
+			continue
+		}
+		actual, ok := getTokenBalance(key.account, tx.Meta.PostTokenBalances, tx)
+		if !ok {
+			continue
+		}
+		total := new(big.Int)
+		amounts := make([]*big.Int, len(incoming[key]))
+		for i, event := range incoming[key] {
+			amounts[i], _ = new(big.Int).SetString(event.Amount, 10)
+			if amounts[i] == nil {
+				amounts[i] = new(big.Int)
+			}
+			total.Add(total, amounts[i])
+		}
+		fee := new(big.Int).Sub(expected, actual)
+		if fee.Sign() <= 0 || fee.Cmp(total) > 0 {
+			continue
+		}
+
+		// 按比例分摊，余数计入最后一笔
+		remaining := new(big.Int).Set(fee)
+		for i, event := range incoming[key] {
+			share := new(big.Int).Div(new(big.Int).Mul(fee, amounts[i]), total)
+			if i == len(amounts)-1 {
+				share = new(big.Int).Set(remaining)
+			}
+			remaining.Sub(remaining, share)
+			event.Amount = new(big.Int).Sub(amounts[i], share).String()
+			event.Fee = share.String()
+		}
+	}
+}
+
+// expectedTokenBalance 不扣手续费时账户交易后的余额：交易前余额加上本交易中的转入、减去转出。
+// 有金额未知的提取扣留手续费转入时返回 false
+func expectedTokenBalance(account, mint string, events []*TransferEvent, tx *rpc.GetParsedTransactionResult) (*big.Int, bool) {
+	balance := new(big.Int)
+	if pre, ok := getTokenBalance(account, tx.Meta.PreTokenBalances, tx); ok {
+		balance.Set(pre)
+	}
+	for _, event := range events {
+		if event.Token != mint || (event.To != account && event.From != account) {
+			continue
+		}
+		if event.Type == "withdrawWithheld" {
+			return nil, false
+		}
+		value, ok := new(big.Int).SetString(event.Amount, 10)
+		if !ok {
+			continue
+		}
+		if event.To == account {
+			balance.Add(balance, value)
+		}
+		if event.From == account {
+			balance.Sub(balance, value)
+			// 带手续费的转账从转出账户扣除 amount + fee
+			if fee, ok := new(big.Int).SetString(event.Fee, 10); ok {
+				balance.Sub(balance, fee)
+			}
+		}
+	}
+	return balance, true
+}
+
+// isToken2022Account 账户是否属于 Token-2022 程序
+func isToken2022Account(address string, tx *rpc.GetParsedTransactionResult) bool {
+	keys := tx.Transaction.Message.AccountKeys
+	for _, balances := range [][]rpc.TokenBalance{tx.Meta.PreTokenBalances, tx.Meta.PostTokenBalances} {
+		for _, balance := range balances {
+			if int(balance.AccountIndex) < len(keys) && keys[balance.AccountIndex].PublicKey.String() == address &&
+				balance.ProgramId != nil && balance.ProgramId.Equals(solana.Token2022ProgramID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withheldWithdrawal 提取的扣留手续费：接收账户交易前后的代币余额差，减去本交易中其他转入、加上转出
+func withheldWithdrawal(account, mint string, events []*TransferEvent, tx *rpc.GetParsedTransactionResult) *big.Int {
+	amount := new(big.Int)
+	if post, ok := getTokenBalance(account, tx.Meta.PostTokenBalances, tx); ok {
+		amount.Add(amount, post)
+	}
+	if pre, ok := getTokenBalance(account, tx.Meta.PreTokenBalances, tx); ok {
+		amount.Sub(amount, pre)
+	}
+	for _, event := range events {
+		if event.Type == "withdrawWithheld" || event.Token != mint {
+			continue
+		}
+		value, ok := new(big.Int).SetString(event.Amount, 10)
+		if !ok {
+			continue
+		}
+		if event.To == account {
+			amount.Sub(amount, value)
+		}
+		if event.From == account {
+			amount.Add(amount, value)
+		}
+	}
+	if amount.Sign() < 0 {
+		amount.SetInt64(0)
+	}
+	return amount
+}
@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/lonelybeanz/tools/pkg/solparser/consts"
+)
+
+func transferWithFeeData(amount uint64, decimals uint8, fee uint64) []byte {
+	data := []byte{tokenTransferFeeExtension, 1}
+	data = binary.LittleEndian.AppendUint64(data, amount)
+	data = append(data, decimals)
+	return binary.LittleEndian.AppendUint64(data, fee)
+}
+
+func TestToken2022Extensions(t *testing.T) {
+	payer, source, dest, recipient, mint, hook, poolOwner := testKey(1), testKey(2), testKey(3), testKey(4), testKey(5), testKey(6), testKey(7)
+	keys := solana.PublicKeySlice{payer, source, dest, recipient, mint, solana.Token2022ProgramID, hook}
+
+	deposit := []byte{tokenConfidentialTransferExtension, 5}
+	deposit = append(binary.LittleEndian.AppendUint64(deposit, 100), 6)
+	tx := closeAccountTx(keys,
+		// 转账 1000，手续费 10 扣留在接收账户
+		solana.CompiledInstruction{ProgramIDIndex: 5, Accounts: []uint16{1, 4, 2, 0}, Data: transferWithFeeData(1000, 6, 10)},
+		// 从 mint 提取扣留的手续费到 recipient
+		solana.CompiledInstruction{ProgramIDIndex: 5, Accounts: []uint16{4, 3, 0}, Data: []byte{tokenTransferFeeExtension, 2}},
+		// 存入 100 到机密余额
+		solana.CompiledInstruction{ProgramIDIndex: 5, Accounts: []uint16{1, 4, 0}, Data: deposit},
+		solana.CompiledInstruction{ProgramIDIndex: 5, Accounts: []uint16{4, 0}, Data: []byte{tokenInterestBearingMintExtension, 1, 0x10, 0}},
+		solana.CompiledInstruction{ProgramIDIndex: 5, Accounts: []uint16{4, 0}, Data: []byte{tokenScaledUiAmountExtension, 1}},
+	)
+	meta := &rpc.TransactionMeta{
+		PreBalances:  make([]uint64, len(keys)),
+		PostBalances: make([]uint64, len(keys)),
+		InnerInstructions: []rpc.InnerInstruction{{
+			Index: 0,
+			Instructions: []rpc.CompiledInstruction{
+				{ProgramIDIndex: 6, Accounts: []uint16{1, 4, 2, 0}, Data: append(append([]byte{}, transferHookExecute...), 0, 0, 0, 0, 0, 0, 0, 0), StackHeight: 2},
+			},
+		}},
+		PreTokenBalances: []rpc.TokenBalance{
+			tokenBalance(1, mint, payer, "5000"),
+			tokenBalance(2, mint, poolOwner, "0"),
+		},
+		PostTokenBalances: []rpc.TokenBalance{
+			tokenBalance(1, mint, payer, "3900"),
+			tokenBalance(2, mint, poolOwner, "990"),
+			tokenBalance(3, mint, recipient, "50"),
+		},
+	}
+
+	s := NewSolParser(nil, nil)
+	transfers, err := s.ParseTransactionWithMeta(tx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransfers(t, transfers, []Transfer{
+		{From: payer.String(), To: poolOwner.String(), Token: mint.String(), Amount: "990"},
+		{From: payer.String(), To: consts.WITHHELD_ACCOUNT, Token: mint.String(), Amount: "10"},
+		{From: consts.WITHHELD_ACCOUNT, To: recipient.String(), Token: mint.String(), Amount: "50"},
+		{From: payer.String(), To: consts.CONFIDENTIAL_ACCOUNT, Token: mint.String(), Amount: "100"},
+	})
+
+	want := []ExtensionEvent{
+		{Extension: ExtensionConfidentialTransfer, Instruction: "depositConfidentialTransfer", Mint: mint.String(), Account: source.String()},
+		{Extension: ExtensionInterestBearing, Instruction: "updateInterestBearingConfigRate", Mint: mint.String()},
+		{Extension: ExtensionScaledUiAmount, Instruction: "updateMultiplier", Mint: mint.String()},
+		{Extension: ExtensionTransferHook, Instruction: "execute", Mint: mint.String(), Account: source.String(), Program: hook.String()},
+	}
+	got := s.ExtensionEvents()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d extension events, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Fatalf("extension event %d: got %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
+
+func TestParseTransferCheckedWithFeeJSON(t *testing.T) {
+	ix := parsedTokenIx(t, `{"type":"transferCheckedWithFee","info":{"source":"A","mint":"M","destination":"B","authority":"O",`+
+		`"tokenAmount":{"amount":"1000","decimals":6},"feeAmount":{"amount":"25","decimals":6}}}`)
+	ix.ProgramId = solana.Token2022ProgramID
+
+	event, err := NewSolParser(nil, nil).ParseTokenTransferEvent(ix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TransferEvent{Type: "tokenTransfer", From: "A", To: "B", Token: "M", Amount: "975", Fee: "25"}
+	if *event != want {
+		t.Fatalf("got %+v, want %+v", *event, want)
+	}
+
+	// SPL Token 没有扩展指令
+	ix.ProgramId = solana.TokenProgramID
+	if _, err := NewSolParser(nil, nil).ParseTokenTransferEvent(ix); err == nil {
+		t.Fatal("expected error for extension instruction on SPL Token")
+	}
+}
+
+func TestTransferCheckedFeeFromBalances(t *testing.T) {
+	payer, source, dest, mint, poolOwner := testKey(1), testKey(2), testKey(3), testKey(5), testKey(7)
+	keys := solana.PublicKeySlice{payer, source, dest, mint, solana.Token2022ProgramID}
+	token2022 := func(b rpc.TokenBalance) rpc.TokenBalance {
+		b.ProgramId = &solana.Token2022ProgramID
+		return b
+	}
+
+	// 普通 transferChecked 转账 1000 到开启了 1% 转账手续费的 mint，指令数据中没有手续费
+	tx := closeAccountTx(keys,
+		solana.CompiledInstruction{ProgramIDIndex: 4, Accounts: []uint16{1, 3, 2, 0}, Data: tokenTransferData(tokenTransferChecked, 1000, 6)},
+		solana.CompiledInstruction{ProgramIDIndex: 4, Accounts: []uint16{1, 3, 2, 0}, Data: tokenTransferData(tokenTransferChecked, 3000, 6)},
+	)
+	meta := &rpc.TransactionMeta{
+		PreBalances:  make([]uint64, len(keys)),
+		PostBalances: make([]uint64, len(keys)),
+		PreTokenBalances: []rpc.TokenBalance{
+			token2022(tokenBalance(1, mint, payer, "5000")),
+			token2022(tokenBalance(2, mint, poolOwner, "100")),
+		},
+		PostTokenBalances: []rpc.TokenBalance{
+			token2022(tokenBalance(1, mint, payer, "1000")),
+			token2022(tokenBalance(2, mint, poolOwner, "4060")),
+		},
+	}
+
+	transfers, err := NewSolParser(nil, nil).ParseTransactionWithMeta(tx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransfers(t, transfers, []Transfer{
+		{From: payer.String(), To: poolOwner.String(), Token: mint.String(), Amount: "990"},
+		{From: payer.String(), To: consts.WITHHELD_ACCOUNT, Token: mint.String(), Amount: "10"},
+		{From: payer.String(), To: poolOwner.String(), Token: mint.String(), Amount: "2970"},
+		{From: payer.String(), To: consts.WITHHELD_ACCOUNT, Token: mint.String(), Amount: "30"},
+	})
+
+	// SPL Token 账户没有转账手续费，余额对不上时不拆分
+	for i := range meta.PostTokenBalances {
+		meta.PreTokenBalances[i].ProgramId = &solana.TokenProgramID
+		meta.PostTokenBalances[i].ProgramId = &solana.TokenProgramID
+	}
+	keys[4] = solana.TokenProgramID
+	transfers, err = NewSolParser(nil, nil).ParseTransactionWithMeta(tx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransfers(t, transfers, []Transfer{
+		{From: payer.String(), To: poolOwner.String(), Token: mint.String(), Amount: "1000"},
+		{From: payer.String(), To: poolOwner.String(), Token: mint.String(), Amount: "3000"},
+	})
+}
+
+// mintAccountData 构造带 TLV 扩展的 Token-2022 mint 账户数据
+func mintAccountData(extensionTypes ...uint16) []byte {
+	data := make([]byte, token2022MintTLVOffset)
+	data[token2022MintTLVOffset-1] = 1 // AccountType::Mint
+	for _, extensionType := range extensionTypes {
+		data = binary.LittleEndian.AppendUint16(data, extensionType)
+		data = binary.LittleEndian.AppendUint16(data, 8)
+		data = append(data, make([]byte, 8)...)
+	}
+	return data
+}
+
+func TestMintExtensionsFromAccountData(t *testing.T) {
+	payer, source, dest, mint, poolOwner := testKey(1), testKey(2), testKey(3), testKey(5), testKey(7)
+	keys := solana.PublicKeySlice{payer, source, dest, mint, solana.Token2022ProgramID}
+
+	var calls int64
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		result := `{"context":{"slot":1},"value":null}`
+		if string(req.Params[0]) == `"`+mint.String()+`"` {
+			// 转账手续费（1）、计息（10）、缩放 UI 金额（25）
+			data := base64.StdEncoding.EncodeToString(mintAccountData(1, 10, 25))
+			result = `{"context":{"slot":1},"value":{"data":["` + data + `","base64"],"executable":false,"lamports":1,"owner":"` +
+				solana.Token2022ProgramID.String() + `","rentEpoch":0}}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `,"result":` + result + `}`))
+	}))
+	defer node.Close()
+
+	// 普通 transferChecked，交易中没有扩展的配置指令
+	tx := closeAccountTx(keys,
+		solana.CompiledInstruction{ProgramIDIndex: 4, Accounts: []uint16{1, 3, 2, 0}, Data: tokenTransferData(tokenTransferChecked, 1000, 6)},
+	)
+	meta := &rpc.TransactionMeta{
+		PreBalances:       make([]uint64, len(keys)),
+		PostBalances:      make([]uint64, len(keys)),
+		PreTokenBalances:  []rpc.TokenBalance{tokenBalance(1, mint, payer, "5000"), tokenBalance(2, mint, poolOwner, "0")},
+		PostTokenBalances: []rpc.TokenBalance{tokenBalance(1, mint, payer, "4000"), tokenBalance(2, mint, poolOwner, "1000")},
+	}
+
+	s := NewSolParser(rpc.New(node.URL), nil)
+	for i := 0; i < 2; i++ {
+		if _, err := s.ParseTransactionWithMeta(tx, meta); err != nil {
+			t.Fatal(err)
+		}
+		want := []ExtensionEvent{
+			{Extension: ExtensionInterestBearing, Instruction: "tokenTransfer", Mint: mint.String(), Account: source.String()},
+			{Extension: ExtensionScaledUiAmount, Instruction: "tokenTransfer", Mint: mint.String(), Account: source.String()},
+		}
+		got := s.ExtensionEvents()
+		if len(got) != len(want) {
+			t.Fatalf("expected %d extension events, got %d", len(want), len(got))
+		}
+		for i := range want {
+			if *got[i] != want[i] {
+				t.Fatalf("extension event %d: got %+v, want %+v", i, *got[i], want[i])
+			}
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("mint account should be fetched once, got %d calls", calls)
+	}
+
+	// 截断的 TLV 不越界
+	if got := mintExtensionsFromData(mintAccountData(14)[:token2022MintTLVOffset+3]); len(got) != 0 {
+		t.Fatalf("unexpected extensions from truncated data: %v", got)
+	}
+}
@@ -3,7 +3,6 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
@@ -20,22 +19,75 @@ type TokenTransfer struct {
 	InstructionType string `json:"type"`
 }
 
+type TokenAmount struct {
+	Amount         string  `json:"amount"`
+	Decimals       int     `json:"decimals"`
+	UiAmount       float64 `json:"uiAmount"`
+	UiAmountString string  `json:"uiAmountString"`
+}
+
 type TokenTransferChecked struct {
 	Info struct {
-		Authority   string `json:"authority"`
-		Destination string `json:"destination"`
-		Mint        string `json:"mint"`
-		Source      string `json:"source"`
-		TokenAmount struct {
-			Amount         string  `json:"amount"`
-			Decimals       int     `json:"decimals"`
-			UiAmount       float64 `json:"uiAmount"`
-			UiAmountString string  `json:"uiAmountString"`
-		} `json:"tokenAmount"`
+		Authority   string      `json:"authority"`
+		Destination string      `json:"destination"`
+		Mint        string      `json:"mint"`
+		Source      string      `json:"source"`
+		TokenAmount TokenAmount `json:"tokenAmount"`
 	} `json:"info"`
 	InstructionType string `json:"type"`
 }
 
+type MintTo struct {
+	Info struct {
+		Account       string `json:"account"`
+		Mint          string `json:"mint"`
+		MintAuthority string `json:"mintAuthority"`
+		Amount        string `json:"amount"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+type MintToChecked struct {
+	Info struct {
+		Account       string      `json:"account"`
+		Mint          string      `json:"mint"`
+		MintAuthority string      `json:"mintAuthority"`
+		TokenAmount   TokenAmount `json:"tokenAmount"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+type Burn struct {
+	Info struct {
+		Account   string `json:"account"`
+		Mint      string `json:"mint"`
+		Authority string `json:"authority"`
+		Amount    string `json:"amount"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+type BurnChecked struct {
+	Info struct {
+		Account     string      `json:"account"`
+		Mint        string      `json:"mint"`
+		Authority   string      `json:"authority"`
+		TokenAmount TokenAmount `json:"tokenAmount"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
+type SetAuthority struct {
+	Info struct {
+		Account       string `json:"account"`
+		Mint          string `json:"mint"`
+		Authority     string `json:"authority"`
+		AuthorityType string `json:"authorityType"`
+		NewAuthority  string `json:"newAuthority"`
+	} `json:"info"`
+	Type string `json:"type"`
+}
+
 type CloseAccount struct {
 	Info struct {
 		Account     string `json:"account"`
@@ -67,24 +119,14 @@ func (s *SolParser) ParseTokenTransferEvent(tx *rpc.ParsedInstruction) (*Transfe
 		return nil, fmt.Errorf("parsing instruction: %w", err)
 	}
 
-	msgStr := string(byteMsg)
-
-	var instructionType string
-	if strings.Contains(msgStr, "transferChecked") {
-		instructionType = "transferChecked"
-	} else if strings.Contains(msgStr, "transfer") {
-		instructionType = "transfer"
-	} else if strings.Contains(msgStr, "closeAccount") {
-		instructionType = "closeAccount"
-	} else if strings.Contains(msgStr, "initializeAccount3") {
-		instructionType = "initializeAccount3"
-	} else if strings.Contains(msgStr, "syncNative") {
-		instructionType = "syncNative"
-	} else {
-		return nil, fmt.Errorf("not a valid transfer instruction %s", tx.ProgramId.String())
+	var instruction struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(byteMsg, &instruction); err != nil {
+		return nil, fmt.Errorf("not a valid transfer instruction %s: %w", tx.ProgramId.String(), err)
 	}
 
-	switch instructionType {
+	switch instruction.Type {
 	case "transferChecked":
 		transfer1 := &TokenTransferChecked{}
 		if err := json.Unmarshal(byteMsg, transfer1); err != nil {
@@ -117,6 +159,49 @@ func (s *SolParser) ParseTokenTransferEvent(tx *rpc.ParsedInstruction) (*Transfe
 			Amount: transfer.Info.Amount,
 		}, nil
 
+	case "mintTo":
+		mintTo := &MintTo{}
+		if err := json.Unmarshal(byteMsg, mintTo); err != nil {
+			return nil, fmt.Errorf("unmarshaling mint to: %w", err)
+		}
+		return s.mintEvent(mintTo.Info.Mint, mintTo.Info.Account, mintTo.Info.Amount), nil
+
+	case "mintToChecked":
+		mintTo := &MintToChecked{}
+		if err := json.Unmarshal(byteMsg, mintTo); err != nil {
+			return nil, fmt.Errorf("unmarshaling checked mint to: %w", err)
+		}
+		return s.mintEvent(mintTo.Info.Mint, mintTo.Info.Account, mintTo.Info.TokenAmount.Amount), nil
+
+	case "burn":
+		burn := &Burn{}
+		if err := json.Unmarshal(byteMsg, burn); err != nil {
+			return nil, fmt.Errorf("unmarshaling burn: %w", err)
+		}
+		return s.burnEvent(burn.Info.Mint, burn.Info.Account, burn.Info.Amount), nil
+
+	case "burnChecked":
+		burn := &BurnChecked{}
+		if err := json.Unmarshal(byteMsg, burn); err != nil {
+			return nil, fmt.Errorf("unmarshaling checked burn: %w", err)
+		}
+		return s.burnEvent(burn.Info.Mint, burn.Info.Account, burn.Info.TokenAmount.Amount), nil
+
+	case "approve", "approveChecked":
+		// 授权不改变余额
+		return nil, nil
+
+	case "setAuthority":
+		setAuthority := &SetAuthority{}
+		if err := json.Unmarshal(byteMsg, setAuthority); err != nil {
+			return nil, fmt.Errorf("unmarshaling set authority: %w", err)
+		}
+		// 代币账户转移所有权后，后续的转账归属到新的所有者
+		if setAuthority.Info.AuthorityType == "accountOwner" && setAuthority.Info.NewAuthority != "" {
+			s.updateAccountCache(true, setAuthority.Info.Account, setAuthority.Info.NewAuthority, "")
+		}
+		return nil, nil
+
 	case "closeAccount":
 		closeAccount := &CloseAccount{}
 		if err := json.Unmarshal(byteMsg, closeAccount); err != nil {
@@ -124,12 +209,12 @@ func (s *SolParser) ParseTokenTransferEvent(tx *rpc.ParsedInstruction) (*Transfe
 		}
 		s.updateAccountCache(true, closeAccount.Info.Account, closeAccount.Info.Owner, "")
 
+		// 返还金额在 ParseTransfer 中根据余额和交易内的转账计算
 		return &TransferEvent{
-			Type:   "closeAccount",
-			From:   closeAccount.Info.Account,
-			To:     closeAccount.Info.Destination,
-			Token:  consts.SOL,
-			Amount: "2039280",
+			Type:  "closeAccount",
+			From:  closeAccount.Info.Account,
+			To:    closeAccount.Info.Destination,
+			Token: consts.SOL,
 		}, nil
 
 	case "initializeAccount3":
@@ -161,7 +246,38 @@ func (s *SolParser) ParseTokenTransferEvent(tx *rpc.ParsedInstruction) (*Transfe
 			Amount: "",
 		}, nil
 	default:
+		if tx.ProgramId == solana.Token2022ProgramID {
+			if event, ok, err := s.parseExtensionEvent(instruction.Type, byteMsg); ok {
+				return event, err
+			}
+		}
 		return nil, fmt.Errorf("not a valid transfer instruction %s", tx.ProgramId.String())
 	}
 
 }
+
+// mintEvent 铸造记为从 MINT_ACCOUNT 转入代币账户
+func (s *SolParser) mintEvent(mint, account, amount string) *TransferEvent {
+	s.updateAccountCache(true, account, "", mint)
+	s.updateTokenAccountCache(mint, account)
+	return &TransferEvent{
+		Type:   "mintTo",
+		From:   consts.MINT_ACCOUNT,
+		To:     account,
+		Token:  mint,
+		Amount: amount,
+	}
+}
+
+// burnEvent 销毁记为从代币账户转入 BURN_ACCOUNT
+func (s *SolParser) burnEvent(mint, account, amount string) *TransferEvent {
+	s.updateAccountCache(true, account, "", mint)
+	s.updateTokenAccountCache(mint, account)
+	return &TransferEvent{
+		Type:   "burn",
+		From:   account,
+		To:     consts.BURN_ACCOUNT,
+		Token:  mint,
+		Amount: amount,
+	}
+}
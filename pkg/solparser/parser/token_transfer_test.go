@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/lonelybeanz/tools/pkg/solparser/consts"
+)
+
+func parsedTokenIx(t *testing.T, parsed string) *rpc.ParsedInstruction {
+	t.Helper()
+	envelope := new(rpc.InstructionInfoEnvelope)
+	if err := envelope.UnmarshalJSON([]byte(parsed)); err != nil {
+		t.Fatal(err)
+	}
+	return &rpc.ParsedInstruction{ProgramId: solana.TokenProgramID, Parsed: envelope}
+}
+
+func TestParseTokenTransferEventDispatch(t *testing.T) {
+	s := NewSolParser(nil, nil)
+	for _, tc := range []struct {
+		name   string
+		parsed string
+		want   *TransferEvent
+	}{
+		{
+			name:   "transfer",
+			parsed: `{"type":"transfer","info":{"source":"A","destination":"B","authority":"O","amount":"5"}}`,
+			want:   &TransferEvent{Type: "tokenTransfer", From: "A", To: "B", Amount: "5"},
+		},
+		{
+			name:   "mintTo",
+			parsed: `{"type":"mintTo","info":{"mint":"M","account":"B","mintAuthority":"O","amount":"100"}}`,
+			want:   &TransferEvent{Type: "mintTo", From: consts.MINT_ACCOUNT, To: "B", Token: "M", Amount: "100"},
+		},
+		{
+			name:   "mintToChecked",
+			parsed: `{"type":"mintToChecked","info":{"mint":"M","account":"B","mintAuthority":"O","tokenAmount":{"amount":"100","decimals":2}}}`,
+			want:   &TransferEvent{Type: "mintTo", From: consts.MINT_ACCOUNT, To: "B", Token: "M", Amount: "100"},
+		},
+		{
+			name:   "burn",
+			parsed: `{"type":"burn","info":{"account":"A","mint":"M","authority":"O","amount":"7"}}`,
+			want:   &TransferEvent{Type: "burn", From: "A", To: consts.BURN_ACCOUNT, Token: "M", Amount: "7"},
+		},
+		{
+			name:   "burnChecked",
+			parsed: `{"type":"burnChecked","info":{"account":"A","mint":"M","authority":"O","tokenAmount":{"amount":"7","decimals":2}}}`,
+			want:   &TransferEvent{Type: "burn", From: "A", To: consts.BURN_ACCOUNT, Token: "M", Amount: "7"},
+		},
+		{
+			name:   "approve",
+			parsed: `{"type":"approve","info":{"source":"A","delegate":"transferDelegate","owner":"O","amount":"7"}}`,
+		},
+		{
+			name:   "setAuthority",
+			parsed: `{"type":"setAuthority","info":{"mint":"M","authority":"O","authorityType":"transferFeeConfig","newAuthority":null}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			event, err := s.ParseTokenTransferEvent(parsedTokenIx(t, tc.parsed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want == nil {
+				if event != nil {
+					t.Fatalf("expected no event, got %+v", event)
+				}
+				return
+			}
+			if event == nil || *event != *tc.want {
+				t.Fatalf("got %+v, want %+v", event, tc.want)
+			}
+		})
+	}
+
+	if _, err := s.ParseTokenTransferEvent(parsedTokenIx(t, `{"type":"freezeAccount","info":{"account":"A"}}`)); err == nil {
+		t.Fatal("expected error for unsupported instruction")
+	}
+}
+
+func TestParseTransferMintAndBurn(t *testing.T) {
+	tx, meta, names := rawFixture()
+	// DEX 内部改为：给用户铸造 100，再从池子账户销毁 7
+	meta.InnerInstructions[0].Instructions = []rpc.CompiledInstruction{
+		{ProgramIDIndex: 6, Accounts: []uint16{4, 1, 0}, Data: tokenTransferData(tokenMintTo, 100), StackHeight: 2},
+		{ProgramIDIndex: 6, Accounts: []uint16{2, 4, 7}, Data: tokenTransferData(tokenBurnChecked, 7, 6), StackHeight: 2},
+	}
+
+	transfers, err := NewSolParser(nil, nil).ParseTransactionWithMeta(tx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Transfer{
+		{From: names["payer"].String(), To: names["recipient"].String(), Token: consts.SOL, Amount: "1000"},
+		{From: consts.MINT_ACCOUNT, To: names["payer"].String(), Token: names["mint"].String(), Amount: "100"},
+		{From: names["poolOwner"].String(), To: consts.BURN_ACCOUNT, Token: names["mint"].String(), Amount: "7"},
+	}
+	if len(transfers) != len(want) {
+		t.Fatalf("expected %d transfers, got %d", len(want), len(transfers))
+	}
+	for i, transfer := range transfers {
+		if *transfer != want[i] {
+			t.Fatalf("transfer %d: got %+v, want %+v", i, *transfer, want[i])
+		}
+	}
+}
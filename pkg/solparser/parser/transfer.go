@@ -7,6 +7,18 @@ type TransferEvent struct {
 	To         string `json:"to"`
 	Token      string `json:"token"`
 	Amount     string `json:"amount"`
+	Fee        string `json:"fee,omitempty"` // Token-2022 转账手续费，扣留在接收账户中，不计入 Amount
+}
+
+// ExtensionEvent 交易中的 Token-2022 扩展，不产生转账：
+// 机密转账的金额是加密的无法对账，transfer hook、计息和缩放 UI 金额的 mint 需要调用方额外处理。
+// 转账金额始终是原始数量，不按利率或乘数换算
+type ExtensionEvent struct {
+	Extension   string `json:"extension"`
+	Instruction string `json:"instruction"`
+	Mint        string `json:"mint"`
+	Account     string `json:"account,omitempty"`
+	Program     string `json:"program,omitempty"` // transfer hook 调用的程序
 }
 
 type Transfer struct {
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestTransferGraphDeterministic(t *testing.T) {
+	tokenDetails := map[string]*TokenInfo{
+		"So11111111111111111111111111111111111111112": {Symbol: "WSOL", Decimal: 9},
+	}
+	build := func() *TransferTracker {
+		tt := NewTransferTracker("")
+		tt.AddTransfer("UserA", "VaultB", "So11111111111111111111111111111111111111112", big.NewInt(1500000000))
+		tt.AddTransfer("VaultB", "UserA", "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", big.NewInt(250000000))
+		tt.AddTransfer("UserA", "FeeC", "So11111111111111111111111111111111111111112", big.NewInt(5000))
+		return tt
+	}
+
+	first := build().ToDOT(tokenDetails)
+	for i := 0; i < 20; i++ {
+		if got := build().ToDOT(tokenDetails); got != first {
+			t.Fatalf("DOT output is not deterministic:\n%s\n%s", first, got)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(first), "\n")
+	if lines[5] != `  "UserA" -> "VaultB" [label="1.500000 WSOL"];` {
+		t.Fatalf("unexpected first edge: %s", lines[5])
+	}
+
+	mermaid := build().ToMermaid(tokenDetails, map[string]string{"VaultB": "Vault"})
+	if !strings.Contains(mermaid, `n1["Vault<br/>VaultB"]`) {
+		t.Fatalf("unexpected mermaid output:\n%s", mermaid)
+	}
+
+	graphML := build().ToGraphML(tokenDetails, map[string]string{"VaultB": "Vault <B>"})
+	for _, want := range []string{
+		`<node id="n1">` + "\n" + `      <data key="address">VaultB</data>` + "\n" + `      <data key="label">Vault &lt;B&gt;</data>`,
+		`<edge id="e0" source="n0" target="n1">`,
+		`<data key="amount_text">1.500000</data>`,
+		`<data key="count">1</data>`,
+	} {
+		if !strings.Contains(graphML, want) {
+			t.Fatalf("graphml output missing %q:\n%s", want, graphML)
+		}
+	}
+	if strings.Count(graphML, "<edge ") != 3 || strings.Count(graphML, "<node ") != 3 {
+		t.Fatalf("unexpected graphml output:\n%s", graphML)
+	}
+
+	data, err := build().ToGraphJSON(tokenDetails, map[string]string{"VaultB": "Vault"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var graph TransferGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Nodes) != 3 || graph.Nodes[1].Label != "Vault" || len(graph.Edges) != 3 {
+		t.Fatalf("unexpected graph json: %s", data)
+	}
+	if edge := graph.Edges[1]; edge.AmountRaw != "250000000" || edge.AmountText != "" || edge.Token != "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v" {
+		t.Fatalf("unexpected edge without token details: %+v", edge)
+	}
+}
+
+func TestTransferGraphDOTEscape(t *testing.T) {
+	tt := NewTransferTracker("")
+	tt.AddTransfer(`A\"B`, "C", "T", big.NewInt(1))
+	dot := tt.Graph(nil, map[string]string{"C": `Vault\x"y`}).ToDOT()
+	for _, want := range []string{
+		`  "C" [label="Vault\\x\"y\nC"];`,
+		`  "A\\\"B" -> "C" [label="1\nT"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Fatalf("DOT output missing %s:\n%s", want, dot)
+		}
+	}
+}
@@ -1,10 +1,7 @@
 package parser
 
 import (
-	"fmt"
-	"math"
 	"math/big"
-	"strings"
 
 	"github.com/lonelybeanz/tools/pkg/log"
 )
@@ -317,54 +314,6 @@ func (tt *TransferTracker) findDestsRecursive(account, token string, memo map[st
 	return finalDests
 }
 
-// TokenInfo is a simplified struct for token details needed for the diagram.
-type TokenInfo struct {
-	Symbol  string
-	Decimal int
-}
-
-// ToDOT generates a string representation of the transfer graph in DOT format.
-func (tt *TransferTracker) ToDOT(tokenDetails map[string]*TokenInfo) string {
-	var sb strings.Builder
-	sb.WriteString("digraph transfers {\n")
-	sb.WriteString("  rankdir=LR;\n")
-	sb.WriteString(`  node [shape=box, style="rounded,filled", fillcolor=lightblue];` + "\n")
-	sb.WriteString("  edge [fontsize=10];\n\n")
-
-	type transferKey struct {
-		from, to, token string
-	}
-	aggregated := make(map[transferKey]*big.Int)
-
-	for _, tx := range tt.transfers {
-		key := transferKey{from: tx.From, to: tx.To, token: tx.Token}
-		if _, ok := aggregated[key]; !ok {
-			aggregated[key] = new(big.Int)
-		}
-		aggregated[key].Add(aggregated[key], tx.Amount)
-	}
-
-	for key, amount := range aggregated {
-		from, to, tokenAddr := key.from, key.to, key.token
-
-		details, ok := tokenDetails[tokenAddr]
-		var label string
-		if ok && details.Decimal > 0 {
-			fAmount := new(big.Float).SetInt(amount)
-			powerOf10 := new(big.Float).SetFloat64(math.Pow10(details.Decimal))
-			fAmount.Quo(fAmount, powerOf10)
-			label = fmt.Sprintf(`"%s %s"`, fAmount.Text('f', 6), details.Symbol)
-		} else {
-			label = fmt.Sprintf(`"%s\n%s"`, amount.String(), tokenAddr)
-		}
-
-		sb.WriteString(fmt.Sprintf(`  "%s" -> "%s" [label=%s];`+"\n", from, to, label))
-	}
-
-	sb.WriteString("}\n")
-	return sb.String()
-}
-
 func contains[T comparable](slice []T, value T) bool {
 	for _, item := range slice {
 		if item == value {
@@ -9,6 +9,7 @@ import (
 	associatedtokenaccount "github.com/gagliardetto/solana-go/programs/associated-token-account"
 	"github.com/gagliardetto/solana-go/programs/token"
 	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/lonelybeanz/tools/pkg/solparser/consts"
 )
 
 func validateTransaction(tx *rpc.GetParsedTransactionResult) error {
@@ -40,6 +41,26 @@ func isTransferInstruction(programID string) bool {
 	}
 }
 
+// isTokenEvent 代币账户之间的转移（包括铸造和销毁），代币账户需要换成所有者
+func isTokenEvent(eventType string) bool {
+	switch eventType {
+	case "tokenTransfer", "mintTo", "burn", "withdrawWithheld", "confidentialDeposit", "confidentialWithdraw":
+		return true
+	default:
+		return false
+	}
+}
+
+// isPseudoAccount 铸造、销毁、扣留手续费等虚拟账户，不是链上地址
+func isPseudoAccount(account string) bool {
+	switch account {
+	case consts.MINT_ACCOUNT, consts.BURN_ACCOUNT, consts.WITHHELD_ACCOUNT, consts.CONFIDENTIAL_ACCOUNT:
+		return true
+	default:
+		return false
+	}
+}
+
 func IsTokenProgramId(program solana.PublicKey) bool {
 	return program == solana.TokenProgramID || program == solana.Token2022ProgramID
 }
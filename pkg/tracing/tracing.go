@@ -0,0 +1,125 @@
+package tracing
+
+/**
+ * @Description: OpenTelemetry 链路追踪，未调用 Init 时使用全局的 noop TracerProvider，不产生开销
+ **/
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/lonelybeanz/tools"
+
+type options struct {
+	serviceName  string
+	otlpEndpoint string
+	stdout       io.Writer
+	sampleRatio  float64
+}
+
+type Option func(*options) error
+
+// WithServiceName 上报的 service.name，默认 tools
+func WithServiceName(name string) Option {
+	return func(opt *options) error {
+		opt.serviceName = name
+		return nil
+	}
+}
+
+// WithOTLPEndpoint 通过 OTLP/HTTP 导出，例如 http://localhost:4318
+func WithOTLPEndpoint(endpoint string) Option {
+	return func(opt *options) error {
+		opt.otlpEndpoint = endpoint
+		return nil
+	}
+}
+
+// WithStdout 以 JSON 输出到 w，用于本地调试
+func WithStdout(w io.Writer) Option {
+	return func(opt *options) error {
+		opt.stdout = w
+		return nil
+	}
+}
+
+// WithSampleRatio 采样比例，默认 1（全部采样）；父 span 已采样时总是采样
+func WithSampleRatio(ratio float64) Option {
+	return func(opt *options) error {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("sample ratio must be in [0, 1]")
+		}
+		opt.sampleRatio = ratio
+		return nil
+	}
+}
+
+// Init 设置全局 TracerProvider 和 W3C trace context 传播，返回的 shutdown 在退出前调用以导出剩余的 span。
+// 必须指定 OTLP 或 stdout 其中一个导出方式。
+func Init(ctx context.Context, opts ...Option) (shutdown func(context.Context) error, err error) {
+	o := options{serviceName: "tools", sampleRatio: 1}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch {
+	case o.otlpEndpoint != "":
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(o.otlpEndpoint))
+	case o.stdout != nil:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(o.stdout))
+	default:
+		return nil, fmt.Errorf("no trace exporter configured")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(o.serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Start 创建子 span，ctx 中没有 span 时创建根 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 记录错误并结束 span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject 把 ctx 中的 trace context 写入请求头，下游服务可以接上同一条链路
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
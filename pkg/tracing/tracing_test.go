@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestTransport(t *testing.T) {
+	recorder := useRecorder(t)
+
+	var traceparent string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer node.Close()
+
+	ctx, parent := Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, node.URL, bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`))
+	resp, err := NewHTTPClient(nil).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "rpc eth_blockNumber" {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	rpcSpan := spans[0]
+	if rpcSpan.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("rpc span is not a child of the request context span")
+	}
+	if !strings.Contains(traceparent, rpcSpan.SpanContext().TraceID().String()) {
+		t.Fatalf("traceparent %q not propagated", traceparent)
+	}
+}
+
+func TestInit(t *testing.T) {
+	if _, err := Init(context.Background()); err == nil {
+		t.Fatal("expected error without exporter")
+	}
+
+	prevProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prevProvider)
+
+	var out bytes.Buffer
+	shutdown, err := Init(context.Background(), WithStdout(&out), WithServiceName("txinspect"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "stage")
+	End(span, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"Name":"stage"`) || !strings.Contains(out.String(), "txinspect") {
+		t.Fatalf("unexpected stdout export %s", out.String())
+	}
+}
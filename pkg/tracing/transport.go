@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Transport 为每个 JSON-RPC 请求创建 span 的 http.RoundTripper，用于 ethclient（geth.DialWithHTTPClient）。
+// span 的父级取自请求的 context，ethclient 的 ctx 参数会一路传到这里。可以和 metrics.Transport 叠加使用。
+type Transport struct {
+	Base http.RoundTripper // 为 nil 时使用 http.DefaultTransport
+}
+
+// NewHTTPClient 返回记录 span 的 http.Client，base 为 nil 时使用 http.DefaultTransport
+func NewHTTPClient(base http.RoundTripper) *http.Client {
+	return &http.Client{Transport: &Transport{Base: base}}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || req.Body == nil {
+		return t.base().RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	method := "unknown"
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		method = "batch"
+	} else {
+		var rpcReq struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(body, &rpcReq) == nil && rpcReq.Method != "" {
+			method = rpcReq.Method
+		}
+	}
+
+	ctx, span := Start(req.Context(), "rpc "+method,
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", method),
+		attribute.String("server.address", req.URL.Host),
+	)
+	req = req.Clone(ctx)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	Inject(ctx, req.Header)
+
+	resp, err := t.base().RoundTrip(req)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		End(span, fmt.Errorf("http status %d", resp.StatusCode))
+		return resp, nil
+	}
+	End(span, err)
+	return resp, err
+}